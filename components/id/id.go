@@ -43,6 +43,17 @@ const (
 	CartPage         = "cart-page"
 	CartEmailInput   = "cart-email-input"
 	CartSubmitButton = "cart-submit-button"
+	CartSummary      = "cart-summary"
+	CartCountry      = "cart-country"
+	CartDiscountCode = "cart-discount-code"
+	CartGiftCardCode = "cart-gift-card-code"
+
+	NewsletterSignup  = "newsletter-signup"
+	NewsletterPreview = "newsletter-preview"
+	BuyerOrder        = "buyer-order"
+	ImageGCReport     = "image-gc-report"
+	DiscountFormError = "discount-form-error"
+	OriginalsReport   = "originals-report"
 )
 
 // Modal
@@ -51,6 +62,9 @@ const (
 	ProblemDescriptionID = "problem-description"
 	EditArtModalInner    = "edit-art-modal-inner"
 	EditPrintModalInner  = "edit-print-modal-inner"
+	PrintVariants        = "print-variants"
+	ImagesEditor         = "images-editor"
+	GalleryCarousel      = "gallery-carousel"
 )
 
 const (
@@ -84,6 +98,34 @@ func CartItemID(id string) string {
 	return "cart-item-" + id
 }
 
+func NewsletterRow(id string) string {
+	return "newsletter-" + id
+}
+
+func WaitlistForm(printID string) string {
+	return "waitlist-" + printID
+}
+
+// InquiryForm is the inquiry form of an artwork, or of the buy art page when artID is empty
+func InquiryForm(artID string) string {
+	if artID == "" {
+		return "inquiry"
+	}
+	return "inquiry-" + artID
+}
+
+func InquiryRow(id string) string {
+	return "inquiry-row-" + id
+}
+
+func CommissionCard(id string) string {
+	return "commission-" + id
+}
+
+func CheckoutFieldError(field string) string {
+	return "checkout-error-" + field
+}
+
 type CartSymbolMode string
 
 const (
@@ -47,45 +47,53 @@ func AddPrintModal() templ.Component {
 		if templ_7745c5c3_Err != nil {
 			return templ_7745c5c3_Err
 		}
-		templ_7745c5c3_Err = templruntime.WriteString(templ_7745c5c3_Buffer, 2, "\" class=\"bg-white rounded-lg p-6 w-full max-w-md max-h-[90vh] overflow-y-auto\"><h2 class=\"text-2xl mb-4\">Add New Print</h2><form hx-post=\"/edit/print\" class=\"flex flex-col gap-4\"><label class=\"flex flex-col\"><span class=\"mb-1 font-medium\">Title *</span> <input type=\"text\" name=\"title\" class=\"border p-2 rounded\"></label> <label class=\"flex flex-col\"><span class=\"mb-1 font-medium\">Medium</span> <input type=\"text\" name=\"medium\" class=\"border p-2 rounded\"></label> <label class=\"flex flex-col\"><span class=\"mb-1 font-medium\">Width (cm)</span> <input type=\"number\" name=\"width\" class=\"border p-2 rounded\"></label> <label class=\"flex flex-col\"><span class=\"mb-1 font-medium\">Height (cm)</span> <input type=\"number\" name=\"height\" class=\"border p-2 rounded\"></label> <label class=\"flex flex-col\"><span class=\"mb-1 font-medium\">Year</span> <input type=\"text\" name=\"year\" class=\"border p-2 rounded\"></label> <label class=\"flex flex-col\"><span class=\"mb-1 font-medium\">Description</span> <textarea name=\"description\" rows=\"3\" class=\"border p-2 rounded\"></textarea></label> <label class=\"flex flex-col\"><span class=\"mb-1 font-medium\">Price</span> <input type=\"number\" name=\"price\" class=\"border p-2 rounded\"></label> <label class=\"flex flex-col\"><span class=\"mb-1 font-medium\">Quantity left</span> <input type=\"number\" name=\"quantity_left\" class=\"border p-2 rounded\"></label> <label class=\"flex flex-col\"><span class=\"mb-1 font-medium\">Main Image *</span> <input type=\"file\" id=\"main-image\" accept=\"image/*\" class=\"border p-2 rounded\"> <input type=\"hidden\" name=\"img_url\" id=\"img-url-input\"> <input type=\"hidden\" name=\"thumb_url\" id=\"thumb-url-input\"><div id=\"main-image-preview\" class=\"mt-2\"></div></label> <label class=\"flex items-center gap-2\"><input type=\"checkbox\" name=\"show_in_store\" value=\"true\" class=\"rounded\"> <span class=\"font-medium\">Show in store</span></label> <input type=\"hidden\" name=\"created_at\" value=\"")
+		templ_7745c5c3_Err = templruntime.WriteString(templ_7745c5c3_Buffer, 2, "\" class=\"bg-white rounded-lg p-6 w-full max-w-md max-h-[90vh] overflow-y-auto\"><h2 class=\"text-2xl mb-4\">Add New Print</h2><form hx-post=\"/edit/print\" class=\"flex flex-col gap-4\"><label class=\"flex flex-col\"><span class=\"mb-1 font-medium\">Title *</span> <input type=\"text\" name=\"title\" class=\"border p-2 rounded\"></label> <label class=\"flex flex-col\"><span class=\"mb-1 font-medium\">Medium</span> <input type=\"text\" name=\"medium\" class=\"border p-2 rounded\"></label> <label class=\"flex flex-col\"><span class=\"mb-1 font-medium\">Width (cm)</span> <input type=\"number\" name=\"width\" class=\"border p-2 rounded\"></label> <label class=\"flex flex-col\"><span class=\"mb-1 font-medium\">Height (cm)</span> <input type=\"number\" name=\"height\" class=\"border p-2 rounded\"></label> <label class=\"flex flex-col\"><span class=\"mb-1 font-medium\">Year</span> <input type=\"text\" name=\"year\" class=\"border p-2 rounded\"></label> <label class=\"flex flex-col\"><span class=\"mb-1 font-medium\">Description</span> <textarea name=\"description\" rows=\"3\" class=\"border p-2 rounded\"></textarea></label> <label class=\"flex flex-col\"><span class=\"mb-1 font-medium\">Price</span> <input type=\"number\" name=\"price\" class=\"border p-2 rounded\"></label> <label class=\"flex flex-col\"><span class=\"mb-1 font-medium\">Quantity left</span> <input type=\"number\" name=\"quantity_left\" class=\"border p-2 rounded\"></label>")
+		if templ_7745c5c3_Err != nil {
+			return templ_7745c5c3_Err
+		}
+		templ_7745c5c3_Err = ImagesEditor(nil, "").Render(ctx, templ_7745c5c3_Buffer)
+		if templ_7745c5c3_Err != nil {
+			return templ_7745c5c3_Err
+		}
+		templ_7745c5c3_Err = templruntime.WriteString(templ_7745c5c3_Buffer, 3, "<label class=\"flex items-center gap-2\"><input type=\"checkbox\" name=\"show_in_store\" value=\"true\" class=\"rounded\"> <span class=\"font-medium\">Show in store</span></label> <input type=\"hidden\" name=\"created_at\" value=\"")
 		if templ_7745c5c3_Err != nil {
 			return templ_7745c5c3_Err
 		}
 		var templ_7745c5c3_Var3 string
 		templ_7745c5c3_Var3, templ_7745c5c3_Err = templ.JoinStringErrs(time.Now().Format(time.RFC3339))
 		if templ_7745c5c3_Err != nil {
-			return templ.Error{Err: templ_7745c5c3_Err, FileName: `components/pages/add-print-modal.templ`, Line: 64, Col: 82}
+			return templ.Error{Err: templ_7745c5c3_Err, FileName: `components/pages/add-print-modal.templ`, Line: 53, Col: 82}
 		}
 		_, templ_7745c5c3_Err = templ_7745c5c3_Buffer.WriteString(templ.EscapeString(templ_7745c5c3_Var3))
 		if templ_7745c5c3_Err != nil {
 			return templ_7745c5c3_Err
 		}
-		templ_7745c5c3_Err = templruntime.WriteString(templ_7745c5c3_Buffer, 3, "\"><div class=\"flex justify-end gap-2 mt-4\"><button type=\"button\" hx-get=\"/modal/close\" hx-target=\"")
+		templ_7745c5c3_Err = templruntime.WriteString(templ_7745c5c3_Buffer, 4, "\"><div class=\"flex justify-end gap-2 mt-4\"><button type=\"button\" hx-get=\"/modal/close\" hx-target=\"")
 		if templ_7745c5c3_Err != nil {
 			return templ_7745c5c3_Err
 		}
 		var templ_7745c5c3_Var4 string
 		templ_7745c5c3_Var4, templ_7745c5c3_Err = templ.JoinStringErrs(id.Selector(id.ModalContainerID))
 		if templ_7745c5c3_Err != nil {
-			return templ.Error{Err: templ_7745c5c3_Err, FileName: `components/pages/add-print-modal.templ`, Line: 69, Col: 50}
+			return templ.Error{Err: templ_7745c5c3_Err, FileName: `components/pages/add-print-modal.templ`, Line: 58, Col: 50}
 		}
 		_, templ_7745c5c3_Err = templ_7745c5c3_Buffer.WriteString(templ.EscapeString(templ_7745c5c3_Var4))
 		if templ_7745c5c3_Err != nil {
 			return templ_7745c5c3_Err
 		}
-		templ_7745c5c3_Err = templruntime.WriteString(templ_7745c5c3_Buffer, 4, "\" class=\"px-4 py-2 bg-gray-300 rounded hover:bg-gray-400 transition-colors\">Cancel</button> <button type=\"submit\" id=\"submit-btn\" class=\"px-4 py-2 bg-blue-500 text-white rounded hover:bg-blue-600 transition-colors disabled:bg-gray-400\">Create</button></div></form></div><script>\n\t\t\t(function(){\n\t\t\t\tconst mainImageInput = document.getElementById('main-image');\n\t\t\t\tconst imgUrlInput = document.getElementById('img-url-input');\n\t\t\t\tconst thumbUrlInput = document.getElementById('thumb-url-input');\n\t\t\t\tconst mainPreview = document.getElementById('main-image-preview');\n\t\t\t\tconst submitBtn = document.getElementById('submit-btn');\n\n\t\t\t\tasync function uploadImage(file, previewEl, urlInput, thumbUrlInput) {\n\t\t\t\t\tconst formData = new FormData();\n\t\t\t\t\tformData.append('image', file);\n\n\t\t\t\t\ttry {\n\t\t\t\t\t\tconst response = await fetch('/edit/upload', {\n\t\t\t\t\t\t\tmethod: 'POST',\n\t\t\t\t\t\t\tbody: formData\n\t\t\t\t\t\t});\n\n\t\t\t\t\t\tif (!response.ok) throw new Error('Upload failed');\n\n\t\t\t\t\t\tconst data = await response.json();\n\t\t\t\t\t\turlInput.value = data.url;\n\t\t\t\t\t\tthumbUrlInput.value = data.thumb_url;\n\t\t\t\t\t\t\n\t\t\t\t\t\tpreviewEl.innerHTML = `<img src=\"${data.url}\" class=\"max-w-full h-32 object-contain border rounded\"/>`;\n\t\t\t\t\t\treturn true;\n\t\t\t\t\t} catch (error) {\n\t\t\t\t\t\talert('Failed to upload image: ' + error.message);\n\t\t\t\t\t\treturn false;\n\t\t\t\t\t}\n\t\t\t\t}\n\n\t\t\t\tmainImageInput.addEventListener('change', async (e) => {\n\t\t\t\t\tif (e.target.files[0]) {\n\t\t\t\t\t\tsubmitBtn.disabled = true;\n\t\t\t\t\t\tmainPreview.innerHTML = '<p class=\"text-sm text-gray-600\">Uploading...</p>';\n\t\t\t\t\t\tawait uploadImage(e.target.files[0], mainPreview, imgUrlInput, thumbUrlInput);\n\t\t\t\t\t\tsubmitBtn.disabled = false;\n\t\t\t\t\t}\n\t\t\t\t});\n\n\t\t\t\tconst modalInner = document.getElementById(\"")
+		templ_7745c5c3_Err = templruntime.WriteString(templ_7745c5c3_Buffer, 5, "\" class=\"px-4 py-2 bg-gray-300 rounded hover:bg-gray-400 transition-colors\">Cancel</button> <button type=\"submit\" id=\"submit-btn\" class=\"px-4 py-2 bg-blue-500 text-white rounded hover:bg-blue-600 transition-colors disabled:bg-gray-400\">Create</button></div></form></div><script>\n\t\t\t(function(){\n\t\t\t\tconst modalInner = document.getElementById(\"")
 		if templ_7745c5c3_Err != nil {
 			return templ_7745c5c3_Err
 		}
 		templ_7745c5c3_Var5, templ_7745c5c3_Err := templruntime.ScriptContentInsideStringLiteral(id.EditArtModalInner)
 		if templ_7745c5c3_Err != nil {
-			return templ.Error{Err: templ_7745c5c3_Err, FileName: `components/pages/add-print-modal.templ`, Line: 125, Col: 71}
+			return templ.Error{Err: templ_7745c5c3_Err, FileName: `components/pages/add-print-modal.templ`, Line: 75, Col: 71}
 		}
 		_, templ_7745c5c3_Err = templ_7745c5c3_Buffer.WriteString(templ_7745c5c3_Var5)
 		if templ_7745c5c3_Err != nil {
 			return templ_7745c5c3_Err
 		}
-		templ_7745c5c3_Err = templruntime.WriteString(templ_7745c5c3_Buffer, 5, "\");\n\t\t\t\tmodalInner.addEventListener(\"click\", function(event) {\n\t\t\t\t\tevent.stopPropagation();\n\t\t\t\t});\n\t\t\t}())\n\t\t</script></div>")
+		templ_7745c5c3_Err = templruntime.WriteString(templ_7745c5c3_Buffer, 6, "\");\n\t\t\t\tmodalInner.addEventListener(\"click\", function(event) {\n\t\t\t\t\tevent.stopPropagation();\n\t\t\t\t});\n\t\t\t}())\n\t\t</script></div>")
 		if templ_7745c5c3_Err != nil {
 			return templ_7745c5c3_Err
 		}
@@ -0,0 +1,246 @@
+// Code generated by templ - DO NOT EDIT.
+
+// templ: version: v0.3.960
+package pages
+
+//lint:file-ignore SA4006 This context is only used if a nested component is present.
+
+import "github.com/a-h/templ"
+import templruntime "github.com/a-h/templ/runtime"
+
+import (
+	"github.com/sebwib/emma-site-htmx/components/id"
+	"github.com/sebwib/emma-site-htmx/db"
+	"github.com/sebwib/emma-site-htmx/services"
+	"strconv"
+)
+
+// ImagesEditor uploads the images of an art or print, several at a time, and lets
+// them be dragged in order and one of them picked as the cover. The images are sent
+// with the form as the images_* fields, in order.
+func ImagesEditor(images []db.Image, coverURL string) templ.Component {
+	return templruntime.GeneratedTemplate(func(templ_7745c5c3_Input templruntime.GeneratedComponentInput) (templ_7745c5c3_Err error) {
+		templ_7745c5c3_W, ctx := templ_7745c5c3_Input.Writer, templ_7745c5c3_Input.Context
+		if templ_7745c5c3_CtxErr := ctx.Err(); templ_7745c5c3_CtxErr != nil {
+			return templ_7745c5c3_CtxErr
+		}
+		templ_7745c5c3_Buffer, templ_7745c5c3_IsBuffer := templruntime.GetBuffer(templ_7745c5c3_W)
+		if !templ_7745c5c3_IsBuffer {
+			defer func() {
+				templ_7745c5c3_BufErr := templruntime.ReleaseBuffer(templ_7745c5c3_Buffer)
+				if templ_7745c5c3_Err == nil {
+					templ_7745c5c3_Err = templ_7745c5c3_BufErr
+				}
+			}()
+		}
+		ctx = templ.InitializeContext(ctx)
+		templ_7745c5c3_Var1 := templ.GetChildren(ctx)
+		if templ_7745c5c3_Var1 == nil {
+			templ_7745c5c3_Var1 = templ.NopComponent
+		}
+		ctx = templ.ClearChildren(ctx)
+		templ_7745c5c3_Err = templruntime.WriteString(templ_7745c5c3_Buffer, 1, "<div id=\"")
+		if templ_7745c5c3_Err != nil {
+			return templ_7745c5c3_Err
+		}
+		var templ_7745c5c3_Var2 string
+		templ_7745c5c3_Var2, templ_7745c5c3_Err = templ.JoinStringErrs(id.ImagesEditor)
+		if templ_7745c5c3_Err != nil {
+			return templ.Error{Err: templ_7745c5c3_Err, FileName: `components/pages/images-editor.templ`, Line: 14, Col: 26}
+		}
+		_, templ_7745c5c3_Err = templ_7745c5c3_Buffer.WriteString(templ.EscapeString(templ_7745c5c3_Var2))
+		if templ_7745c5c3_Err != nil {
+			return templ_7745c5c3_Err
+		}
+		templ_7745c5c3_Err = templruntime.WriteString(templ_7745c5c3_Buffer, 2, "\" class=\"flex flex-col gap-2\"><span class=\"font-medium\">Images *</span><ul class=\"flex flex-col gap-2\" data-images>")
+		if templ_7745c5c3_Err != nil {
+			return templ_7745c5c3_Err
+		}
+		for _, image := range images {
+			templ_7745c5c3_Err = imagesEditorItem(image, image.URL == coverURL).Render(ctx, templ_7745c5c3_Buffer)
+			if templ_7745c5c3_Err != nil {
+				return templ_7745c5c3_Err
+			}
+		}
+		templ_7745c5c3_Err = templruntime.WriteString(templ_7745c5c3_Buffer, 3, "</ul><template data-image-template>")
+		if templ_7745c5c3_Err != nil {
+			return templ_7745c5c3_Err
+		}
+		templ_7745c5c3_Err = imagesEditorItem(db.Image{}, false).Render(ctx, templ_7745c5c3_Buffer)
+		if templ_7745c5c3_Err != nil {
+			return templ_7745c5c3_Err
+		}
+		templ_7745c5c3_Err = templruntime.WriteString(templ_7745c5c3_Buffer, 4, "</template><input type=\"file\" multiple accept=\"image/jpeg,image/png,image/webp\" class=\"border p-2 rounded\" data-image-input><div class=\"flex flex-col gap-1\" data-image-status></div><p class=\"text-sm text-gray-600\">Drag the images to order them. The cover is shown in the gallery and the shop.</p></div><script>\n\t\t(function() {\n\t\t\tconst editor = document.getElementById(\"")
+		if templ_7745c5c3_Err != nil {
+			return templ_7745c5c3_Err
+		}
+		templ_7745c5c3_Var3, templ_7745c5c3_Err := templruntime.ScriptContentInsideStringLiteral(id.ImagesEditor)
+		if templ_7745c5c3_Err != nil {
+			return templ.Error{Err: templ_7745c5c3_Err, FileName: `components/pages/images-editor.templ`, Line: 36, Col: 61}
+		}
+		_, templ_7745c5c3_Err = templ_7745c5c3_Buffer.WriteString(templ_7745c5c3_Var3)
+		if templ_7745c5c3_Err != nil {
+			return templ_7745c5c3_Err
+		}
+		templ_7745c5c3_Err = templruntime.WriteString(templ_7745c5c3_Buffer, 5, "\");\n\t\t\tconst list = editor.querySelector('[data-images]');\n\t\t\tconst template = editor.querySelector('[data-image-template]');\n\t\t\tconst input = editor.querySelector('[data-image-input]');\n\t\t\tconst status = editor.querySelector('[data-image-status]');\n\t\t\tconst submitBtn = editor.closest('form').querySelector('[type=\"submit\"]');\n\t\t\tlet draggedElement = null;\n\n\t\t\t// the first image is the cover until another one is picked, and the last\n\t\t\t// image can't be removed\n\t\t\tconst update = () => {\n\t\t\t\tconst radios = list.querySelectorAll('input[name=\"cover_url\"]');\n\t\t\t\tif (radios.length > 0 && !list.querySelector('input[name=\"cover_url\"]:checked')) {\n\t\t\t\t\tradios[0].checked = true;\n\t\t\t\t}\n\t\t\t\tlist.querySelectorAll('[data-image-remove]').forEach(button => {\n\t\t\t\t\tbutton.hidden = radios.length === 1;\n\t\t\t\t});\n\t\t\t};\n\n\t\t\tconst addImage = (data) => {\n\t\t\t\tconst item = template.content.firstElementChild.cloneNode(true);\n\t\t\t\tconst set = (name, value) => {\n\t\t\t\t\titem.querySelector(`input[name=\"${name}\"]`).value = value ?? '';\n\t\t\t\t};\n\t\t\t\tset('images_url', data.url);\n\t\t\t\tset('images_thumb_url', data.thumb_url);\n\t\t\t\tset('images_placeholder', data.placeholder);\n\t\t\t\tset('images_dominant_color', data.dominant_color);\n\t\t\t\tset('images_width', data.image_width);\n\t\t\t\tset('images_height', data.image_height);\n\t\t\t\tset('cover_url', data.url);\n\t\t\t\titem.querySelector('[data-image-thumb]').src = data.thumb_url;\n\t\t\t\tlist.appendChild(item);\n\t\t\t\tupdate();\n\t\t\t};\n\n\t\t\tinput.addEventListener('change', async () => {\n\t\t\t\tconst files = Array.from(input.files);\n\t\t\t\tinput.value = '';\n\t\t\t\tstatus.replaceChildren();\n\t\t\t\tsubmitBtn.disabled = true;\n\n\t\t\t\t// one at a time, each upload makes all the renditions\n\t\t\t\tfor (const file of files) {\n\t\t\t\t\tconst line = document.createElement('p');\n\t\t\t\t\tline.className = 'text-sm text-gray-600';\n\t\t\t\t\tline.textContent = 'Uploading ' + file.name + '...';\n\t\t\t\t\tstatus.appendChild(line);\n\n\t\t\t\t\tconst formData = new FormData();\n\t\t\t\t\tformData.append('image', file);\n\t\t\t\t\ttry {\n\t\t\t\t\t\tconst response = await fetch('/edit/upload', {\n\t\t\t\t\t\t\tmethod: 'POST',\n\t\t\t\t\t\t\tbody: formData\n\t\t\t\t\t\t});\n\t\t\t\t\t\tconst data = await response.json().catch(() => ({}));\n\t\t\t\t\t\tif (!response.ok) throw new Error(data.error || 'Upload failed');\n\n\t\t\t\t\t\taddImage(data);\n\t\t\t\t\t\tline.remove();\n\t\t\t\t\t} catch (error) {\n\t\t\t\t\t\tline.className = 'text-sm text-red-600';\n\t\t\t\t\t\tline.textContent = 'Failed to upload ' + file.name + ': ' + error.message;\n\t\t\t\t\t}\n\t\t\t\t}\n\n\t\t\t\tsubmitBtn.disabled = false;\n\t\t\t});\n\n\t\t\tlist.addEventListener('click', function(e) {\n\t\t\t\tconst remove = e.target.closest('[data-image-remove]');\n\t\t\t\tif (remove) {\n\t\t\t\t\tremove.closest('li').remove();\n\t\t\t\t\tupdate();\n\t\t\t\t}\n\t\t\t});\n\n\t\t\tlist.addEventListener('dragstart', function(e) {\n\t\t\t\tif (e.target.tagName === 'LI') {\n\t\t\t\t\tdraggedElement = e.target;\n\t\t\t\t\te.target.style.opacity = '0.4';\n\t\t\t\t}\n\t\t\t});\n\n\t\t\tlist.addEventListener('dragend', function(e) {\n\t\t\t\tif (e.target.tagName === 'LI') {\n\t\t\t\t\te.target.style.opacity = '1';\n\t\t\t\t}\n\t\t\t\tdraggedElement = null;\n\t\t\t});\n\n\t\t\tlist.addEventListener('dragover', function(e) {\n\t\t\t\tif (!draggedElement) return;\n\t\t\t\te.preventDefault();\n\t\t\t\tconst afterElement = getDragAfterElement(list, e.clientY);\n\t\t\t\tif (afterElement == null) {\n\t\t\t\t\tlist.appendChild(draggedElement);\n\t\t\t\t} else if (afterElement !== draggedElement) {\n\t\t\t\t\tlist.insertBefore(draggedElement, afterElement);\n\t\t\t\t}\n\t\t\t});\n\n\t\t\tlist.addEventListener('drop', function(e) {\n\t\t\t\te.preventDefault();\n\t\t\t});\n\n\t\t\tfunction getDragAfterElement(container, y) {\n\t\t\t\tconst draggableElements = [...container.querySelectorAll('li')].filter(child => child !== draggedElement);\n\n\t\t\t\treturn draggableElements.reduce((closest, child) => {\n\t\t\t\t\tconst box = child.getBoundingClientRect();\n\t\t\t\t\tconst offset = y - box.top - box.height / 2;\n\n\t\t\t\t\tif (offset < 0 && offset > closest.offset) {\n\t\t\t\t\t\treturn { offset: offset, element: child };\n\t\t\t\t\t} else {\n\t\t\t\t\t\treturn closest;\n\t\t\t\t\t}\n\t\t\t\t}, { offset: Number.NEGATIVE_INFINITY }).element;\n\t\t\t}\n\n\t\t\tupdate();\n\t\t})();\n\t</script>")
+		if templ_7745c5c3_Err != nil {
+			return templ_7745c5c3_Err
+		}
+		return nil
+	})
+}
+
+func imagesEditorItem(image db.Image, cover bool) templ.Component {
+	return templruntime.GeneratedTemplate(func(templ_7745c5c3_Input templruntime.GeneratedComponentInput) (templ_7745c5c3_Err error) {
+		templ_7745c5c3_W, ctx := templ_7745c5c3_Input.Writer, templ_7745c5c3_Input.Context
+		if templ_7745c5c3_CtxErr := ctx.Err(); templ_7745c5c3_CtxErr != nil {
+			return templ_7745c5c3_CtxErr
+		}
+		templ_7745c5c3_Buffer, templ_7745c5c3_IsBuffer := templruntime.GetBuffer(templ_7745c5c3_W)
+		if !templ_7745c5c3_IsBuffer {
+			defer func() {
+				templ_7745c5c3_BufErr := templruntime.ReleaseBuffer(templ_7745c5c3_Buffer)
+				if templ_7745c5c3_Err == nil {
+					templ_7745c5c3_Err = templ_7745c5c3_BufErr
+				}
+			}()
+		}
+		ctx = templ.InitializeContext(ctx)
+		templ_7745c5c3_Var4 := templ.GetChildren(ctx)
+		if templ_7745c5c3_Var4 == nil {
+			templ_7745c5c3_Var4 = templ.NopComponent
+		}
+		ctx = templ.ClearChildren(ctx)
+		templ_7745c5c3_Err = templruntime.WriteString(templ_7745c5c3_Buffer, 6, "<li draggable=\"true\" class=\"flex items-center gap-3 border rounded p-2 bg-white cursor-move\"><img")
+		if templ_7745c5c3_Err != nil {
+			return templ_7745c5c3_Err
+		}
+		if image.URL != "" {
+			templ_7745c5c3_Err = templruntime.WriteString(templ_7745c5c3_Buffer, 7, " src=\"")
+			if templ_7745c5c3_Err != nil {
+				return templ_7745c5c3_Err
+			}
+			var templ_7745c5c3_Var5 string
+			templ_7745c5c3_Var5, templ_7745c5c3_Err = templ.JoinStringErrs(resizedImgUrl(image.URL, services.ThumbWidth))
+			if templ_7745c5c3_Err != nil {
+				return templ.Error{Err: templ_7745c5c3_Err, FileName: `components/pages/images-editor.templ`, Line: 168, Col: 55}
+			}
+			_, templ_7745c5c3_Err = templ_7745c5c3_Buffer.WriteString(templ.EscapeString(templ_7745c5c3_Var5))
+			if templ_7745c5c3_Err != nil {
+				return templ_7745c5c3_Err
+			}
+			templ_7745c5c3_Err = templruntime.WriteString(templ_7745c5c3_Buffer, 8, "\"")
+			if templ_7745c5c3_Err != nil {
+				return templ_7745c5c3_Err
+			}
+		}
+		templ_7745c5c3_Err = templruntime.WriteString(templ_7745c5c3_Buffer, 9, " class=\"h-16 w-16 object-cover border rounded\" draggable=\"false\" data-image-thumb> <input type=\"hidden\" name=\"images_url\" value=\"")
+		if templ_7745c5c3_Err != nil {
+			return templ_7745c5c3_Err
+		}
+		var templ_7745c5c3_Var6 string
+		templ_7745c5c3_Var6, templ_7745c5c3_Err = templ.JoinStringErrs(image.URL)
+		if templ_7745c5c3_Err != nil {
+			return templ.Error{Err: templ_7745c5c3_Err, FileName: `components/pages/images-editor.templ`, Line: 174, Col: 58}
+		}
+		_, templ_7745c5c3_Err = templ_7745c5c3_Buffer.WriteString(templ.EscapeString(templ_7745c5c3_Var6))
+		if templ_7745c5c3_Err != nil {
+			return templ_7745c5c3_Err
+		}
+		templ_7745c5c3_Err = templruntime.WriteString(templ_7745c5c3_Buffer, 10, "\"> <input type=\"hidden\" name=\"images_thumb_url\" value=\"")
+		if templ_7745c5c3_Err != nil {
+			return templ_7745c5c3_Err
+		}
+		var templ_7745c5c3_Var7 string
+		templ_7745c5c3_Var7, templ_7745c5c3_Err = templ.JoinStringErrs(image.ThumbURL)
+		if templ_7745c5c3_Err != nil {
+			return templ.Error{Err: templ_7745c5c3_Err, FileName: `components/pages/images-editor.templ`, Line: 175, Col: 69}
+		}
+		_, templ_7745c5c3_Err = templ_7745c5c3_Buffer.WriteString(templ.EscapeString(templ_7745c5c3_Var7))
+		if templ_7745c5c3_Err != nil {
+			return templ_7745c5c3_Err
+		}
+		templ_7745c5c3_Err = templruntime.WriteString(templ_7745c5c3_Buffer, 11, "\"> <input type=\"hidden\" name=\"images_placeholder\" value=\"")
+		if templ_7745c5c3_Err != nil {
+			return templ_7745c5c3_Err
+		}
+		var templ_7745c5c3_Var8 string
+		templ_7745c5c3_Var8, templ_7745c5c3_Err = templ.JoinStringErrs(image.Placeholder)
+		if templ_7745c5c3_Err != nil {
+			return templ.Error{Err: templ_7745c5c3_Err, FileName: `components/pages/images-editor.templ`, Line: 176, Col: 74}
+		}
+		_, templ_7745c5c3_Err = templ_7745c5c3_Buffer.WriteString(templ.EscapeString(templ_7745c5c3_Var8))
+		if templ_7745c5c3_Err != nil {
+			return templ_7745c5c3_Err
+		}
+		templ_7745c5c3_Err = templruntime.WriteString(templ_7745c5c3_Buffer, 12, "\"> <input type=\"hidden\" name=\"images_dominant_color\" value=\"")
+		if templ_7745c5c3_Err != nil {
+			return templ_7745c5c3_Err
+		}
+		var templ_7745c5c3_Var9 string
+		templ_7745c5c3_Var9, templ_7745c5c3_Err = templ.JoinStringErrs(image.DominantColor)
+		if templ_7745c5c3_Err != nil {
+			return templ.Error{Err: templ_7745c5c3_Err, FileName: `components/pages/images-editor.templ`, Line: 177, Col: 79}
+		}
+		_, templ_7745c5c3_Err = templ_7745c5c3_Buffer.WriteString(templ.EscapeString(templ_7745c5c3_Var9))
+		if templ_7745c5c3_Err != nil {
+			return templ_7745c5c3_Err
+		}
+		templ_7745c5c3_Err = templruntime.WriteString(templ_7745c5c3_Buffer, 13, "\"> <input type=\"hidden\" name=\"images_width\" value=\"")
+		if templ_7745c5c3_Err != nil {
+			return templ_7745c5c3_Err
+		}
+		var templ_7745c5c3_Var10 string
+		templ_7745c5c3_Var10, templ_7745c5c3_Err = templ.JoinStringErrs(strconv.Itoa(image.Width))
+		if templ_7745c5c3_Err != nil {
+			return templ.Error{Err: templ_7745c5c3_Err, FileName: `components/pages/images-editor.templ`, Line: 178, Col: 76}
+		}
+		_, templ_7745c5c3_Err = templ_7745c5c3_Buffer.WriteString(templ.EscapeString(templ_7745c5c3_Var10))
+		if templ_7745c5c3_Err != nil {
+			return templ_7745c5c3_Err
+		}
+		templ_7745c5c3_Err = templruntime.WriteString(templ_7745c5c3_Buffer, 14, "\"> <input type=\"hidden\" name=\"images_height\" value=\"")
+		if templ_7745c5c3_Err != nil {
+			return templ_7745c5c3_Err
+		}
+		var templ_7745c5c3_Var11 string
+		templ_7745c5c3_Var11, templ_7745c5c3_Err = templ.JoinStringErrs(strconv.Itoa(image.Height))
+		if templ_7745c5c3_Err != nil {
+			return templ.Error{Err: templ_7745c5c3_Err, FileName: `components/pages/images-editor.templ`, Line: 179, Col: 78}
+		}
+		_, templ_7745c5c3_Err = templ_7745c5c3_Buffer.WriteString(templ.EscapeString(templ_7745c5c3_Var11))
+		if templ_7745c5c3_Err != nil {
+			return templ_7745c5c3_Err
+		}
+		templ_7745c5c3_Err = templruntime.WriteString(templ_7745c5c3_Buffer, 15, "\"> <label class=\"flex items-center gap-1 text-sm\"><input type=\"radio\" name=\"cover_url\" value=\"")
+		if templ_7745c5c3_Err != nil {
+			return templ_7745c5c3_Err
+		}
+		var templ_7745c5c3_Var12 string
+		templ_7745c5c3_Var12, templ_7745c5c3_Err = templ.JoinStringErrs(image.URL)
+		if templ_7745c5c3_Err != nil {
+			return templ.Error{Err: templ_7745c5c3_Err, FileName: `components/pages/images-editor.templ`, Line: 181, Col: 57}
+		}
+		_, templ_7745c5c3_Err = templ_7745c5c3_Buffer.WriteString(templ.EscapeString(templ_7745c5c3_Var12))
+		if templ_7745c5c3_Err != nil {
+			return templ_7745c5c3_Err
+		}
+		templ_7745c5c3_Err = templruntime.WriteString(templ_7745c5c3_Buffer, 16, "\"")
+		if templ_7745c5c3_Err != nil {
+			return templ_7745c5c3_Err
+		}
+		if cover {
+			templ_7745c5c3_Err = templruntime.WriteString(templ_7745c5c3_Buffer, 17, " checked")
+			if templ_7745c5c3_Err != nil {
+				return templ_7745c5c3_Err
+			}
+		}
+		templ_7745c5c3_Err = templruntime.WriteString(templ_7745c5c3_Buffer, 18, "> Cover</label> <button type=\"button\" class=\"ml-auto px-2 py-1 bg-red-500 text-white rounded hover:bg-red-600 transition-colors\" data-image-remove>✕</button></li>")
+		if templ_7745c5c3_Err != nil {
+			return templ_7745c5c3_Err
+		}
+		return nil
+	})
+}
+
+var _ = templruntime.GeneratedTemplate
@@ -1,6 +1,7 @@
 package db
 
 import (
+	"errors"
 	"time"
 
 	"github.com/google/uuid"
@@ -20,6 +21,31 @@ type Art struct {
 	CreatedAt     string
 	Ordering      float64
 	ShowInGallery bool
+
+	// Price is the price of the original, 0 when not priced
+	Price           float64
+	ForSale         bool
+	ReservedOrderID string
+
+	// Placeholder is a tiny blurry copy of the image as a data URL, shown with the
+	// dominant colour while the image loads
+	Placeholder   string
+	DominantColor string
+	// ImageWidth and ImageHeight are the image's size in pixels, 0 when unknown
+	ImageWidth  int
+	ImageHeight int
+
+	// Renditions are loaded separately, resized copies of the image smallest first
+	Renditions []ImageRendition
+	// Images are only loaded by GetArtById, see AllImages
+	Images []Image
+}
+
+var ErrArtUnavailable = errors.New("art is not available for purchase")
+
+// IsPurchasable reports whether the original can be added to the cart
+func (art Art) IsPurchasable() bool {
+	return art.ForSale && !art.Sold && art.Price > 0 && art.ReservedOrderID == ""
 }
 
 type ArtPatch struct {
@@ -34,6 +60,13 @@ type ArtPatch struct {
 	Sold          *bool    `json:"sold,omitempty"`
 	Ordering      *float64 `json:"ordering,omitempty"`
 	ShowInGallery *bool    `json:"show_in_gallery,omitempty"`
+	Price         *float64 `json:"price,omitempty"`
+	ForSale       *bool    `json:"for_sale,omitempty"`
+	// the placeholder is only set from uploads, never from patches sent as JSON
+	Placeholder   *string `json:"-"`
+	DominantColor *string `json:"-"`
+	ImageWidth    *int    `json:"-"`
+	ImageHeight   *int    `json:"-"`
 }
 
 func (db *DB) createArtTable() error {
@@ -51,26 +84,59 @@ func (db *DB) createArtTable() error {
 		sold BOOLEAN NOT NULL DEFAULT 0,
 		created_at TEXT NOT NULL,
 		ordering REAL NOT NULL DEFAULT 0,
-		show_in_gallery BOOLEAN NOT NULL DEFAULT 1
+		show_in_gallery BOOLEAN NOT NULL DEFAULT 1,
+		price REAL NOT NULL DEFAULT 0,
+		for_sale BOOLEAN NOT NULL DEFAULT 0,
+		reserved_order_id TEXT NOT NULL DEFAULT '',
+		placeholder TEXT NOT NULL DEFAULT '',
+		dominant_color TEXT NOT NULL DEFAULT '',
+		image_width INTEGER NOT NULL DEFAULT 0,
+		image_height INTEGER NOT NULL DEFAULT 0
 	);
 	`)
-	return err
+	if err != nil {
+		return err
+	}
+
+	if err := db.ensureColumn("arts", "price", "REAL NOT NULL DEFAULT 0"); err != nil {
+		return err
+	}
+	if err := db.ensureColumn("arts", "for_sale", "BOOLEAN NOT NULL DEFAULT 0"); err != nil {
+		return err
+	}
+	if err := db.ensureColumn("arts", "reserved_order_id", "TEXT NOT NULL DEFAULT ''"); err != nil {
+		return err
+	}
+	if err := db.ensureColumn("arts", "placeholder", "TEXT NOT NULL DEFAULT ''"); err != nil {
+		return err
+	}
+	if err := db.ensureColumn("arts", "dominant_color", "TEXT NOT NULL DEFAULT ''"); err != nil {
+		return err
+	}
+	if err := db.ensureColumn("arts", "image_width", "INTEGER NOT NULL DEFAULT 0"); err != nil {
+		return err
+	}
+	return db.ensureColumn("arts", "image_height", "INTEGER NOT NULL DEFAULT 0")
 }
 
-func (db *DB) AddArt(art Art) error {
+// AddArt stores the art and returns its id
+func (db *DB) AddArt(art Art) (string, error) {
 	art.Id = uuid.NewString()
 	art.CreatedAt = time.Now().Format(time.RFC3339)
 
 	_, err := db.Exec(`
-	INSERT INTO arts (id, img_url, thumb_url, title, medium, width, height, year, description, sold, created_at, ordering)
-	VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?);
-	`, art.Id, art.ImgURL, art.ThumbURL, art.Title, art.Medium, art.Width, art.Height, art.Year, art.Description, art.Sold, art.CreatedAt, art.Ordering)
-	return err
+	INSERT INTO arts (id, img_url, thumb_url, title, medium, width, height, year, description, sold, created_at, ordering, price, for_sale, placeholder, dominant_color, image_width, image_height)
+	VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?);
+	`, art.Id, art.ImgURL, art.ThumbURL, art.Title, art.Medium, art.Width, art.Height, art.Year, art.Description, art.Sold, art.CreatedAt, art.Ordering, art.Price, art.ForSale, art.Placeholder, art.DominantColor, art.ImageWidth, art.ImageHeight)
+	return art.Id, err
 }
 
 func (db *DB) DeleteArt(id string) error {
 	_, err := db.Exec(`DELETE FROM arts WHERE id = ?;`, id)
-	return err
+	if err != nil {
+		return err
+	}
+	return db.DeleteImages(ImageOwnerArt, id)
 }
 
 func (db *DB) GetArtPaged(limit, offset int) ([]Art, error) {
@@ -87,7 +153,14 @@ func (db *DB) GetArtPaged(limit, offset int) ([]Art, error) {
 			description, 
 			sold, 
 			created_at, 
-			ordering 
+			ordering,
+			price,
+			for_sale,
+			reserved_order_id,
+			placeholder,
+			dominant_color,
+			image_width,
+			image_height
 		FROM 
 			arts
 		WHERE
@@ -103,7 +176,7 @@ func (db *DB) GetArtPaged(limit, offset int) ([]Art, error) {
 	var arts []Art
 	for rows.Next() {
 		var art Art
-		if err := rows.Scan(&art.Id, &art.ImgURL, &art.ThumbURL, &art.Title, &art.Medium, &art.Width, &art.Height, &art.Year, &art.Description, &art.Sold, &art.CreatedAt, &art.Ordering); err != nil {
+		if err := rows.Scan(&art.Id, &art.ImgURL, &art.ThumbURL, &art.Title, &art.Medium, &art.Width, &art.Height, &art.Year, &art.Description, &art.Sold, &art.CreatedAt, &art.Ordering, &art.Price, &art.ForSale, &art.ReservedOrderID, &art.Placeholder, &art.DominantColor, &art.ImageWidth, &art.ImageHeight); err != nil {
 			return nil, err
 		}
 		arts = append(arts, art)
@@ -111,12 +184,13 @@ func (db *DB) GetArtPaged(limit, offset int) ([]Art, error) {
 	if err := rows.Err(); err != nil {
 		return nil, err
 	}
+	rows.Close()
 
-	return arts, nil
+	return arts, db.attachArtRenditions(arts)
 }
 
 func (db *DB) GetArts() ([]Art, error) {
-	rows, err := db.Query(`SELECT id, img_url, thumb_url, title, medium, width, height, year, description, sold, created_at, ordering, show_in_gallery FROM arts ORDER BY ordering DESC, title ASC`)
+	rows, err := db.Query(`SELECT id, img_url, thumb_url, title, medium, width, height, year, description, sold, created_at, ordering, show_in_gallery, price, for_sale, reserved_order_id, placeholder, dominant_color, image_width, image_height FROM arts ORDER BY ordering DESC, title ASC`)
 	if err != nil {
 		return nil, err
 	}
@@ -125,7 +199,7 @@ func (db *DB) GetArts() ([]Art, error) {
 	var arts []Art
 	for rows.Next() {
 		var art Art
-		if err := rows.Scan(&art.Id, &art.ImgURL, &art.ThumbURL, &art.Title, &art.Medium, &art.Width, &art.Height, &art.Year, &art.Description, &art.Sold, &art.CreatedAt, &art.Ordering, &art.ShowInGallery); err != nil {
+		if err := rows.Scan(&art.Id, &art.ImgURL, &art.ThumbURL, &art.Title, &art.Medium, &art.Width, &art.Height, &art.Year, &art.Description, &art.Sold, &art.CreatedAt, &art.Ordering, &art.ShowInGallery, &art.Price, &art.ForSale, &art.ReservedOrderID, &art.Placeholder, &art.DominantColor, &art.ImageWidth, &art.ImageHeight); err != nil {
 			return nil, err
 		}
 		arts = append(arts, art)
@@ -133,17 +207,30 @@ func (db *DB) GetArts() ([]Art, error) {
 	if err := rows.Err(); err != nil {
 		return nil, err
 	}
+	rows.Close()
 
-	return arts, nil
+	return arts, db.attachArtRenditions(arts)
 }
 
 func (db *DB) GetArtById(id string) (*Art, error) {
-	row := db.QueryRow(`SELECT id, img_url, thumb_url, title, medium, width, height, year, description, sold, created_at, ordering, show_in_gallery FROM arts WHERE id = ?;`, id)
+	row := db.QueryRow(`SELECT id, img_url, thumb_url, title, medium, width, height, year, description, sold, created_at, ordering, show_in_gallery, price, for_sale, reserved_order_id, placeholder, dominant_color, image_width, image_height FROM arts WHERE id = ?;`, id)
 
 	var art Art
-	if err := row.Scan(&art.Id, &art.ImgURL, &art.ThumbURL, &art.Title, &art.Medium, &art.Width, &art.Height, &art.Year, &art.Description, &art.Sold, &art.CreatedAt, &art.Ordering, &art.ShowInGallery); err != nil {
+	if err := row.Scan(&art.Id, &art.ImgURL, &art.ThumbURL, &art.Title, &art.Medium, &art.Width, &art.Height, &art.Year, &art.Description, &art.Sold, &art.CreatedAt, &art.Ordering, &art.ShowInGallery, &art.Price, &art.ForSale, &art.ReservedOrderID, &art.Placeholder, &art.DominantColor, &art.ImageWidth, &art.ImageHeight); err != nil {
+		return nil, err
+	}
+
+	renditions, err := db.GetImageRenditions(art.ImgURL)
+	if err != nil {
 		return nil, err
 	}
+	art.Renditions = renditions
+
+	images, err := db.GetImages(ImageOwnerArt, art.Id)
+	if err != nil {
+		return nil, err
+	}
+	art.Images = images
 
 	return &art, nil
 }
@@ -167,8 +254,44 @@ func (db *DB) UpdateArt(id string, artPatch ArtPatch) error {
 		description = COALESCE(?, description),
 		sold = COALESCE(?, sold),
 		ordering = COALESCE(?, ordering),
-		show_in_gallery = COALESCE(?, show_in_gallery)
+		show_in_gallery = COALESCE(?, show_in_gallery),
+		price = COALESCE(?, price),
+		for_sale = COALESCE(?, for_sale),
+		placeholder = COALESCE(?, placeholder),
+		dominant_color = COALESCE(?, dominant_color),
+		image_width = COALESCE(?, image_width),
+		image_height = COALESCE(?, image_height)
 	WHERE id = ?;
-	`, artPatch.Title, artPatch.Medium, artPatch.Width, artPatch.Height, artPatch.ImgURL, artPatch.ThumbURL, artPatch.Year, artPatch.Description, artPatch.Sold, artPatch.Ordering, artPatch.ShowInGallery, id)
+	`, artPatch.Title, artPatch.Medium, artPatch.Width, artPatch.Height, artPatch.ImgURL, artPatch.ThumbURL, artPatch.Year, artPatch.Description, artPatch.Sold, artPatch.Ordering, artPatch.ShowInGallery, artPatch.Price, artPatch.ForSale, artPatch.Placeholder, artPatch.DominantColor, artPatch.ImageWidth, artPatch.ImageHeight, id)
+	return err
+}
+
+// ReserveArt holds an original for a pending order so nobody else can buy it
+func (db *DB) ReserveArt(id string, orderID string) error {
+	return reserveArt(db, id, orderID)
+}
+
+func reserveArt(ex execer, id string, orderID string) error {
+	result, err := ex.Exec(`
+	UPDATE arts
+	SET reserved_order_id = ?
+	WHERE id = ? AND reserved_order_id = '' AND sold = 0 AND for_sale = 1;
+	`, orderID, id)
+	if err != nil {
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrArtUnavailable
+	}
+	return nil
+}
+
+func (db *DB) MarkArtSold(id string) error {
+	_, err := db.Exec(`UPDATE arts SET sold = 1, for_sale = 0 WHERE id = ?;`, id)
 	return err
 }
@@ -0,0 +1,79 @@
+package db
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"time"
+)
+
+// CheckoutKeyWindow is how long a resubmitted checkout returns the order it
+// already created instead of placing a new one
+const CheckoutKeyWindow = 24 * time.Hour
+
+var ErrCheckoutKeyUsed = errors.New("checkout key has already been used")
+
+func (db *DB) createCheckoutKeysTable() error {
+	_, err := db.Exec(`
+	CREATE TABLE IF NOT EXISTS checkout_keys (
+		key TEXT PRIMARY KEY,
+		order_id TEXT NOT NULL,
+		created_at TEXT NOT NULL
+	);
+	`)
+	return err
+}
+
+// NewCheckoutKey generates the idempotency key sent with the checkout form
+func NewCheckoutKey() (string, error) {
+	bytes := make([]byte, 16)
+	if _, err := rand.Read(bytes); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(bytes), nil
+}
+
+// GetOrderIDForCheckoutKey returns the order placed with the key within the
+// window, or "" when the key has not been used
+func (db *DB) GetOrderIDForCheckoutKey(key string) (string, error) {
+	if key == "" {
+		return "", nil
+	}
+
+	var orderID string
+	err := db.QueryRow(`
+	SELECT order_id FROM checkout_keys WHERE key = ? AND created_at >= ?;
+	`, key, time.Now().Add(-CheckoutKeyWindow).Format(time.RFC3339)).Scan(&orderID)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	return orderID, err
+}
+
+// claimCheckoutKey ties the key to the order, failing with ErrCheckoutKeyUsed when
+// another order got it first. Keys older than the window are cleared out on the way.
+func claimCheckoutKey(ex execer, key string, orderID string) error {
+	now := time.Now()
+	if _, err := ex.Exec(`DELETE FROM checkout_keys WHERE created_at < ?;`, now.Add(-CheckoutKeyWindow).Format(time.RFC3339)); err != nil {
+		return err
+	}
+
+	result, err := ex.Exec(`
+	INSERT INTO checkout_keys (key, order_id, created_at)
+	VALUES (?, ?, ?)
+	ON CONFLICT(key) DO NOTHING;
+	`, key, orderID, now.Format(time.RFC3339))
+	if err != nil {
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrCheckoutKeyUsed
+	}
+	return nil
+}
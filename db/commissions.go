@@ -0,0 +1,315 @@
+package db
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type CommissionStatus string
+
+const (
+	CommissionStatusNew        CommissionStatus = "NEW"
+	CommissionStatusQuoted     CommissionStatus = "QUOTED"
+	CommissionStatusAccepted   CommissionStatus = "ACCEPTED"
+	CommissionStatusInProgress CommissionStatus = "IN_PROGRESS"
+	CommissionStatusDelivered  CommissionStatus = "DELIVERED"
+)
+
+// CommissionStatuses is the pipeline in order
+var CommissionStatuses = []CommissionStatus{
+	CommissionStatusNew,
+	CommissionStatusQuoted,
+	CommissionStatusAccepted,
+	CommissionStatusInProgress,
+	CommissionStatusDelivered,
+}
+
+var (
+	ErrCommissionNotQuotable = errors.New("commission has already been accepted")
+	ErrCommissionNotQuoted   = errors.New("commission has no open quote")
+)
+
+// Commission is a request for a new artwork. The token is the requester's link to
+// the quote, OrderID is the deposit order created when the quote is accepted.
+type Commission struct {
+	UUID        string
+	Name        string
+	Email       string
+	Subject     string
+	Size        string
+	Budget      float64
+	Deadline    string
+	Description string
+	Status      CommissionStatus
+	Token       string
+	CreatedAt   string
+
+	QuoteAmount   float64
+	DepositAmount float64
+	QuoteNote     string
+	QuotedAt      string
+	OrderID       string
+
+	References []CommissionReference
+}
+
+// CommissionReference is an image uploaded with the request
+type CommissionReference struct {
+	UUID         string
+	CommissionID string
+	ImgURL       string
+	ThumbURL     string
+}
+
+func (db *DB) createCommissionTables() error {
+	_, err := db.Exec(`
+	CREATE TABLE IF NOT EXISTS commissions (
+		uuid TEXT PRIMARY KEY,
+		name TEXT NOT NULL,
+		email TEXT NOT NULL,
+		subject TEXT NOT NULL,
+		size TEXT NOT NULL DEFAULT '',
+		budget REAL NOT NULL DEFAULT 0,
+		deadline TEXT NOT NULL DEFAULT '',
+		description TEXT NOT NULL DEFAULT '',
+		status TEXT NOT NULL,
+		token TEXT NOT NULL UNIQUE,
+		created_at TEXT NOT NULL,
+		quote_amount REAL NOT NULL DEFAULT 0,
+		deposit_amount REAL NOT NULL DEFAULT 0,
+		quote_note TEXT NOT NULL DEFAULT '',
+		quoted_at TEXT NOT NULL DEFAULT '',
+		order_id TEXT NOT NULL DEFAULT ''
+	);
+
+	CREATE TABLE IF NOT EXISTS commission_references (
+		uuid TEXT PRIMARY KEY,
+		commission_id TEXT NOT NULL,
+		img_url TEXT NOT NULL,
+		thumb_url TEXT NOT NULL
+	);
+	`)
+	return err
+}
+
+func newCommissionToken() (string, error) {
+	bytes := make([]byte, 16)
+	if _, err := rand.Read(bytes); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(bytes), nil
+}
+
+// AddCommission stores a new request together with its reference images
+func (db *DB) AddCommission(commission Commission) (Commission, error) {
+	token, err := newCommissionToken()
+	if err != nil {
+		return Commission{}, err
+	}
+	commission.UUID = uuid.NewString()
+	commission.Token = token
+	commission.Status = CommissionStatusNew
+	commission.CreatedAt = time.Now().Format(time.RFC3339)
+
+	tx, err := db.Begin()
+	if err != nil {
+		return Commission{}, err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`
+	INSERT INTO commissions (uuid, name, email, subject, size, budget, deadline, description, status, token, created_at)
+	VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?);
+	`, commission.UUID, commission.Name, commission.Email, commission.Subject, commission.Size, commission.Budget,
+		commission.Deadline, commission.Description, commission.Status, commission.Token, commission.CreatedAt)
+	if err != nil {
+		return Commission{}, err
+	}
+
+	for i := range commission.References {
+		reference := &commission.References[i]
+		reference.UUID = uuid.NewString()
+		reference.CommissionID = commission.UUID
+		_, err := tx.Exec(`
+		INSERT INTO commission_references (uuid, commission_id, img_url, thumb_url)
+		VALUES (?, ?, ?, ?);
+		`, reference.UUID, reference.CommissionID, reference.ImgURL, reference.ThumbURL)
+		if err != nil {
+			return Commission{}, err
+		}
+	}
+
+	return commission, tx.Commit()
+}
+
+const commissionColumns = `uuid, name, email, subject, size, budget, deadline, description, status, token, created_at,
+	quote_amount, deposit_amount, quote_note, quoted_at, order_id`
+
+func scanCommission(scan func(dest ...any) error) (Commission, error) {
+	var commission Commission
+	err := scan(&commission.UUID, &commission.Name, &commission.Email, &commission.Subject, &commission.Size, &commission.Budget,
+		&commission.Deadline, &commission.Description, &commission.Status, &commission.Token, &commission.CreatedAt,
+		&commission.QuoteAmount, &commission.DepositAmount, &commission.QuoteNote, &commission.QuotedAt, &commission.OrderID)
+	return commission, err
+}
+
+func (db *DB) GetCommission(id string) (Commission, error) {
+	commission, err := scanCommission(db.QueryRow(`SELECT `+commissionColumns+` FROM commissions WHERE uuid = ?;`, id).Scan)
+	if err != nil {
+		return Commission{}, err
+	}
+	commission.References, err = db.getCommissionReferences(commission.UUID)
+	return commission, err
+}
+
+func (db *DB) GetCommissionByToken(token string) (Commission, error) {
+	commission, err := scanCommission(db.QueryRow(`SELECT `+commissionColumns+` FROM commissions WHERE token = ?;`, token).Scan)
+	if err != nil {
+		return Commission{}, err
+	}
+	commission.References, err = db.getCommissionReferences(commission.UUID)
+	return commission, err
+}
+
+// GetCommissions returns all requests, newest first
+func (db *DB) GetCommissions() ([]Commission, error) {
+	rows, err := db.Query(`SELECT ` + commissionColumns + ` FROM commissions ORDER BY created_at DESC;`)
+	if err != nil {
+		return nil, err
+	}
+
+	var commissions []Commission
+	for rows.Next() {
+		commission, err := scanCommission(rows.Scan)
+		if err != nil {
+			rows.Close()
+			return nil, err
+		}
+		commissions = append(commissions, commission)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	// the references are loaded after the rows are closed, there is only one connection
+	for i := range commissions {
+		commissions[i].References, err = db.getCommissionReferences(commissions[i].UUID)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return commissions, nil
+}
+
+func (db *DB) getCommissionReferences(commissionID string) ([]CommissionReference, error) {
+	rows, err := db.Query(`
+	SELECT uuid, commission_id, img_url, thumb_url
+	FROM commission_references WHERE commission_id = ?
+	ORDER BY rowid;
+	`, commissionID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var references []CommissionReference
+	for rows.Next() {
+		var reference CommissionReference
+		if err := rows.Scan(&reference.UUID, &reference.CommissionID, &reference.ImgURL, &reference.ThumbURL); err != nil {
+			return nil, err
+		}
+		references = append(references, reference)
+	}
+	return references, rows.Err()
+}
+
+func (db *DB) SetCommissionStatus(id string, status CommissionStatus) error {
+	result, err := db.Exec(`UPDATE commissions SET status = ? WHERE uuid = ?;`, status, id)
+	if err != nil {
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// QuoteCommission stores the quote. A quote can be changed until it is accepted.
+func (db *DB) QuoteCommission(id string, amount float64, deposit float64, note string) error {
+	result, err := db.Exec(`
+	UPDATE commissions
+	SET status = ?, quote_amount = ?, deposit_amount = ?, quote_note = ?, quoted_at = ?
+	WHERE uuid = ? AND status IN (?, ?);
+	`, CommissionStatusQuoted, amount, deposit, note, time.Now().Format(time.RFC3339),
+		id, CommissionStatusNew, CommissionStatusQuoted)
+	if err != nil {
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrCommissionNotQuotable
+	}
+	return nil
+}
+
+// AcceptCommissionQuote accepts the open quote and places the deposit order in one
+// transaction. It fails if the deposit was changed after the row was priced.
+func (db *DB) AcceptCommissionQuote(token string, row OrderRow, details OrderDetails) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(`
+	UPDATE commissions SET status = ?, order_id = ?
+	WHERE token = ? AND status = ? AND deposit_amount = ?;
+	`, CommissionStatusAccepted, details.OrderID, token, CommissionStatusQuoted, row.Price)
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrCommissionNotQuoted
+	}
+
+	if err := addOrderRow(tx, row); err != nil {
+		return err
+	}
+	if err := addOrderDetails(tx, details); err != nil {
+		return err
+	}
+	if err := addOrderEvent(tx, details.OrderID, OrderEventPlaced, ""); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// StartCommissionForOrder moves an accepted commission into progress once its
+// deposit order is paid
+func (db *DB) StartCommissionForOrder(orderID string) error {
+	_, err := db.Exec(`
+	UPDATE commissions SET status = ? WHERE order_id = ? AND status = ?;
+	`, CommissionStatusInProgress, orderID, CommissionStatusAccepted)
+	return err
+}
@@ -2,6 +2,7 @@ package db
 
 import (
 	"database/sql"
+	"fmt"
 
 	_ "modernc.org/sqlite"
 )
@@ -10,6 +11,13 @@ type DB struct {
 	*sql.DB
 }
 
+// execer is what *DB and *sql.Tx have in common, so writes can run on their own
+// or as part of a transaction
+type execer interface {
+	Exec(query string, args ...any) (sql.Result, error)
+	QueryRow(query string, args ...any) *sql.Row
+}
+
 func New(dataSourceName string) (*DB, error) {
 	db, err := sql.Open("sqlite", dataSourceName)
 	if err != nil {
@@ -52,9 +60,75 @@ func (db *DB) createTables() error {
 	if err := db.createPrintTable(); err != nil {
 		return err
 	}
+	if err := db.createPrintVariantsTable(); err != nil {
+		return err
+	}
+	if err := db.createPrintWaitlistTable(); err != nil {
+		return err
+	}
 	if err := db.createOrdersTable(); err != nil {
 		return err
 	}
+	if err := db.createDiscountCodesTable(); err != nil {
+		return err
+	}
+	if err := db.createGiftCardTables(); err != nil {
+		return err
+	}
+	if err := db.createCheckoutKeysTable(); err != nil {
+		return err
+	}
+	if err := db.createSubscribersTable(); err != nil {
+		return err
+	}
+	if err := db.createInquiriesTable(); err != nil {
+		return err
+	}
+	if err := db.createCommissionTables(); err != nil {
+		return err
+	}
+	if err := db.createNewsletterTables(); err != nil {
+		return err
+	}
+	if err := db.createImageRenditionsTable(); err != nil {
+		return err
+	}
+	if err := db.createImagesTable(); err != nil {
+		return err
+	}
 
 	return nil
 }
+
+// ensureColumn adds a column to a table created by an earlier version of the schema
+func (db *DB) ensureColumn(table, column, definition string) error {
+	rows, err := db.Query(fmt.Sprintf("PRAGMA table_info(%s);", table))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			cid       int
+			name      string
+			typ       string
+			notNull   bool
+			dfltValue sql.NullString
+			pk        int
+		)
+		if err := rows.Scan(&cid, &name, &typ, &notNull, &dfltValue, &pk); err != nil {
+			return err
+		}
+		if name == column {
+			return nil
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	rows.Close()
+
+	_, err = db.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s;", table, column, definition))
+	return err
+}
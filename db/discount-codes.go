@@ -0,0 +1,133 @@
+package db
+
+import (
+	"errors"
+	"strings"
+	"time"
+)
+
+type DiscountKind string
+
+const (
+	DiscountKindPercent DiscountKind = "PERCENT"
+	DiscountKindFixed   DiscountKind = "FIXED"
+)
+
+var ErrDiscountCodeExhausted = errors.New("discount code has no uses left")
+
+type DiscountCode struct {
+	Code      string
+	Kind      DiscountKind
+	Amount    float64
+	ValidFrom string
+	ValidTo   string
+	MaxUses   int
+	UsedCount int
+	PrintIDs  []string
+	Active    bool
+	CreatedAt string
+}
+
+func (db *DB) createDiscountCodesTable() error {
+	_, err := db.Exec(`
+	CREATE TABLE IF NOT EXISTS discount_codes (
+		code TEXT PRIMARY KEY,
+		kind TEXT NOT NULL,
+		amount REAL NOT NULL,
+		valid_from TEXT NOT NULL DEFAULT '',
+		valid_to TEXT NOT NULL DEFAULT '',
+		max_uses INTEGER NOT NULL DEFAULT 0,
+		used_count INTEGER NOT NULL DEFAULT 0,
+		print_ids TEXT NOT NULL DEFAULT '',
+		active BOOLEAN NOT NULL DEFAULT 1,
+		created_at TEXT NOT NULL
+	);
+	`)
+	return err
+}
+
+func NormalizeDiscountCode(code string) string {
+	return strings.ToUpper(strings.TrimSpace(code))
+}
+
+func (db *DB) AddDiscountCode(code DiscountCode) error {
+	code.Code = NormalizeDiscountCode(code.Code)
+	code.CreatedAt = time.Now().Format(time.RFC3339)
+
+	_, err := db.Exec(`
+	INSERT INTO discount_codes (code, kind, amount, valid_from, valid_to, max_uses, used_count, print_ids, active, created_at)
+	VALUES (?, ?, ?, ?, ?, ?, 0, ?, ?, ?);
+	`, code.Code, code.Kind, code.Amount, code.ValidFrom, code.ValidTo, code.MaxUses, strings.Join(code.PrintIDs, ","), code.Active, code.CreatedAt)
+	return err
+}
+
+func scanDiscountCode(scan func(dest ...any) error) (DiscountCode, error) {
+	var code DiscountCode
+	var printIDs string
+	err := scan(&code.Code, &code.Kind, &code.Amount, &code.ValidFrom, &code.ValidTo, &code.MaxUses, &code.UsedCount, &printIDs, &code.Active, &code.CreatedAt)
+	if printIDs != "" {
+		code.PrintIDs = strings.Split(printIDs, ",")
+	}
+	return code, err
+}
+
+func (db *DB) GetDiscountCode(code string) (*DiscountCode, error) {
+	row := db.QueryRow(`SELECT code, kind, amount, valid_from, valid_to, max_uses, used_count, print_ids, active, created_at FROM discount_codes WHERE code = ?;`, NormalizeDiscountCode(code))
+	discountCode, err := scanDiscountCode(row.Scan)
+	if err != nil {
+		return nil, err
+	}
+	return &discountCode, nil
+}
+
+func (db *DB) GetDiscountCodes() ([]DiscountCode, error) {
+	rows, err := db.Query(`SELECT code, kind, amount, valid_from, valid_to, max_uses, used_count, print_ids, active, created_at FROM discount_codes ORDER BY created_at DESC;`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var codes []DiscountCode
+	for rows.Next() {
+		code, err := scanDiscountCode(rows.Scan)
+		if err != nil {
+			return nil, err
+		}
+		codes = append(codes, code)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return codes, nil
+}
+
+func (db *DB) SetDiscountCodeActive(code string, active bool) error {
+	_, err := db.Exec(`UPDATE discount_codes SET active = ? WHERE code = ?;`, active, NormalizeDiscountCode(code))
+	return err
+}
+
+// UseDiscountCode counts one use of the code, failing when the usage limit is reached
+func (db *DB) UseDiscountCode(code string) error {
+	return useDiscountCode(db, code)
+}
+
+func useDiscountCode(ex execer, code string) error {
+	result, err := ex.Exec(`
+	UPDATE discount_codes
+	SET used_count = used_count + 1
+	WHERE code = ? AND (max_uses = 0 OR used_count < max_uses);
+	`, NormalizeDiscountCode(code))
+	if err != nil {
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrDiscountCodeExhausted
+	}
+	return nil
+}
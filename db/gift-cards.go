@@ -0,0 +1,268 @@
+package db
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"errors"
+	"math/big"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+var (
+	ErrGiftCardVoided       = errors.New("gift card is voided")
+	ErrGiftCardInsufficient = errors.New("gift card balance is too low")
+)
+
+type GiftCard struct {
+	Code          string
+	InitialAmount float64
+	Balance       float64
+	Email         string
+	OrderRowID    string
+	Voided        bool
+	CreatedAt     string
+}
+
+type GiftCardLedgerEntry struct {
+	UUID      string
+	Code      string
+	Amount    float64
+	OrderID   string
+	Note      string
+	CreatedAt string
+}
+
+func (db *DB) createGiftCardTables() error {
+	_, err := db.Exec(`
+	CREATE TABLE IF NOT EXISTS gift_cards (
+		code TEXT PRIMARY KEY,
+		initial_amount REAL NOT NULL,
+		email TEXT NOT NULL DEFAULT '',
+		order_row_id TEXT NOT NULL DEFAULT '',
+		voided BOOLEAN NOT NULL DEFAULT 0,
+		created_at TEXT NOT NULL
+	);
+	`)
+	if err != nil {
+		return err
+	}
+
+	_, err = db.Exec(`
+	CREATE TABLE IF NOT EXISTS gift_card_ledger (
+		uuid TEXT PRIMARY KEY,
+		code TEXT NOT NULL,
+		amount REAL NOT NULL,
+		order_id TEXT NOT NULL DEFAULT '',
+		note TEXT NOT NULL DEFAULT '',
+		created_at TEXT NOT NULL
+	);
+	`)
+	return err
+}
+
+const giftCardAlphabet = "ABCDEFGHJKLMNPQRSTUVWXYZ23456789"
+
+// newGiftCardCode generates a code like EJ-7KQ2-M9XD, avoiding look-alike characters
+func newGiftCardCode() (string, error) {
+	var builder strings.Builder
+	builder.WriteString("EJ")
+	for i := 0; i < 8; i++ {
+		if i%4 == 0 {
+			builder.WriteString("-")
+		}
+		n, err := rand.Int(rand.Reader, big.NewInt(int64(len(giftCardAlphabet))))
+		if err != nil {
+			return "", err
+		}
+		builder.WriteByte(giftCardAlphabet[n.Int64()])
+	}
+	return builder.String(), nil
+}
+
+func NormalizeGiftCardCode(code string) string {
+	return strings.ToUpper(strings.TrimSpace(code))
+}
+
+// AddGiftCard issues a new card with a generated code and credits its initial amount
+func (db *DB) AddGiftCard(card GiftCard) (GiftCard, error) {
+	code, err := newGiftCardCode()
+	if err != nil {
+		return GiftCard{}, err
+	}
+	card.Code = code
+	card.Balance = card.InitialAmount
+	card.CreatedAt = time.Now().Format(time.RFC3339)
+
+	tx, err := db.Begin()
+	if err != nil {
+		return GiftCard{}, err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`
+	INSERT INTO gift_cards (code, initial_amount, email, order_row_id, voided, created_at)
+	VALUES (?, ?, ?, ?, 0, ?);
+	`, card.Code, card.InitialAmount, card.Email, card.OrderRowID, card.CreatedAt)
+	if err != nil {
+		return GiftCard{}, err
+	}
+
+	_, err = tx.Exec(`
+	INSERT INTO gift_card_ledger (uuid, code, amount, order_id, note, created_at)
+	VALUES (?, ?, ?, '', 'Issued', ?);
+	`, uuid.NewString(), card.Code, card.InitialAmount, card.CreatedAt)
+	if err != nil {
+		return GiftCard{}, err
+	}
+
+	return card, tx.Commit()
+}
+
+const giftCardSelect = `
+	SELECT
+		gift_cards.code,
+		gift_cards.initial_amount,
+		COALESCE((SELECT SUM(amount) FROM gift_card_ledger WHERE gift_card_ledger.code = gift_cards.code), 0),
+		gift_cards.email,
+		gift_cards.order_row_id,
+		gift_cards.voided,
+		gift_cards.created_at
+	FROM gift_cards`
+
+func (db *DB) GetGiftCard(code string) (*GiftCard, error) {
+	row := db.QueryRow(giftCardSelect+` WHERE gift_cards.code = ?;`, NormalizeGiftCardCode(code))
+
+	var card GiftCard
+	if err := row.Scan(&card.Code, &card.InitialAmount, &card.Balance, &card.Email, &card.OrderRowID, &card.Voided, &card.CreatedAt); err != nil {
+		return nil, err
+	}
+	return &card, nil
+}
+
+func (db *DB) GetGiftCards() ([]GiftCard, error) {
+	rows, err := db.Query(giftCardSelect + ` ORDER BY gift_cards.created_at DESC;`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var cards []GiftCard
+	for rows.Next() {
+		var card GiftCard
+		if err := rows.Scan(&card.Code, &card.InitialAmount, &card.Balance, &card.Email, &card.OrderRowID, &card.Voided, &card.CreatedAt); err != nil {
+			return nil, err
+		}
+		cards = append(cards, card)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return cards, nil
+}
+
+func (db *DB) GetGiftCardsForOrderRow(orderRowID string) ([]GiftCard, error) {
+	rows, err := db.Query(`SELECT code FROM gift_cards WHERE order_row_id = ?;`, orderRowID)
+	if err != nil {
+		return nil, err
+	}
+
+	var codes []string
+	for rows.Next() {
+		var code string
+		if err := rows.Scan(&code); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		codes = append(codes, code)
+	}
+	rows.Close()
+
+	var cards []GiftCard
+	for _, code := range codes {
+		card, err := db.GetGiftCard(code)
+		if err != nil {
+			return nil, err
+		}
+		cards = append(cards, *card)
+	}
+	return cards, nil
+}
+
+func (db *DB) VoidGiftCard(code string) error {
+	_, err := db.Exec(`UPDATE gift_cards SET voided = 1 WHERE code = ?;`, NormalizeGiftCardCode(code))
+	return err
+}
+
+func (db *DB) GetGiftCardLedger(code string) ([]GiftCardLedgerEntry, error) {
+	rows, err := db.Query(`
+	SELECT uuid, code, amount, order_id, note, created_at
+	FROM gift_card_ledger
+	WHERE code = ?
+	ORDER BY created_at ASC;
+	`, NormalizeGiftCardCode(code))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var entries []GiftCardLedgerEntry
+	for rows.Next() {
+		var entry GiftCardLedgerEntry
+		if err := rows.Scan(&entry.UUID, &entry.Code, &entry.Amount, &entry.OrderID, &entry.Note, &entry.CreatedAt); err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return entries, nil
+}
+
+// RedeemGiftCard debits amount from the card for an order, allowing partial use of the balance
+func (db *DB) RedeemGiftCard(code string, amount float64, orderID string) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := redeemGiftCard(tx, code, amount, orderID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// redeemGiftCard must run in a transaction so the balance can't change between the check and the debit
+func redeemGiftCard(tx *sql.Tx, code string, amount float64, orderID string) error {
+	code = NormalizeGiftCardCode(code)
+
+	var voided bool
+	var balance float64
+	err := tx.QueryRow(`
+	SELECT voided, COALESCE((SELECT SUM(amount) FROM gift_card_ledger WHERE code = ?), 0)
+	FROM gift_cards
+	WHERE code = ?;
+	`, code, code).Scan(&voided, &balance)
+	if err != nil {
+		return err
+	}
+
+	if voided {
+		return ErrGiftCardVoided
+	}
+	if balance < amount {
+		return ErrGiftCardInsufficient
+	}
+
+	_, err = tx.Exec(`
+	INSERT INTO gift_card_ledger (uuid, code, amount, order_id, note, created_at)
+	VALUES (?, ?, ?, ?, 'Redeemed', ?);
+	`, uuid.NewString(), code, -amount, orderID, time.Now().Format(time.RFC3339))
+	return err
+}
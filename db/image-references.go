@@ -0,0 +1,104 @@
+package db
+
+// ImageReferences is everything that can point at an uploaded image
+type ImageReferences struct {
+	// URLs are the art, print and commission reference images and thumbs, the extra
+	// images of art and prints, and the renditions of all of them
+	URLs []string
+	// Texts are stored texts and newsletters, which can link to uploads
+	Texts []string
+}
+
+// GetImageReferences collects the references the image garbage collection keeps
+// blobs for
+func (db *DB) GetImageReferences() (ImageReferences, error) {
+	var references ImageReferences
+
+	urls, err := db.queryStrings(`
+	WITH referenced (url) AS (
+		SELECT img_url FROM arts
+		UNION SELECT thumb_url FROM arts
+		UNION SELECT img_url FROM prints
+		UNION SELECT thumb_url FROM prints
+		UNION SELECT img_url FROM commission_references
+		UNION SELECT thumb_url FROM commission_references
+		UNION SELECT url FROM images
+		UNION SELECT thumb_url FROM images
+	)
+	SELECT url FROM referenced WHERE url != ''
+	UNION
+	SELECT url FROM image_renditions WHERE image_url IN (SELECT url FROM referenced);
+	`)
+	if err != nil {
+		return references, err
+	}
+	references.URLs = urls
+
+	texts, err := db.queryStrings(`
+	SELECT content FROM stored_texts
+	UNION ALL
+	SELECT body FROM newsletters;
+	`)
+	if err != nil {
+		return references, err
+	}
+	references.Texts = texts
+
+	return references, nil
+}
+
+// GetOriginalImageURLs returns the URLs of the full size images of art, prints,
+// commission references and the extra images, without their thumbs
+func (db *DB) GetOriginalImageURLs() ([]string, error) {
+	return db.queryStrings(`
+	SELECT img_url FROM arts WHERE img_url != ''
+	UNION SELECT img_url FROM prints WHERE img_url != ''
+	UNION SELECT img_url FROM commission_references WHERE img_url != ''
+	UNION SELECT url FROM images WHERE url != '';
+	`)
+}
+
+// ReplaceImageURL points everything that refers to the image at from at to instead,
+// for images that have been moved
+func (db *DB) ReplaceImageURL(from, to string) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, query := range []string{
+		`UPDATE arts SET img_url = ? WHERE img_url = ?;`,
+		`UPDATE arts SET thumb_url = ? WHERE thumb_url = ?;`,
+		`UPDATE prints SET img_url = ? WHERE img_url = ?;`,
+		`UPDATE prints SET thumb_url = ? WHERE thumb_url = ?;`,
+		`UPDATE commission_references SET img_url = ? WHERE img_url = ?;`,
+		`UPDATE commission_references SET thumb_url = ? WHERE thumb_url = ?;`,
+		`UPDATE images SET url = ? WHERE url = ?;`,
+		`UPDATE images SET thumb_url = ? WHERE thumb_url = ?;`,
+		`UPDATE image_renditions SET image_url = ? WHERE image_url = ?;`,
+	} {
+		if _, err := tx.Exec(query, to, from); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func (db *DB) queryStrings(query string, args ...any) ([]string, error) {
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var values []string
+	for rows.Next() {
+		var value string
+		if err := rows.Scan(&value); err != nil {
+			return nil, err
+		}
+		values = append(values, value)
+	}
+	return values, rows.Err()
+}
@@ -0,0 +1,145 @@
+package db
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ImageRendition is a resized copy of an uploaded image. ImageURL is the URL of the
+// original as stored on the art or print.
+type ImageRendition struct {
+	UUID      string
+	ImageURL  string
+	Width     int
+	Height    int
+	Format    string
+	URL       string
+	Size      int64
+	CreatedAt string
+}
+
+func (db *DB) createImageRenditionsTable() error {
+	_, err := db.Exec(`
+	CREATE TABLE IF NOT EXISTS image_renditions (
+		uuid TEXT PRIMARY KEY,
+		image_url TEXT NOT NULL,
+		width INTEGER NOT NULL,
+		height INTEGER NOT NULL,
+		format TEXT NOT NULL,
+		url TEXT NOT NULL,
+		size INTEGER NOT NULL DEFAULT 0,
+		created_at TEXT NOT NULL,
+		UNIQUE (image_url, width, format)
+	);
+
+	CREATE INDEX IF NOT EXISTS image_renditions_image_url ON image_renditions (image_url);
+	`)
+	return err
+}
+
+// AddImageRenditions stores the renditions, replacing earlier ones of the same size and format
+func (db *DB) AddImageRenditions(renditions []ImageRendition) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	createdAt := time.Now().Format(time.RFC3339)
+	for _, rendition := range renditions {
+		_, err := tx.Exec(`
+		INSERT INTO image_renditions (uuid, image_url, width, height, format, url, size, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT (image_url, width, format) DO UPDATE SET
+			height = excluded.height,
+			url = excluded.url,
+			size = excluded.size,
+			created_at = excluded.created_at;
+		`, uuid.NewString(), rendition.ImageURL, rendition.Width, rendition.Height, rendition.Format, rendition.URL, rendition.Size, createdAt)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// GetImageRenditions returns the renditions of one image, smallest first
+func (db *DB) GetImageRenditions(imageURL string) ([]ImageRendition, error) {
+	renditions, err := db.queryImageRenditions(`
+	SELECT uuid, image_url, width, height, format, url, size, created_at
+	FROM image_renditions WHERE image_url = ?
+	ORDER BY width, format;
+	`, imageURL)
+	return renditions[imageURL], err
+}
+
+// GetAllImageRenditions returns the renditions of every image, by image URL
+func (db *DB) GetAllImageRenditions() (map[string][]ImageRendition, error) {
+	return db.queryImageRenditions(`
+	SELECT uuid, image_url, width, height, format, url, size, created_at
+	FROM image_renditions
+	ORDER BY image_url, width, format;
+	`)
+}
+
+func (db *DB) queryImageRenditions(query string, args ...any) (map[string][]ImageRendition, error) {
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	renditions := map[string][]ImageRendition{}
+	for rows.Next() {
+		var rendition ImageRendition
+		if err := rows.Scan(&rendition.UUID, &rendition.ImageURL, &rendition.Width, &rendition.Height, &rendition.Format, &rendition.URL, &rendition.Size, &rendition.CreatedAt); err != nil {
+			return nil, err
+		}
+		renditions[rendition.ImageURL] = append(renditions[rendition.ImageURL], rendition)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return renditions, nil
+}
+
+func (db *DB) attachArtRenditions(arts []Art) error {
+	renditions, err := db.GetAllImageRenditions()
+	if err != nil {
+		return err
+	}
+	for i := range arts {
+		arts[i].Renditions = renditions[arts[i].ImgURL]
+	}
+	return nil
+}
+
+func (db *DB) attachPrintRenditions(prints []Print) error {
+	renditions, err := db.GetAllImageRenditions()
+	if err != nil {
+		return err
+	}
+	for i := range prints {
+		prints[i].Renditions = renditions[prints[i].ImgURL]
+	}
+	return nil
+}
+
+// DeleteImageRenditionsByURL forgets renditions whose files have been deleted
+func (db *DB) DeleteImageRenditionsByURL(urls []string) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, url := range urls {
+		if _, err := tx.Exec(`DELETE FROM image_renditions WHERE url = ?;`, url); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
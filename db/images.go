@@ -0,0 +1,170 @@
+package db
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ImageOwner is the kind of thing an image in the images table belongs to
+type ImageOwner string
+
+const (
+	ImageOwnerArt   ImageOwner = "art"
+	ImageOwnerPrint ImageOwner = "print"
+)
+
+// Image is one of the ordered images of an art or print, like a detail shot or the
+// work hanging in a room. The cover is also on the art or print as ImgURL.
+type Image struct {
+	UUID      string
+	OwnerType ImageOwner
+	OwnerID   string
+	URL       string
+	ThumbURL  string
+	Position  int
+	// Placeholder, DominantColor, Width and Height are as on Art
+	Placeholder   string
+	DominantColor string
+	Width         int
+	Height        int
+	CreatedAt     string
+
+	Renditions []ImageRendition
+}
+
+func (db *DB) createImagesTable() error {
+	_, err := db.Exec(`
+	CREATE TABLE IF NOT EXISTS images (
+		uuid TEXT PRIMARY KEY,
+		owner_type TEXT NOT NULL,
+		owner_id TEXT NOT NULL,
+		url TEXT NOT NULL,
+		thumb_url TEXT NOT NULL DEFAULT '',
+		position INTEGER NOT NULL DEFAULT 0,
+		placeholder TEXT NOT NULL DEFAULT '',
+		dominant_color TEXT NOT NULL DEFAULT '',
+		width INTEGER NOT NULL DEFAULT 0,
+		height INTEGER NOT NULL DEFAULT 0,
+		created_at TEXT NOT NULL
+	);
+
+	CREATE INDEX IF NOT EXISTS images_owner ON images (owner_type, owner_id, position);
+	`)
+	return err
+}
+
+// SetImages replaces the images of an art or print, in the given order
+func (db *DB) SetImages(ownerType ImageOwner, ownerID string, images []Image) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`DELETE FROM images WHERE owner_type = ? AND owner_id = ?;`, ownerType, ownerID); err != nil {
+		return err
+	}
+
+	createdAt := time.Now().Format(time.RFC3339)
+	for position, image := range images {
+		_, err := tx.Exec(`
+		INSERT INTO images (uuid, owner_type, owner_id, url, thumb_url, position, placeholder, dominant_color, width, height, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?);
+		`, uuid.NewString(), ownerType, ownerID, image.URL, image.ThumbURL, position, image.Placeholder, image.DominantColor, image.Width, image.Height, createdAt)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// GetImages returns the images of an art or print in order, with their renditions
+func (db *DB) GetImages(ownerType ImageOwner, ownerID string) ([]Image, error) {
+	images, err := db.queryImages(`
+	SELECT uuid, owner_type, owner_id, url, thumb_url, position, placeholder, dominant_color, width, height, created_at
+	FROM images WHERE owner_type = ? AND owner_id = ?
+	ORDER BY position;
+	`, ownerType, ownerID)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range images {
+		renditions, err := db.GetImageRenditions(images[i].URL)
+		if err != nil {
+			return nil, err
+		}
+		images[i].Renditions = renditions
+	}
+	return images, nil
+}
+
+// GetAllImages returns every image of every art and print, without renditions
+func (db *DB) GetAllImages() ([]Image, error) {
+	return db.queryImages(`
+	SELECT uuid, owner_type, owner_id, url, thumb_url, position, placeholder, dominant_color, width, height, created_at
+	FROM images
+	ORDER BY owner_type, owner_id, position;
+	`)
+}
+
+// DeleteImages forgets the images of a deleted art or print. The files are left
+// for the image garbage collection.
+func (db *DB) DeleteImages(ownerType ImageOwner, ownerID string) error {
+	_, err := db.Exec(`DELETE FROM images WHERE owner_type = ? AND owner_id = ?;`, ownerType, ownerID)
+	return err
+}
+
+func (db *DB) queryImages(query string, args ...any) ([]Image, error) {
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var images []Image
+	for rows.Next() {
+		var image Image
+		if err := rows.Scan(&image.UUID, &image.OwnerType, &image.OwnerID, &image.URL, &image.ThumbURL, &image.Position, &image.Placeholder, &image.DominantColor, &image.Width, &image.Height, &image.CreatedAt); err != nil {
+			return nil, err
+		}
+		images = append(images, image)
+	}
+	return images, rows.Err()
+}
+
+// AllImages are the art's images, or just its cover when it was saved before art
+// could have more than one
+func (art Art) AllImages() []Image {
+	if len(art.Images) > 0 || art.ImgURL == "" {
+		return art.Images
+	}
+	return []Image{{
+		OwnerType:     ImageOwnerArt,
+		OwnerID:       art.Id,
+		URL:           art.ImgURL,
+		ThumbURL:      art.ThumbURL,
+		Placeholder:   art.Placeholder,
+		DominantColor: art.DominantColor,
+		Width:         art.ImageWidth,
+		Height:        art.ImageHeight,
+		Renditions:    art.Renditions,
+	}}
+}
+
+// AllImages are the print's images, or just its cover when it was saved before
+// prints could have more than one
+func (print Print) AllImages() []Image {
+	if len(print.Images) > 0 || print.ImgURL == "" {
+		return print.Images
+	}
+	return []Image{{
+		OwnerType:  ImageOwnerPrint,
+		OwnerID:    print.Id,
+		URL:        print.ImgURL,
+		ThumbURL:   print.ThumbURL,
+		Renditions: print.Renditions,
+	}}
+}
@@ -0,0 +1,185 @@
+package db
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type InquiryStatus string
+
+const (
+	InquiryStatusNew       InquiryStatus = "NEW"
+	InquiryStatusAnswered  InquiryStatus = "ANSWERED"
+	InquiryStatusConverted InquiryStatus = "CONVERTED"
+)
+
+var ErrInquiryConverted = errors.New("inquiry has already been converted to an order")
+
+// Inquiry is a message from someone interested in an original. ArtID is empty for
+// inquiries sent from the buy art page rather than a specific artwork.
+type Inquiry struct {
+	UUID      string
+	ArtID     string
+	ArtTitle  string
+	Name      string
+	Email     string
+	Message   string
+	Status    InquiryStatus
+	OrderID   string
+	CreatedAt string
+}
+
+func (db *DB) createInquiriesTable() error {
+	_, err := db.Exec(`
+	CREATE TABLE IF NOT EXISTS inquiries (
+		uuid TEXT PRIMARY KEY,
+		art_id TEXT NOT NULL DEFAULT '',
+		art_title TEXT NOT NULL DEFAULT '',
+		name TEXT NOT NULL,
+		email TEXT NOT NULL,
+		message TEXT NOT NULL,
+		status TEXT NOT NULL,
+		order_id TEXT NOT NULL DEFAULT '',
+		created_at TEXT NOT NULL
+	);
+	`)
+	return err
+}
+
+func (db *DB) AddInquiry(inquiry Inquiry) (Inquiry, error) {
+	inquiry.UUID = uuid.NewString()
+	inquiry.Status = InquiryStatusNew
+	inquiry.CreatedAt = time.Now().Format(time.RFC3339)
+
+	_, err := db.Exec(`
+	INSERT INTO inquiries (uuid, art_id, art_title, name, email, message, status, created_at)
+	VALUES (?, ?, ?, ?, ?, ?, ?, ?);
+	`, inquiry.UUID, inquiry.ArtID, inquiry.ArtTitle, inquiry.Name, inquiry.Email, inquiry.Message, inquiry.Status, inquiry.CreatedAt)
+	return inquiry, err
+}
+
+const inquiryColumns = `uuid, art_id, art_title, name, email, message, status, order_id, created_at`
+
+func scanInquiry(scan func(dest ...any) error) (Inquiry, error) {
+	var inquiry Inquiry
+	err := scan(&inquiry.UUID, &inquiry.ArtID, &inquiry.ArtTitle, &inquiry.Name, &inquiry.Email, &inquiry.Message, &inquiry.Status, &inquiry.OrderID, &inquiry.CreatedAt)
+	return inquiry, err
+}
+
+func (db *DB) GetInquiry(id string) (Inquiry, error) {
+	return scanInquiry(db.QueryRow(`SELECT `+inquiryColumns+` FROM inquiries WHERE uuid = ?;`, id).Scan)
+}
+
+// GetInquiries returns all inquiries, unanswered first and newest first within each status
+func (db *DB) GetInquiries() ([]Inquiry, error) {
+	rows, err := db.Query(`
+	SELECT ` + inquiryColumns + ` FROM inquiries
+	ORDER BY status = 'NEW' DESC, created_at DESC;
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var inquiries []Inquiry
+	for rows.Next() {
+		inquiry, err := scanInquiry(rows.Scan)
+		if err != nil {
+			return nil, err
+		}
+		inquiries = append(inquiries, inquiry)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return inquiries, nil
+}
+
+// CountNewInquiries returns the number of inquiries waiting for an answer
+func (db *DB) CountNewInquiries() (int, error) {
+	var count int
+	err := db.QueryRow(`SELECT COUNT(*) FROM inquiries WHERE status = ?;`, InquiryStatusNew).Scan(&count)
+	return count, err
+}
+
+// SetInquiryAnswered marks the inquiry answered, or new again. Converted inquiries
+// are left as they are.
+func (db *DB) SetInquiryAnswered(id string, answered bool) error {
+	status := InquiryStatusNew
+	if answered {
+		status = InquiryStatusAnswered
+	}
+
+	result, err := db.Exec(`UPDATE inquiries SET status = ? WHERE uuid = ? AND status != ?;`, status, id, InquiryStatusConverted)
+	if err != nil {
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		if _, err := db.GetInquiry(id); errors.Is(err, sql.ErrNoRows) {
+			return err
+		}
+		return ErrInquiryConverted
+	}
+	return nil
+}
+
+// ConvertInquiryToOrder places an order for the inquired original in one transaction.
+// The original is reserved for the order even when it isn't listed for sale, since the
+// price was agreed with the buyer.
+func (db *DB) ConvertInquiryToOrder(inquiryID string, row OrderRow, details OrderDetails) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(`
+	UPDATE inquiries SET status = ?, order_id = ? WHERE uuid = ? AND status != ?;
+	`, InquiryStatusConverted, details.OrderID, inquiryID, InquiryStatusConverted)
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrInquiryConverted
+	}
+
+	result, err = tx.Exec(`
+	UPDATE arts SET reserved_order_id = ?
+	WHERE id = ? AND reserved_order_id = '' AND sold = 0;
+	`, details.OrderID, row.PrintID)
+	if err != nil {
+		return err
+	}
+	affected, err = result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrArtUnavailable
+	}
+
+	if err := addOrderRow(tx, row); err != nil {
+		return err
+	}
+	if err := addOrderDetails(tx, details); err != nil {
+		return err
+	}
+	if err := addOrderEvent(tx, details.OrderID, OrderEventPlaced, ""); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
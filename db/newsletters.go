@@ -0,0 +1,225 @@
+package db
+
+import (
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type NewsletterStatus string
+
+const (
+	NewsletterStatusDraft   NewsletterStatus = "DRAFT"
+	NewsletterStatusSending NewsletterStatus = "SENDING"
+	NewsletterStatusSent    NewsletterStatus = "SENT"
+)
+
+type DeliveryStatus string
+
+const (
+	DeliveryStatusPending DeliveryStatus = "PENDING"
+	DeliveryStatusSent    DeliveryStatus = "SENT"
+	DeliveryStatusFailed  DeliveryStatus = "FAILED"
+)
+
+var ErrNewsletterNotDraft = errors.New("newsletter has already been sent")
+
+// Newsletter is a markdown email sent to every confirmed subscriber. The counts
+// are the delivery stats.
+type Newsletter struct {
+	UUID      string
+	Subject   string
+	Body      string
+	Status    NewsletterStatus
+	CreatedAt string
+	SentAt    string
+
+	Pending int
+	Sent    int
+	Failed  int
+}
+
+// NewsletterDelivery is one email of a newsletter send
+type NewsletterDelivery struct {
+	UUID            string
+	NewsletterID    string
+	Email           string
+	SubscriberToken string
+	Status          DeliveryStatus
+	Error           string
+	SentAt          string
+}
+
+func (db *DB) createNewsletterTables() error {
+	_, err := db.Exec(`
+	CREATE TABLE IF NOT EXISTS newsletters (
+		uuid TEXT PRIMARY KEY,
+		subject TEXT NOT NULL,
+		body TEXT NOT NULL,
+		status TEXT NOT NULL,
+		created_at TEXT NOT NULL,
+		sent_at TEXT NOT NULL DEFAULT ''
+	);
+
+	CREATE TABLE IF NOT EXISTS newsletter_deliveries (
+		uuid TEXT PRIMARY KEY,
+		newsletter_id TEXT NOT NULL,
+		email TEXT NOT NULL,
+		subscriber_token TEXT NOT NULL,
+		status TEXT NOT NULL,
+		error TEXT NOT NULL DEFAULT '',
+		sent_at TEXT NOT NULL DEFAULT '',
+		UNIQUE (newsletter_id, email)
+	);
+	`)
+	return err
+}
+
+func (db *DB) AddNewsletter(subject string, body string) (Newsletter, error) {
+	newsletter := Newsletter{
+		UUID:      uuid.NewString(),
+		Subject:   subject,
+		Body:      body,
+		Status:    NewsletterStatusDraft,
+		CreatedAt: time.Now().Format(time.RFC3339),
+	}
+	_, err := db.Exec(`
+	INSERT INTO newsletters (uuid, subject, body, status, created_at)
+	VALUES (?, ?, ?, ?, ?);
+	`, newsletter.UUID, newsletter.Subject, newsletter.Body, newsletter.Status, newsletter.CreatedAt)
+	return newsletter, err
+}
+
+// UpdateNewsletter edits a draft
+func (db *DB) UpdateNewsletter(id string, subject string, body string) error {
+	result, err := db.Exec(`
+	UPDATE newsletters SET subject = ?, body = ? WHERE uuid = ? AND status = ?;
+	`, subject, body, id, NewsletterStatusDraft)
+	if err != nil {
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrNewsletterNotDraft
+	}
+	return nil
+}
+
+const newsletterColumns = `
+	n.uuid, n.subject, n.body, n.status, n.created_at, n.sent_at,
+	COALESCE(SUM(d.status = 'PENDING'), 0),
+	COALESCE(SUM(d.status = 'SENT'), 0),
+	COALESCE(SUM(d.status = 'FAILED'), 0)
+	FROM newsletters n
+	LEFT JOIN newsletter_deliveries d ON d.newsletter_id = n.uuid`
+
+func scanNewsletter(scan func(dest ...any) error) (Newsletter, error) {
+	var newsletter Newsletter
+	err := scan(&newsletter.UUID, &newsletter.Subject, &newsletter.Body, &newsletter.Status, &newsletter.CreatedAt, &newsletter.SentAt,
+		&newsletter.Pending, &newsletter.Sent, &newsletter.Failed)
+	return newsletter, err
+}
+
+func (db *DB) GetNewsletter(id string) (Newsletter, error) {
+	return scanNewsletter(db.QueryRow(`SELECT `+newsletterColumns+` WHERE n.uuid = ? GROUP BY n.uuid;`, id).Scan)
+}
+
+func (db *DB) GetNewsletters() ([]Newsletter, error) {
+	return db.queryNewsletters(`SELECT ` + newsletterColumns + ` GROUP BY n.uuid ORDER BY n.created_at DESC;`)
+}
+
+// GetSendingNewsletters returns newsletters whose send was interrupted, e.g. by a restart
+func (db *DB) GetSendingNewsletters() ([]Newsletter, error) {
+	return db.queryNewsletters(`SELECT `+newsletterColumns+` WHERE n.status = ? GROUP BY n.uuid;`, NewsletterStatusSending)
+}
+
+func (db *DB) queryNewsletters(query string, args ...any) ([]Newsletter, error) {
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var newsletters []Newsletter
+	for rows.Next() {
+		newsletter, err := scanNewsletter(rows.Scan)
+		if err != nil {
+			return nil, err
+		}
+		newsletters = append(newsletters, newsletter)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return newsletters, nil
+}
+
+// QueueNewsletter starts sending a draft by creating a pending delivery for every
+// confirmed subscriber
+func (db *DB) QueueNewsletter(id string) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(`UPDATE newsletters SET status = ? WHERE uuid = ? AND status = ?;`, NewsletterStatusSending, id, NewsletterStatusDraft)
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrNewsletterNotDraft
+	}
+
+	_, err = tx.Exec(`
+	INSERT INTO newsletter_deliveries (uuid, newsletter_id, email, subscriber_token, status)
+	SELECT lower(hex(randomblob(16))), ?, email, token, ?
+	FROM subscribers
+	WHERE status = ?;
+	`, id, DeliveryStatusPending, SubscriberStatusConfirmed)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// NextNewsletterDelivery returns the next pending delivery, or sql.ErrNoRows when all are done
+func (db *DB) NextNewsletterDelivery(newsletterID string) (NewsletterDelivery, error) {
+	var delivery NewsletterDelivery
+	err := db.QueryRow(`
+	SELECT uuid, newsletter_id, email, subscriber_token, status, error, sent_at
+	FROM newsletter_deliveries
+	WHERE newsletter_id = ? AND status = ?
+	LIMIT 1;
+	`, newsletterID, DeliveryStatusPending).Scan(&delivery.UUID, &delivery.NewsletterID, &delivery.Email, &delivery.SubscriberToken, &delivery.Status, &delivery.Error, &delivery.SentAt)
+	return delivery, err
+}
+
+func (db *DB) SetNewsletterDeliveryStatus(id string, status DeliveryStatus, deliveryError string) error {
+	_, err := db.Exec(`
+	UPDATE newsletter_deliveries SET status = ?, error = ?, sent_at = ? WHERE uuid = ?;
+	`, status, deliveryError, time.Now().Format(time.RFC3339), id)
+	return err
+}
+
+// FinishNewsletter marks the newsletter as sent once no deliveries are pending
+func (db *DB) FinishNewsletter(id string) error {
+	_, err := db.Exec(`
+	UPDATE newsletters SET status = ?, sent_at = ?
+	WHERE uuid = ? AND NOT EXISTS (
+		SELECT 1 FROM newsletter_deliveries WHERE newsletter_id = ? AND status = ?
+	);
+	`, NewsletterStatusSent, time.Now().Format(time.RFC3339), id, id, DeliveryStatusPending)
+	return err
+}
@@ -0,0 +1,89 @@
+package db
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type OrderEventKind string
+
+const (
+	OrderEventPlaced    OrderEventKind = "PLACED"
+	OrderEventContacted OrderEventKind = "CONTACTED"
+	OrderEventPaid      OrderEventKind = "PAID"
+	OrderEventShipped   OrderEventKind = "SHIPPED"
+	OrderEventCancelled OrderEventKind = "CANCELLED"
+)
+
+// OrderEvent is one entry in the timeline shown to the buyer
+type OrderEvent struct {
+	UUID      string
+	OrderID   string
+	Kind      OrderEventKind
+	Note      string
+	CreatedAt string
+}
+
+func (db *DB) createOrderEventsTable() error {
+	_, err := db.Exec(`
+	CREATE TABLE IF NOT EXISTS order_events (
+		uuid TEXT PRIMARY KEY,
+		order_id TEXT NOT NULL,
+		kind TEXT NOT NULL,
+		note TEXT NOT NULL DEFAULT '',
+		created_at TEXT NOT NULL
+	);
+	`)
+	return err
+}
+
+// NewOrderAccessToken generates the unguessable token used in the buyer's order link
+func NewOrderAccessToken() (string, error) {
+	bytes := make([]byte, 24)
+	if _, err := rand.Read(bytes); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(bytes), nil
+}
+
+func (db *DB) AddOrderEvent(orderID string, kind OrderEventKind, note string) error {
+	return addOrderEvent(db, orderID, kind, note)
+}
+
+func addOrderEvent(ex execer, orderID string, kind OrderEventKind, note string) error {
+	_, err := ex.Exec(`
+	INSERT INTO order_events (uuid, order_id, kind, note, created_at)
+	VALUES (?, ?, ?, ?, ?);
+	`, uuid.NewString(), orderID, kind, note, time.Now().Format(time.RFC3339))
+	return err
+}
+
+func (db *DB) GetOrderEvents(orderID string) ([]OrderEvent, error) {
+	rows, err := db.Query(`
+	SELECT uuid, order_id, kind, note, created_at
+	FROM order_events
+	WHERE order_id = ?
+	ORDER BY created_at ASC;
+	`, orderID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var events []OrderEvent
+	for rows.Next() {
+		var event OrderEvent
+		if err := rows.Scan(&event.UUID, &event.OrderID, &event.Kind, &event.Note, &event.CreatedAt); err != nil {
+			return nil, err
+		}
+		events = append(events, event)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return events, nil
+}
@@ -1,6 +1,13 @@
 package db
 
-import "time"
+import (
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
 
 type OrderStatus string
 
@@ -8,6 +15,16 @@ const (
 	OrderStatusPlaced    OrderStatus = "PLACED"
 	OrderStatusContacted OrderStatus = "CONTACTED"
 	OrderStatusShipped   OrderStatus = "SHIPPED"
+	OrderStatusCancelled OrderStatus = "CANCELLED"
+)
+
+var (
+	ErrOrderNotCancellable = errors.New("order can no longer be cancelled")
+	// ErrInvalidOrderStatus is returned for statuses UpdateOrderStatus can't set.
+	// Cancelling puts stock back, so it goes through CancelOrder.
+	ErrInvalidOrderStatus = errors.New("invalid order status")
+	// ErrOrderCancelled is returned for rows of a cancelled order marked as paid
+	ErrOrderCancelled = errors.New("order is cancelled")
 )
 
 type OrderRow struct {
@@ -18,6 +35,7 @@ type OrderRow struct {
 	SentAt      string
 	Email       string
 	PrintID     string
+	VariantID   string
 	Title       string
 	Typ         string
 	Quantity    int
@@ -36,6 +54,47 @@ type Order struct {
 	HasPaidAll  bool
 	Rows        []OrderRow
 	TotalPrice  float64
+
+	Country        string
+	ShippingCost   float64
+	DiscountCode   string
+	DiscountAmount float64
+	GiftCardCode   string
+	GiftCardAmount float64
+	AccessToken    string
+	Carrier        string
+	TrackingNumber string
+	InvoiceNumber  int
+	InvoiceDate    string
+
+	BuyerName  string
+	Address    string
+	PostalCode string
+	City       string
+	Phone      string
+}
+
+// OrderDetails holds order level data that is not repeated on every row
+type OrderDetails struct {
+	OrderID        string
+	Country        string
+	ShippingZone   string
+	ShippingCost   float64
+	DiscountCode   string
+	DiscountAmount float64
+	GiftCardCode   string
+	GiftCardAmount float64
+	AccessToken    string
+	Carrier        string
+	TrackingNumber string
+	InvoiceNumber  int
+	InvoiceDate    string
+
+	BuyerName  string
+	Address    string
+	PostalCode string
+	City       string
+	Phone      string
 }
 
 func (db *DB) createOrdersTable() error {
@@ -57,14 +116,178 @@ func (db *DB) createOrdersTable() error {
 	);
 	`)
 
+	if err != nil {
+		return err
+	}
+
+	if err := db.ensureColumn("orders", "variant_id", "TEXT NOT NULL DEFAULT ''"); err != nil {
+		return err
+	}
+
+	_, err = db.Exec(`
+	CREATE TABLE IF NOT EXISTS order_details (
+		order_id TEXT PRIMARY KEY,
+		country TEXT NOT NULL DEFAULT '',
+		shipping_zone TEXT NOT NULL DEFAULT '',
+		shipping_cost REAL NOT NULL DEFAULT 0
+	);
+	`)
+	if err != nil {
+		return err
+	}
+
+	if err := db.ensureColumn("order_details", "discount_code", "TEXT NOT NULL DEFAULT ''"); err != nil {
+		return err
+	}
+	if err := db.ensureColumn("order_details", "discount_amount", "REAL NOT NULL DEFAULT 0"); err != nil {
+		return err
+	}
+	if err := db.ensureColumn("order_details", "gift_card_code", "TEXT NOT NULL DEFAULT ''"); err != nil {
+		return err
+	}
+	if err := db.ensureColumn("order_details", "gift_card_amount", "REAL NOT NULL DEFAULT 0"); err != nil {
+		return err
+	}
+	if err := db.ensureColumn("order_details", "access_token", "TEXT NOT NULL DEFAULT ''"); err != nil {
+		return err
+	}
+	if err := db.ensureColumn("order_details", "tracking_number", "TEXT NOT NULL DEFAULT ''"); err != nil {
+		return err
+	}
+	if err := db.ensureColumn("order_details", "carrier", "TEXT NOT NULL DEFAULT ''"); err != nil {
+		return err
+	}
+	if err := db.ensureColumn("order_details", "invoice_number", "INTEGER NOT NULL DEFAULT 0"); err != nil {
+		return err
+	}
+	if err := db.ensureColumn("order_details", "invoice_date", "TEXT NOT NULL DEFAULT ''"); err != nil {
+		return err
+	}
+	for _, column := range []string{"buyer_name", "address", "postal_code", "city", "phone"} {
+		if err := db.ensureColumn("order_details", column, "TEXT NOT NULL DEFAULT ''"); err != nil {
+			return err
+		}
+	}
+
+	return db.createOrderEventsTable()
+}
+
+func (db *DB) AddOrderDetails(details OrderDetails) error {
+	return addOrderDetails(db, details)
+}
+
+func addOrderDetails(ex execer, details OrderDetails) error {
+	_, err := ex.Exec(`
+	INSERT INTO order_details (order_id, country, shipping_zone, shipping_cost, discount_code, discount_amount, gift_card_code, gift_card_amount, access_token, carrier, tracking_number, buyer_name, address, postal_code, city, phone)
+	VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?);
+	`, details.OrderID, details.Country, details.ShippingZone, details.ShippingCost, details.DiscountCode, details.DiscountAmount, details.GiftCardCode, details.GiftCardAmount, details.AccessToken, details.Carrier, details.TrackingNumber, details.BuyerName, details.Address, details.PostalCode, details.City, details.Phone)
 	return err
 }
 
-func (db *DB) AddOrder(order OrderRow) error {
+func (db *DB) GetOrderDetails(orderID string) (OrderDetails, error) {
+	details := OrderDetails{OrderID: orderID}
+	err := db.QueryRow(`SELECT country, shipping_zone, shipping_cost, discount_code, discount_amount, gift_card_code, gift_card_amount, access_token, carrier, tracking_number, invoice_number, invoice_date, buyer_name, address, postal_code, city, phone FROM order_details WHERE order_id = ?;`, orderID).Scan(&details.Country, &details.ShippingZone, &details.ShippingCost, &details.DiscountCode, &details.DiscountAmount, &details.GiftCardCode, &details.GiftCardAmount, &details.AccessToken, &details.Carrier, &details.TrackingNumber, &details.InvoiceNumber, &details.InvoiceDate, &details.BuyerName, &details.Address, &details.PostalCode, &details.City, &details.Phone)
+	if err == sql.ErrNoRows {
+		// orders placed before details were stored
+		return details, nil
+	}
+	return details, err
+}
+
+func (db *DB) attachOrderDetails(order *Order) error {
+	details, err := db.GetOrderDetails(order.OrderID)
+	if err != nil {
+		return err
+	}
+
+	order.Country = details.Country
+	order.ShippingCost = details.ShippingCost
+	order.DiscountCode = details.DiscountCode
+	order.DiscountAmount = details.DiscountAmount
+	order.GiftCardCode = details.GiftCardCode
+	order.GiftCardAmount = details.GiftCardAmount
+	order.AccessToken = details.AccessToken
+	order.Carrier = details.Carrier
+	order.TrackingNumber = details.TrackingNumber
+	order.InvoiceNumber = details.InvoiceNumber
+	order.InvoiceDate = details.InvoiceDate
+	order.BuyerName = details.BuyerName
+	order.Address = details.Address
+	order.PostalCode = details.PostalCode
+	order.City = details.City
+	order.Phone = details.Phone
+	order.TotalPrice += details.ShippingCost - details.DiscountAmount
+	return nil
+}
+
+// GetOrderByAccessToken finds the order behind a buyer's order link
+func (db *DB) GetOrderByAccessToken(token string) (Order, error) {
+	if token == "" {
+		return Order{}, sql.ErrNoRows
+	}
+
+	var orderID string
+	err := db.QueryRow(`SELECT order_id FROM order_details WHERE access_token = ?;`, token).Scan(&orderID)
+	if err != nil {
+		return Order{}, err
+	}
+	return db.GetOrderByID(orderID)
+}
+
+func (db *DB) SetOrderTracking(orderID string, carrier string, trackingNumber string) error {
 	_, err := db.Exec(`
-	INSERT INTO orders (uuid, order_id, created_at, contacted_at, sent_at, email, print_id, title, typ, quantity, price, status, has_paid)
-	VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?);
-	`, order.UUID, order.OrderID, order.CreatedAt, order.ContactedAt, order.SentAt, order.Email, order.PrintID, order.Title, order.Typ, order.Quantity, order.Price, order.Status, order.HasPaid)
+	INSERT INTO order_details (order_id, carrier, tracking_number)
+	VALUES (?, ?, ?)
+	ON CONFLICT(order_id) DO UPDATE SET carrier = excluded.carrier, tracking_number = excluded.tracking_number;
+	`, orderID, carrier, trackingNumber)
+	return err
+}
+
+// AssignInvoiceNumber gives the order the next invoice number the first time an invoice
+// is made for it, later calls return the number already assigned
+func (db *DB) AssignInvoiceNumber(orderID string) (int, string, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, "", err
+	}
+	defer tx.Rollback()
+
+	var number int
+	var date string
+	err = tx.QueryRow(`SELECT invoice_number, invoice_date FROM order_details WHERE order_id = ?;`, orderID).Scan(&number, &date)
+	if err != nil && err != sql.ErrNoRows {
+		return 0, "", err
+	}
+	if number > 0 {
+		return number, date, nil
+	}
+
+	if err := tx.QueryRow(`SELECT COALESCE(MAX(invoice_number), 0) + 1 FROM order_details;`).Scan(&number); err != nil {
+		return 0, "", err
+	}
+	date = time.Now().Format(time.RFC3339)
+
+	_, err = tx.Exec(`
+	INSERT INTO order_details (order_id, invoice_number, invoice_date)
+	VALUES (?, ?, ?)
+	ON CONFLICT(order_id) DO UPDATE SET invoice_number = excluded.invoice_number, invoice_date = excluded.invoice_date;
+	`, orderID, number, date)
+	if err != nil {
+		return 0, "", err
+	}
+
+	return number, date, tx.Commit()
+}
+
+func (db *DB) AddOrder(order OrderRow) error {
+	return addOrderRow(db, order)
+}
+
+func addOrderRow(ex execer, order OrderRow) error {
+	_, err := ex.Exec(`
+	INSERT INTO orders (uuid, order_id, created_at, contacted_at, sent_at, email, print_id, variant_id, title, typ, quantity, price, status, has_paid)
+	VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?);
+	`, order.UUID, order.OrderID, order.CreatedAt, order.ContactedAt, order.SentAt, order.Email, order.PrintID, order.VariantID, order.Title, order.Typ, order.Quantity, order.Price, order.Status, order.HasPaid)
 	return err
 }
 
@@ -99,7 +322,7 @@ func buildOrderFromRows(orderRows []OrderRow) Order {
 }
 
 func (db *DB) GetOrderByID(orderID string) (Order, error) {
-	rows, err := db.Query(`SELECT uuid, order_id, created_at, contacted_at, sent_at, email, print_id, title, typ, quantity, price, status, has_paid FROM orders WHERE order_id = ?;`, orderID)
+	rows, err := db.Query(`SELECT uuid, order_id, created_at, contacted_at, sent_at, email, print_id, variant_id, title, typ, quantity, price, status, has_paid FROM orders WHERE order_id = ?;`, orderID)
 	if err != nil {
 		return Order{}, err
 	}
@@ -108,7 +331,7 @@ func (db *DB) GetOrderByID(orderID string) (Order, error) {
 	var orderRows []OrderRow
 	for rows.Next() {
 		var orderRow OrderRow
-		err := rows.Scan(&orderRow.UUID, &orderRow.OrderID, &orderRow.CreatedAt, &orderRow.ContactedAt, &orderRow.SentAt, &orderRow.Email, &orderRow.PrintID, &orderRow.Title, &orderRow.Typ, &orderRow.Quantity, &orderRow.Price, &orderRow.Status, &orderRow.HasPaid)
+		err := rows.Scan(&orderRow.UUID, &orderRow.OrderID, &orderRow.CreatedAt, &orderRow.ContactedAt, &orderRow.SentAt, &orderRow.Email, &orderRow.PrintID, &orderRow.VariantID, &orderRow.Title, &orderRow.Typ, &orderRow.Quantity, &orderRow.Price, &orderRow.Status, &orderRow.HasPaid)
 		if err != nil {
 			return Order{}, err
 		}
@@ -119,11 +342,16 @@ func (db *DB) GetOrderByID(orderID string) (Order, error) {
 		return Order{}, nil
 	}
 
-	return buildOrderFromRows(orderRows), nil
+	order := buildOrderFromRows(orderRows)
+	if err := db.attachOrderDetails(&order); err != nil {
+		return Order{}, err
+	}
+
+	return order, nil
 }
 
 func (db *DB) GetAllOrders() ([]Order, error) {
-	rows, err := db.Query(`SELECT uuid, order_id, created_at, contacted_at, sent_at, email, print_id, title, typ, quantity, price, status, has_paid FROM orders ORDER BY created_at DESC;`)
+	rows, err := db.Query(`SELECT uuid, order_id, created_at, contacted_at, sent_at, email, print_id, variant_id, title, typ, quantity, price, status, has_paid FROM orders ORDER BY created_at DESC;`)
 	if err != nil {
 		return nil, err
 	}
@@ -132,7 +360,7 @@ func (db *DB) GetAllOrders() ([]Order, error) {
 	var orders []OrderRow
 	for rows.Next() {
 		var order OrderRow
-		err := rows.Scan(&order.UUID, &order.OrderID, &order.CreatedAt, &order.ContactedAt, &order.SentAt, &order.Email, &order.PrintID, &order.Title, &order.Typ, &order.Quantity, &order.Price, &order.Status, &order.HasPaid)
+		err := rows.Scan(&order.UUID, &order.OrderID, &order.CreatedAt, &order.ContactedAt, &order.SentAt, &order.Email, &order.PrintID, &order.VariantID, &order.Title, &order.Typ, &order.Quantity, &order.Price, &order.Status, &order.HasPaid)
 		if err != nil {
 			return nil, err
 		}
@@ -147,7 +375,11 @@ func (db *DB) GetAllOrders() ([]Order, error) {
 	var result []Order
 	for _, rows := range orderMap {
 		if len(rows) > 0 {
-			result = append(result, buildOrderFromRows(rows))
+			order := buildOrderFromRows(rows)
+			if err := db.attachOrderDetails(&order); err != nil {
+				return nil, err
+			}
+			result = append(result, order)
 		}
 	}
 
@@ -169,6 +401,15 @@ func (db *DB) UpdateOrderStatus(orderID string, status string) error {
 		// No change needed
 		return nil
 	}
+	switch OrderStatus(status) {
+	case OrderStatusPlaced, OrderStatusContacted, OrderStatusShipped:
+	default:
+		return ErrInvalidOrderStatus
+	}
+	if currentStatus == string(OrderStatusCancelled) {
+		// the stock of a cancelled order was put back
+		return ErrInvalidOrderStatus
+	}
 
 	timestamp := time.Now().Format(time.RFC3339)
 	if status == string(OrderStatusContacted) {
@@ -182,7 +423,130 @@ func (db *DB) UpdateOrderStatus(orderID string, status string) error {
 	return err
 }
 
+// UpdateOrderPaidStatus marks an order row as paid or not. The rows of a cancelled
+// order can't change, its stock and gift cards have been given back.
 func (db *DB) UpdateOrderPaidStatus(uuid string, hasPaid bool) error {
-	_, err := db.Exec(`UPDATE orders SET has_paid = ? WHERE uuid = ?;`, hasPaid, uuid)
-	return err
+	result, err := db.Exec(`UPDATE orders SET has_paid = ? WHERE uuid = ? AND status != ?;`, hasPaid, uuid, OrderStatusCancelled)
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrOrderCancelled
+	}
+	return nil
+}
+
+// AmountDue is what the buyer still has to pay after gift cards
+func (order Order) AmountDue() float64 {
+	return order.TotalPrice - order.GiftCardAmount
+}
+
+// AddressLines is the delivery address without the country, empty for orders
+// placed before addresses were collected
+func (order Order) AddressLines() []string {
+	var lines []string
+	for _, line := range []string{order.BuyerName, order.Address, strings.TrimSpace(order.PostalCode + " " + order.City)} {
+		if line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return lines
+}
+
+// CancelOrder cancels an order that is still PLACED and unpaid, for the buyer.
+// Stock is put back, reserved originals are released, redeemed gift card amounts
+// are refunded and the discount code use is given back.
+func (db *DB) CancelOrder(orderID string) error {
+	return db.cancelOrder(orderID, OrderStatusPlaced)
+}
+
+// CancelUnpaidOrder cancels an order nothing has been paid for or shipped of, for
+// the admin to release what a buyer who never paid has reserved
+func (db *DB) CancelUnpaidOrder(orderID string) error {
+	return db.cancelOrder(orderID, OrderStatusPlaced, OrderStatusContacted)
+}
+
+func (db *DB) cancelOrder(orderID string, cancellable ...OrderStatus) error {
+	order, err := db.GetOrderByID(orderID)
+	if err != nil {
+		return err
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// the status is checked and changed in one statement, so of two cancels at the
+	// same time only one restocks and refunds
+	args := []any{OrderStatusCancelled, orderID}
+	for _, status := range cancellable {
+		args = append(args, status)
+	}
+	args = append(args, orderID)
+	result, err := tx.Exec(`
+	UPDATE orders SET status = ?
+	WHERE order_id = ? AND status IN (?`+strings.Repeat(", ?", len(cancellable)-1)+`)
+	AND NOT EXISTS (SELECT 1 FROM orders WHERE order_id = ? AND has_paid = 1);
+	`, args...)
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrOrderNotCancellable
+	}
+
+	now := time.Now().Format(time.RFC3339)
+
+	for _, row := range order.Rows {
+		switch {
+		case row.VariantID != "":
+			_, err = tx.Exec(`UPDATE print_variants SET quantity_left = quantity_left + ? WHERE id = ?;`, row.Quantity, row.VariantID)
+		case row.Typ == "print":
+			_, err = tx.Exec(`UPDATE prints SET quantity_left = quantity_left + ? WHERE id = ?;`, row.Quantity, row.PrintID)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	if _, err := tx.Exec(`UPDATE arts SET reserved_order_id = '' WHERE reserved_order_id = ? AND sold = 0;`, orderID); err != nil {
+		return err
+	}
+
+	if order.GiftCardCode != "" && order.GiftCardAmount > 0 {
+		_, err = tx.Exec(`
+		INSERT INTO gift_card_ledger (uuid, code, amount, order_id, note, created_at)
+		VALUES (?, ?, ?, ?, 'Refunded', ?);
+		`, uuid.NewString(), order.GiftCardCode, order.GiftCardAmount, orderID, now)
+		if err != nil {
+			return err
+		}
+	}
+
+	if order.DiscountCode != "" {
+		_, err = tx.Exec(`UPDATE discount_codes SET used_count = used_count - 1 WHERE code = ? AND used_count > 0;`, order.DiscountCode)
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err = tx.Exec(`
+	INSERT INTO order_events (uuid, order_id, kind, note, created_at)
+	VALUES (?, ?, ?, '', ?);
+	`, uuid.NewString(), orderID, OrderEventCancelled, now)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
 }
@@ -0,0 +1,59 @@
+package db
+
+import "fmt"
+
+// PlaceOrder stores a new order in one transaction. Stock is taken, originals are
+// reserved and the discount code and gift card are used together with the order rows,
+// so a failure anywhere leaves nothing behind. A non-empty checkoutKey can only place
+// one order, later attempts fail with ErrCheckoutKeyUsed.
+func (db *DB) PlaceOrder(rows []OrderRow, details OrderDetails, checkoutKey string) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if checkoutKey != "" {
+		if err := claimCheckoutKey(tx, checkoutKey, details.OrderID); err != nil {
+			return err
+		}
+	}
+
+	if details.DiscountCode != "" {
+		if err := useDiscountCode(tx, details.DiscountCode); err != nil {
+			return err
+		}
+	}
+
+	if details.GiftCardAmount > 0 {
+		if err := redeemGiftCard(tx, details.GiftCardCode, details.GiftCardAmount, details.OrderID); err != nil {
+			return err
+		}
+	}
+
+	for _, row := range rows {
+		switch row.Typ {
+		case "original":
+			if err := reserveArt(tx, row.PrintID, details.OrderID); err != nil {
+				return fmt.Errorf("%s: %w", row.Title, err)
+			}
+		case "print":
+			if err := decrementStock(tx, row.PrintID, row.VariantID, row.Quantity); err != nil {
+				return fmt.Errorf("%s: %w", row.Title, err)
+			}
+		}
+
+		if err := addOrderRow(tx, row); err != nil {
+			return err
+		}
+	}
+
+	if err := addOrderDetails(tx, details); err != nil {
+		return err
+	}
+	if err := addOrderEvent(tx, details.OrderID, OrderEventPlaced, ""); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
@@ -0,0 +1,177 @@
+package db
+
+import (
+	"errors"
+
+	"github.com/google/uuid"
+)
+
+var ErrOutOfStock = errors.New("not enough items in stock")
+
+// PrintVariant is a purchasable version of a print, e.g. a size or framing option
+type PrintVariant struct {
+	Id           string
+	PrintID      string
+	Name         string
+	SKU          string
+	Width        int
+	Height       int
+	Framed       bool
+	Price        float64
+	QuantityLeft int
+	Ordering     int
+}
+
+type PrintVariantPatch struct {
+	Name         *string
+	SKU          *string
+	Width        *int
+	Height       *int
+	Framed       *bool
+	Price        *float64
+	QuantityLeft *int
+	Ordering     *int
+}
+
+func (db *DB) createPrintVariantsTable() error {
+	_, err := db.Exec(`
+	CREATE TABLE IF NOT EXISTS print_variants (
+		id TEXT PRIMARY KEY,
+		print_id TEXT NOT NULL,
+		name TEXT NOT NULL,
+		sku TEXT NOT NULL DEFAULT '',
+		width INTEGER NOT NULL DEFAULT 0,
+		height INTEGER NOT NULL DEFAULT 0,
+		framed BOOLEAN NOT NULL DEFAULT 0,
+		price REAL NOT NULL,
+		quantity_left INTEGER NOT NULL DEFAULT 0,
+		ordering INTEGER NOT NULL DEFAULT 0
+	);
+	`)
+	return err
+}
+
+func (db *DB) AddPrintVariant(variant PrintVariant) error {
+	variant.Id = uuid.NewString()
+
+	_, err := db.Exec(`
+	INSERT INTO print_variants (id, print_id, name, sku, width, height, framed, price, quantity_left, ordering)
+	VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?);
+	`, variant.Id, variant.PrintID, variant.Name, variant.SKU, variant.Width, variant.Height, variant.Framed, variant.Price, variant.QuantityLeft, variant.Ordering)
+	return err
+}
+
+const printVariantSelect = `SELECT id, print_id, name, sku, width, height, framed, price, quantity_left, ordering FROM print_variants`
+
+func (db *DB) GetPrintVariantById(id string) (*PrintVariant, error) {
+	row := db.QueryRow(printVariantSelect+` WHERE id = ?;`, id)
+
+	var variant PrintVariant
+	if err := row.Scan(&variant.Id, &variant.PrintID, &variant.Name, &variant.SKU, &variant.Width, &variant.Height, &variant.Framed, &variant.Price, &variant.QuantityLeft, &variant.Ordering); err != nil {
+		return nil, err
+	}
+	return &variant, nil
+}
+
+func (db *DB) GetPrintVariants(printID string) ([]PrintVariant, error) {
+	return db.queryPrintVariants(printVariantSelect+` WHERE print_id = ? ORDER BY ordering ASC, price ASC;`, printID)
+}
+
+// GetAllPrintVariants returns every variant grouped by print ID
+func (db *DB) GetAllPrintVariants() (map[string][]PrintVariant, error) {
+	variants, err := db.queryPrintVariants(printVariantSelect + ` ORDER BY ordering ASC, price ASC;`)
+	if err != nil {
+		return nil, err
+	}
+
+	byPrint := make(map[string][]PrintVariant)
+	for _, variant := range variants {
+		byPrint[variant.PrintID] = append(byPrint[variant.PrintID], variant)
+	}
+	return byPrint, nil
+}
+
+func (db *DB) attachPrintVariants(prints []Print) error {
+	variants, err := db.GetAllPrintVariants()
+	if err != nil {
+		return err
+	}
+	for i := range prints {
+		prints[i].Variants = variants[prints[i].Id]
+	}
+	return nil
+}
+
+func (db *DB) queryPrintVariants(query string, args ...any) ([]PrintVariant, error) {
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var variants []PrintVariant
+	for rows.Next() {
+		var variant PrintVariant
+		if err := rows.Scan(&variant.Id, &variant.PrintID, &variant.Name, &variant.SKU, &variant.Width, &variant.Height, &variant.Framed, &variant.Price, &variant.QuantityLeft, &variant.Ordering); err != nil {
+			return nil, err
+		}
+		variants = append(variants, variant)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return variants, nil
+}
+
+func (db *DB) UpdatePrintVariant(id string, patch PrintVariantPatch) error {
+	_, err := db.Exec(`
+	UPDATE print_variants
+	SET name = COALESCE(?, name),
+		sku = COALESCE(?, sku),
+		width = COALESCE(?, width),
+		height = COALESCE(?, height),
+		framed = COALESCE(?, framed),
+		price = COALESCE(?, price),
+		quantity_left = COALESCE(?, quantity_left),
+		ordering = COALESCE(?, ordering)
+	WHERE id = ?;
+	`, patch.Name, patch.SKU, patch.Width, patch.Height, patch.Framed, patch.Price, patch.QuantityLeft, patch.Ordering, id)
+	return err
+}
+
+func (db *DB) DeletePrintVariant(id string) error {
+	_, err := db.Exec(`DELETE FROM print_variants WHERE id = ?;`, id)
+	return err
+}
+
+// DecrementStock takes quantity items of a print, or of one of its variants when
+// variantID is set. It fails with ErrOutOfStock instead of going below zero.
+func (db *DB) DecrementStock(printID, variantID string, quantity int) error {
+	return decrementStock(db, printID, variantID, quantity)
+}
+
+func decrementStock(ex execer, printID, variantID string, quantity int) error {
+	var query string
+	var id string
+	if variantID != "" {
+		query = `UPDATE print_variants SET quantity_left = quantity_left - ? WHERE id = ? AND quantity_left >= ?;`
+		id = variantID
+	} else {
+		query = `UPDATE prints SET quantity_left = quantity_left - ? WHERE id = ? AND quantity_left >= ?;`
+		id = printID
+	}
+
+	result, err := ex.Exec(query, quantity, id, quantity)
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrOutOfStock
+	}
+	return nil
+}
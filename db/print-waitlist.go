@@ -0,0 +1,123 @@
+package db
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// WaitlistEntry is a visitor waiting for a sold out print to come back in stock
+type WaitlistEntry struct {
+	UUID       string
+	PrintID    string
+	Email      string
+	Token      string
+	CreatedAt  string
+	NotifiedAt string
+}
+
+func (db *DB) createPrintWaitlistTable() error {
+	_, err := db.Exec(`
+	CREATE TABLE IF NOT EXISTS print_waitlist (
+		uuid TEXT PRIMARY KEY,
+		print_id TEXT NOT NULL,
+		email TEXT NOT NULL,
+		token TEXT NOT NULL UNIQUE,
+		created_at TEXT NOT NULL,
+		notified_at TEXT NOT NULL DEFAULT '',
+		UNIQUE (print_id, email)
+	);
+	`)
+	return err
+}
+
+func newWaitlistToken() (string, error) {
+	bytes := make([]byte, 16)
+	if _, err := rand.Read(bytes); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(bytes), nil
+}
+
+// AddToWaitlist puts the email on the print's waitlist. Signing up again after a
+// notification waits for the next restock.
+func (db *DB) AddToWaitlist(printID string, email string) error {
+	token, err := newWaitlistToken()
+	if err != nil {
+		return err
+	}
+
+	_, err = db.Exec(`
+	INSERT INTO print_waitlist (uuid, print_id, email, token, created_at)
+	VALUES (?, ?, ?, ?, ?)
+	ON CONFLICT(print_id, email) DO UPDATE SET notified_at = '';
+	`, uuid.NewString(), printID, email, token, time.Now().Format(time.RFC3339))
+	return err
+}
+
+// GetPendingWaitlist returns the entries for a print that have not been notified yet
+func (db *DB) GetPendingWaitlist(printID string) ([]WaitlistEntry, error) {
+	rows, err := db.Query(`
+	SELECT uuid, print_id, email, token, created_at, notified_at
+	FROM print_waitlist
+	WHERE print_id = ? AND notified_at = ''
+	ORDER BY created_at ASC;
+	`, printID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var entries []WaitlistEntry
+	for rows.Next() {
+		var entry WaitlistEntry
+		if err := rows.Scan(&entry.UUID, &entry.PrintID, &entry.Email, &entry.Token, &entry.CreatedAt, &entry.NotifiedAt); err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return entries, nil
+}
+
+// ClaimWaitlistEntry marks the entry as notified and reports whether this call did it,
+// so an entry is only emailed once even when restocks overlap
+func (db *DB) ClaimWaitlistEntry(uuid string) (bool, error) {
+	result, err := db.Exec(`
+	UPDATE print_waitlist SET notified_at = ? WHERE uuid = ? AND notified_at = '';
+	`, time.Now().Format(time.RFC3339), uuid)
+	if err != nil {
+		return false, err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return affected > 0, nil
+}
+
+// UnclaimWaitlistEntry puts the entry back when the email could not be sent
+func (db *DB) UnclaimWaitlistEntry(uuid string) error {
+	_, err := db.Exec(`UPDATE print_waitlist SET notified_at = '' WHERE uuid = ?;`, uuid)
+	return err
+}
+
+// RemoveFromWaitlist deletes the entry behind an unsubscribe link and reports whether there was one
+func (db *DB) RemoveFromWaitlist(token string) (bool, error) {
+	result, err := db.Exec(`DELETE FROM print_waitlist WHERE token = ?;`, token)
+	if err != nil {
+		return false, err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return affected > 0, nil
+}
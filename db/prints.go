@@ -21,6 +21,38 @@ type Print struct {
 	CreatedAt    string
 	Ordering     float64
 	ShowInStore  bool
+
+	// Variants are loaded separately, a print without variants is sold as is
+	Variants []PrintVariant
+	// Renditions are loaded separately, resized copies of the image smallest first
+	Renditions []ImageRendition
+	// Images are only loaded by GetPrintById, see AllImages
+	Images []Image
+}
+
+// InStock reports whether the print or any of its variants can still be bought
+func (print Print) InStock() bool {
+	if len(print.Variants) == 0 {
+		return print.QuantityLeft > 0
+	}
+	for _, variant := range print.Variants {
+		if variant.QuantityLeft > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// FromPrice is the lowest price the print can be bought for
+func (print Print) FromPrice() float64 {
+	if len(print.Variants) == 0 {
+		return print.Price
+	}
+	lowest := print.Variants[0].Price
+	for _, variant := range print.Variants[1:] {
+		lowest = min(lowest, variant.Price)
+	}
+	return lowest
 }
 
 type PrintPatch struct {
@@ -60,7 +92,8 @@ func (db *DB) createPrintTable() error {
 	return err
 }
 
-func (db *DB) AddPrint(print Print) error {
+// AddPrint stores the print and returns its id
+func (db *DB) AddPrint(print Print) (string, error) {
 	print.Id = uuid.NewString()
 	print.CreatedAt = time.Now().Format(time.RFC3339)
 
@@ -68,12 +101,19 @@ func (db *DB) AddPrint(print Print) error {
 	INSERT INTO prints (id, img_url, thumb_url, title, medium, width, height, year, description, price, quantity_left, created_at, ordering, show_in_store)
 	VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?);
 	`, print.Id, print.ImgURL, print.ThumbURL, print.Title, print.Medium, print.Width, print.Height, print.Year, print.Description, print.Price, print.QuantityLeft, print.CreatedAt, print.Ordering, print.ShowInStore)
-	return err
+	return print.Id, err
 }
 
 func (db *DB) DeletePrint(id string) error {
 	_, err := db.Exec(`DELETE FROM prints WHERE id = ?;`, id)
-	return err
+	if err != nil {
+		return err
+	}
+	_, err = db.Exec(`DELETE FROM print_variants WHERE print_id = ?;`, id)
+	if err != nil {
+		return err
+	}
+	return db.DeleteImages(ImageOwnerPrint, id)
 }
 
 func (db *DB) GetPrintPaged(limit, offset int) ([]Print, error) {
@@ -116,8 +156,9 @@ func (db *DB) GetPrintPaged(limit, offset int) ([]Print, error) {
 	if err := rows.Err(); err != nil {
 		return nil, err
 	}
+	rows.Close()
 
-	return prints, nil
+	return prints, db.attachPrintRenditions(prints)
 }
 
 func (db *DB) GetAllPrints() ([]Print, error) {
@@ -138,8 +179,12 @@ func (db *DB) GetAllPrints() ([]Print, error) {
 	if err := rows.Err(); err != nil {
 		return nil, err
 	}
+	rows.Close()
 
-	return prints, nil
+	if err := db.attachPrintVariants(prints); err != nil {
+		return nil, err
+	}
+	return prints, db.attachPrintRenditions(prints)
 }
 
 func (db *DB) GetPrintsForStore() ([]Print, error) {
@@ -160,8 +205,12 @@ func (db *DB) GetPrintsForStore() ([]Print, error) {
 	if err := rows.Err(); err != nil {
 		return nil, err
 	}
+	rows.Close()
 
-	return prints, nil
+	if err := db.attachPrintVariants(prints); err != nil {
+		return nil, err
+	}
+	return prints, db.attachPrintRenditions(prints)
 }
 
 func (db *DB) GetPrintById(id string) (*Print, error) {
@@ -171,6 +220,24 @@ func (db *DB) GetPrintById(id string) (*Print, error) {
 		return nil, err
 	}
 
+	variants, err := db.GetPrintVariants(id)
+	if err != nil {
+		return nil, err
+	}
+	print.Variants = variants
+
+	renditions, err := db.GetImageRenditions(print.ImgURL)
+	if err != nil {
+		return nil, err
+	}
+	print.Renditions = renditions
+
+	images, err := db.GetImages(ImageOwnerPrint, print.Id)
+	if err != nil {
+		return nil, err
+	}
+	print.Images = images
+
 	return &print, nil
 }
 
@@ -67,6 +67,21 @@ func (db *DB) ensureDefaultStoredTexts() error {
 			Content:     "Här kan du köpa art prints av mina originalmålningar. Varje print är tryckt på högkvalitativt papper och är en perfekt present till dig själv eller någon du tycker om.",
 			CreatedAt:   time.Now().Format("2006-01-02 15:04:05"),
 		},
+		{
+			ReferenceID: "payment_instructions",
+			Content:     "Du får information om betalning via e-post när vi har gått igenom din beställning. Ange ditt ordernummer vid betalning.",
+			CreatedAt:   time.Now().Format("2006-01-02 15:04:05"),
+		},
+		{
+			ReferenceID: "seller_details",
+			Content:     "Emma Jelk\nemma.jelk@gmail.com",
+			CreatedAt:   time.Now().Format("2006-01-02 15:04:05"),
+		},
+		{
+			ReferenceID: "invoice_terms",
+			Content:     "Betalningsvillkor: 30 dagar. Ange fakturanumret vid betalning.",
+			CreatedAt:   time.Now().Format("2006-01-02 15:04:05"),
+		},
 		{
 			ReferenceID: "about_me_text",
 			Content: `Under min uppväxt tecknade jag dagligen, och intresset var ett brinnande sådant. Efter barndomen gick intresset för tecknandet i vågor tills jag tillslut fick upp ögonen för tatuering, och därmed hamnade jag som lärling på en lokal tatueringsstudio. Tatuerandet var enormt utvecklande då det ingick i min dagliga arbetsrutin att vara kreativ, uppleva kundkontakt samt arbeta disciplinerat och väldigt noggrant under alla moment.
@@ -0,0 +1,157 @@
+package db
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type SubscriberStatus string
+
+const (
+	SubscriberStatusPending      SubscriberStatus = "PENDING"
+	SubscriberStatusConfirmed    SubscriberStatus = "CONFIRMED"
+	SubscriberStatusUnsubscribed SubscriberStatus = "UNSUBSCRIBED"
+)
+
+// Subscriber is a newsletter signup. The token is used in both the confirmation
+// and the unsubscribe links.
+type Subscriber struct {
+	UUID        string
+	Email       string
+	Token       string
+	Status      SubscriberStatus
+	Source      string
+	CreatedAt   string
+	ConfirmedAt string
+}
+
+func (db *DB) createSubscribersTable() error {
+	_, err := db.Exec(`
+	CREATE TABLE IF NOT EXISTS subscribers (
+		uuid TEXT PRIMARY KEY,
+		email TEXT NOT NULL UNIQUE,
+		token TEXT NOT NULL UNIQUE,
+		status TEXT NOT NULL,
+		source TEXT NOT NULL DEFAULT '',
+		created_at TEXT NOT NULL,
+		confirmed_at TEXT NOT NULL DEFAULT ''
+	);
+	`)
+	return err
+}
+
+func newSubscriberToken() (string, error) {
+	bytes := make([]byte, 16)
+	if _, err := rand.Read(bytes); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(bytes), nil
+}
+
+func scanSubscriber(scan func(dest ...any) error) (Subscriber, error) {
+	var subscriber Subscriber
+	err := scan(&subscriber.UUID, &subscriber.Email, &subscriber.Token, &subscriber.Status, &subscriber.Source, &subscriber.CreatedAt, &subscriber.ConfirmedAt)
+	return subscriber, err
+}
+
+// confirmationResendInterval is how long a pending signup waits before signing up
+// again sends another confirmation, so the form can't be used to flood an inbox
+const confirmationResendInterval = 24 * time.Hour
+
+// AddSubscriber signs the email up as pending. Someone who unsubscribed earlier is
+// made pending again, confirmed subscribers are left as they are. sendConfirmation
+// is true for new and renewed signups, and for pending ones whose last confirmation
+// was sent more than a day ago.
+func (db *DB) AddSubscriber(email string, source string) (subscriber Subscriber, sendConfirmation bool, err error) {
+	token, err := newSubscriberToken()
+	if err != nil {
+		return Subscriber{}, false, err
+	}
+
+	// created_at is when the last confirmation was asked for
+	now := time.Now()
+	result, err := db.Exec(`
+	INSERT INTO subscribers (uuid, email, token, status, source, created_at)
+	VALUES (?, ?, ?, ?, ?, ?)
+	ON CONFLICT(email) DO UPDATE SET status = ?, created_at = excluded.created_at
+	WHERE subscribers.status = ? OR (subscribers.status = ? AND subscribers.created_at < ?);
+	`, uuid.NewString(), email, token, SubscriberStatusPending, source, now.Format(time.RFC3339),
+		SubscriberStatusPending, SubscriberStatusUnsubscribed,
+		SubscriberStatusPending, now.Add(-confirmationResendInterval).Format(time.RFC3339))
+	if err != nil {
+		return Subscriber{}, false, err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return Subscriber{}, false, err
+	}
+
+	subscriber, err = scanSubscriber(db.QueryRow(`
+	SELECT uuid, email, token, status, source, created_at, confirmed_at
+	FROM subscribers WHERE email = ?;
+	`, email).Scan)
+	return subscriber, affected > 0, err
+}
+
+func (db *DB) GetSubscriberByToken(token string) (Subscriber, error) {
+	return scanSubscriber(db.QueryRow(`
+	SELECT uuid, email, token, status, source, created_at, confirmed_at
+	FROM subscribers WHERE token = ?;
+	`, token).Scan)
+}
+
+// ConfirmSubscriber confirms a pending signup. Confirming twice is fine.
+func (db *DB) ConfirmSubscriber(token string) (Subscriber, error) {
+	subscriber, err := db.GetSubscriberByToken(token)
+	if err != nil {
+		return Subscriber{}, err
+	}
+	if subscriber.Status != SubscriberStatusPending {
+		return subscriber, nil
+	}
+
+	subscriber.Status = SubscriberStatusConfirmed
+	subscriber.ConfirmedAt = time.Now().Format(time.RFC3339)
+	_, err = db.Exec(`UPDATE subscribers SET status = ?, confirmed_at = ? WHERE uuid = ?;`, subscriber.Status, subscriber.ConfirmedAt, subscriber.UUID)
+	return subscriber, err
+}
+
+func (db *DB) Unsubscribe(token string) error {
+	result, err := db.Exec(`UPDATE subscribers SET status = ? WHERE token = ?;`, SubscriberStatusUnsubscribed, token)
+	if err != nil {
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// CountSubscribers returns the number of subscribers per status
+func (db *DB) CountSubscribers() (map[SubscriberStatus]int, error) {
+	rows, err := db.Query(`SELECT status, COUNT(*) FROM subscribers GROUP BY status;`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	counts := map[SubscriberStatus]int{}
+	for rows.Next() {
+		var status SubscriberStatus
+		var count int
+		if err := rows.Scan(&status, &count); err != nil {
+			return nil, err
+		}
+		counts[status] = count
+	}
+	return counts, rows.Err()
+}
@@ -1,8 +1,12 @@
 package handlers
 
 import (
+	"errors"
 	"fmt"
+	"log"
 	"net/http"
+	"slices"
+	"strconv"
 	"time"
 
 	"github.com/go-chi/chi/v5"
@@ -20,6 +24,9 @@ func (h *Handler) RegisterCartRoutes(r chi.Router) {
 	r.Get("/cart", h.cartPage)
 	r.Post("/cart/remove", h.removeFromCartHandler)
 	r.Put("/cart/{id}/quantity", h.quantityChangeHandler)
+	r.Post("/cart/shipping", h.shippingChangeHandler)
+	r.Post("/cart/discount", h.discountCodeHandler)
+	r.Post("/cart/giftcard", h.giftCardCodeHandler)
 	r.Post("/cart/checkout", h.checkoutHandler)
 	r.Get("/cart/thanks", h.thanksPage)
 }
@@ -30,8 +37,235 @@ func (h *Handler) updateCartSymbol(w http.ResponseWriter, r *http.Request, cart
 	h.render(w, r, partial.CartSymbol(cart, true, id.CartSymbolModeCount), true)
 }
 
+// cartLine is a cart item resolved against the database
+type cartLine struct {
+	Item         services.CartItem
+	Title        string
+	ThumbURL     string
+	Renditions   []db.ImageRendition
+	UnitPrice    float64
+	Width        int
+	Height       int
+	Shippable    bool
+	Discountable bool
+}
+
+// cartOptions are the checkout choices stored next to the cart
+type cartOptions struct {
+	Country      string
+	DiscountCode string
+	GiftCardCode string
+}
+
+func (h *Handler) cartOptions(r *http.Request) cartOptions {
+	return cartOptions{
+		Country:      h.CartService.GetCountry(r),
+		DiscountCode: h.CartService.GetDiscountCode(r),
+		GiftCardCode: h.CartService.GetGiftCardCode(r),
+	}
+}
+
+func (h *Handler) cartLines(cart []services.CartItem) ([]cartLine, error) {
+	lines := make([]cartLine, 0, len(cart))
+	for _, item := range cart {
+		if item.Typ == services.CartItemTypeGiftCard {
+			amount, err := strconv.Atoi(item.PrintID)
+			if err != nil {
+				return nil, err
+			}
+			lines = append(lines, cartLine{
+				Item:      item,
+				Title:     fmt.Sprintf("Presentkort %d kr", amount),
+				ThumbURL:  "/static/img/giftcard.svg",
+				UnitPrice: float64(amount),
+			})
+			continue
+		}
+
+		if item.Typ == services.CartItemTypeOriginal {
+			art, err := h.DB.GetArtById(item.PrintID)
+			if err != nil {
+				return nil, err
+			}
+			lines = append(lines, cartLine{
+				Item:       item,
+				Title:      art.Title + " (original)",
+				ThumbURL:   art.ThumbURL,
+				Renditions: art.Renditions,
+				UnitPrice:  art.Price,
+				Width:      art.Width,
+				Height:     art.Height,
+				Shippable:  true,
+			})
+			continue
+		}
+
+		print, err := h.DB.GetPrintById(item.PrintID)
+		if err != nil {
+			return nil, err
+		}
+		line := cartLine{
+			Item:         item,
+			Title:        print.Title,
+			ThumbURL:     print.ThumbURL,
+			Renditions:   print.Renditions,
+			UnitPrice:    print.Price,
+			Width:        print.Width,
+			Height:       print.Height,
+			Shippable:    true,
+			Discountable: true,
+		}
+
+		if item.VariantID != "" {
+			variant, err := printVariant(print, item.VariantID)
+			if err != nil {
+				return nil, err
+			}
+			line.Title = print.Title + " – " + variant.Name
+			line.UnitPrice = variant.Price
+			if variant.Width > 0 && variant.Height > 0 {
+				line.Width = variant.Width
+				line.Height = variant.Height
+			}
+		}
+
+		lines = append(lines, line)
+	}
+	return lines, nil
+}
+
+// printVariant finds one of the print's variants
+func printVariant(print *db.Print, variantID string) (*db.PrintVariant, error) {
+	for _, variant := range print.Variants {
+		if variant.Id == variantID {
+			return &variant, nil
+		}
+	}
+	return nil, fmt.Errorf("print %s has no variant %s", print.Id, variantID)
+}
+
+func (h *Handler) cartSummary(lines []cartLine, options cartOptions) pages.CartSummaryView {
+	subtotal := 0.0
+	shippableSubtotal := 0.0
+	shippingItems := make([]services.ShippingItem, 0, len(lines))
+	discountLines := make([]services.DiscountLine, 0, len(lines))
+	for _, line := range lines {
+		lineTotal := float64(line.Item.Quantity) * line.UnitPrice
+		subtotal += lineTotal
+		if line.Shippable {
+			shippableSubtotal += lineTotal
+			shippingItems = append(shippingItems, services.ShippingItem{
+				Width:    line.Width,
+				Height:   line.Height,
+				Quantity: line.Item.Quantity,
+			})
+		}
+		if line.Discountable {
+			discountLines = append(discountLines, services.DiscountLine{
+				PrintID: line.Item.PrintID,
+				Total:   lineTotal,
+			})
+		}
+	}
+
+	summary := pages.CartSummaryView{
+		Subtotal:  subtotal,
+		Countries: services.ShippingCountries,
+	}
+
+	if options.DiscountCode != "" {
+		summary.DiscountCode = db.NormalizeDiscountCode(options.DiscountCode)
+		discount, err := h.discountFor(options.DiscountCode, discountLines)
+		if err != nil {
+			summary.DiscountError = services.DiscountErrorToString(err)
+		} else {
+			summary.Discount = discount
+		}
+	}
+
+	summary.Shipping = services.QuoteShipping(options.Country, shippingItems, shippableSubtotal-summary.Discount)
+	summary.Total = subtotal - summary.Discount + summary.Shipping.Cost
+
+	if options.GiftCardCode != "" {
+		summary.GiftCardCode = db.NormalizeGiftCardCode(options.GiftCardCode)
+		card, err := h.DB.GetGiftCard(options.GiftCardCode)
+		switch {
+		case err != nil:
+			summary.GiftCardError = "Ogiltigt presentkort"
+		case card.Voided:
+			summary.GiftCardError = "Presentkortet är spärrat"
+		case card.Balance <= 0:
+			summary.GiftCardError = "Presentkortet har inget saldo kvar"
+		default:
+			summary.GiftCardAmount = min(card.Balance, summary.Total)
+			summary.GiftCardBalance = card.Balance
+		}
+	}
+	summary.AmountDue = summary.Total - summary.GiftCardAmount
+
+	return summary
+}
+
+func (h *Handler) discountFor(code string, lines []services.DiscountLine) (float64, error) {
+	discountCode, err := h.DB.GetDiscountCode(code)
+	if err != nil {
+		return 0, err
+	}
+	if err := services.ValidateDiscountCode(discountCode, time.Now()); err != nil {
+		return 0, err
+	}
+	return services.DiscountAmount(discountCode, lines)
+}
+
+func (h *Handler) renderCartSummary(w http.ResponseWriter, r *http.Request, cart []services.CartItem, isOOB bool) {
+	lines, err := h.cartLines(cart)
+	if err != nil {
+		h.handleError(w, "Failed to load cart items", http.StatusInternalServerError, err)
+		return
+	}
+
+	summary := h.cartSummary(lines, h.cartOptions(r))
+	h.render(w, r, pages.CartSummary(summary, isOOB), true)
+}
+
+func (h *Handler) shippingChangeHandler(w http.ResponseWriter, r *http.Request) {
+	country := r.FormValue("country")
+	if country == "" {
+		country = services.DefaultShippingCountry
+	}
+
+	h.CartService.SaveCountry(w, country)
+	// make the new country visible to the rest of this request
+	r.AddCookie(&http.Cookie{Name: "cart_country", Value: country})
+
+	cart, _ := h.CartService.GetCart(r)
+	h.renderCartSummary(w, r, cart, false)
+}
+
+func (h *Handler) discountCodeHandler(w http.ResponseWriter, r *http.Request) {
+	code := db.NormalizeDiscountCode(r.FormValue("discount_code"))
+
+	h.CartService.SaveDiscountCode(w, code)
+	// make the new code visible to the rest of this request
+	r.AddCookie(&http.Cookie{Name: "cart_discount", Value: code})
+
+	cart, _ := h.CartService.GetCart(r)
+	h.renderCartSummary(w, r, cart, false)
+}
+
+func (h *Handler) giftCardCodeHandler(w http.ResponseWriter, r *http.Request) {
+	code := db.NormalizeGiftCardCode(r.FormValue("gift_card_code"))
+
+	h.CartService.SaveGiftCardCode(w, code)
+	// make the new code visible to the rest of this request
+	r.AddCookie(&http.Cookie{Name: "cart_giftcard", Value: code})
+
+	cart, _ := h.CartService.GetCart(r)
+	h.renderCartSummary(w, r, cart, false)
+}
+
 func (h *Handler) thanksPage(w http.ResponseWriter, r *http.Request) {
-	h.render(w, r, pages.ThanksForOrdering(true), false)
+	h.render(w, r, pages.ThanksForOrdering(true, ""), false)
 }
 
 func (h *Handler) checkoutHandler(w http.ResponseWriter, r *http.Request) {
@@ -41,68 +275,275 @@ func (h *Handler) checkoutHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	buyerEmail := r.FormValue("email")
+	// a resubmitted form gets the order it already placed
+	checkoutKey := r.FormValue("checkout_key")
+	if h.renderPlacedOrder(w, r, checkoutKey) {
+		return
+	}
+
+	if message := h.validateCart(cart); message != "" {
+		h.renderCheckoutErrors(w, r, services.CheckoutErrors{services.CheckoutFieldCart: message})
+		return
+	}
+
+	options := h.cartOptions(r)
+	if country := r.FormValue("country"); country != "" {
+		options.Country = country
+	}
+
+	lines, err := h.cartLines(cart)
+	if err != nil {
+		h.handleError(w, "Failed to get print for order item", http.StatusInternalServerError, err)
+		return
+	}
+	summary := h.cartSummary(lines, options)
+
+	buyer := services.CheckoutForm{
+		Name:       r.FormValue(services.CheckoutFieldName),
+		Email:      r.FormValue(services.CheckoutFieldEmail),
+		Address:    r.FormValue(services.CheckoutFieldAddress),
+		PostalCode: r.FormValue(services.CheckoutFieldPostalCode),
+		City:       r.FormValue(services.CheckoutFieldCity),
+		Country:    summary.Shipping.Country,
+		Phone:      r.FormValue(services.CheckoutFieldPhone),
+	}.Normalize()
+	needsAddress := slices.ContainsFunc(lines, func(line cartLine) bool { return line.Shippable })
+	if fieldErrors := services.ValidateCheckoutForm(buyer, needsAddress); len(fieldErrors) > 0 {
+		h.renderCheckoutErrors(w, r, fieldErrors)
+		return
+	}
+	buyerEmail := buyer.Email
 
-	orderRows := []db.OrderRow{}
-	createdAt := time.Now().Format(time.RFC3339)
 	orderID := uuid.NewString()
+	accessToken, err := db.NewOrderAccessToken()
+	if err != nil {
+		h.handleError(w, "Failed to create order", http.StatusInternalServerError, err)
+		return
+	}
 
-	for _, item := range cart {
-		print, err := h.DB.GetPrintById(item.PrintID)
-		if err != nil {
-			h.handleError(w, "Failed to get print for order item", http.StatusInternalServerError, err)
-			return
-		}
+	discountCode := ""
+	if summary.Discount > 0 {
+		discountCode = summary.DiscountCode
+	}
+	giftCardCode := ""
+	if summary.GiftCardAmount > 0 {
+		giftCardCode = summary.GiftCardCode
+	}
 
-		orderRow := db.OrderRow{
+	orderRows := make([]db.OrderRow, 0, len(lines))
+	createdAt := time.Now().Format(time.RFC3339)
+	for _, line := range lines {
+		orderRows = append(orderRows, db.OrderRow{
 			UUID:      uuid.NewString(),
 			CreatedAt: createdAt,
 			OrderID:   orderID,
 			Email:     buyerEmail,
-			PrintID:   item.PrintID,
-			Title:     print.Title,
-			Typ:       item.Typ,
-			Quantity:  item.Quantity,
-			Price:     print.Price,
+			PrintID:   line.Item.PrintID,
+			VariantID: line.Item.VariantID,
+			Title:     line.Title,
+			Typ:       line.Item.Typ,
+			Quantity:  line.Item.Quantity,
+			Price:     line.UnitPrice,
 			Status:    db.OrderStatusPlaced,
 			HasPaid:   false,
-		}
+		})
+	}
 
-		err = h.DB.AddOrder(orderRow)
-		if err != nil {
-			h.handleError(w, "Failed to store order", http.StatusInternalServerError, err)
-		}
+	details := db.OrderDetails{
+		OrderID:        orderID,
+		Country:        summary.Shipping.Country,
+		ShippingZone:   string(summary.Shipping.Zone),
+		ShippingCost:   summary.Shipping.Cost,
+		DiscountCode:   discountCode,
+		DiscountAmount: summary.Discount,
+		GiftCardCode:   giftCardCode,
+		GiftCardAmount: summary.GiftCardAmount,
+		AccessToken:    accessToken,
+		BuyerName:      buyer.Name,
+		Address:        buyer.Address,
+		PostalCode:     buyer.PostalCode,
+		City:           buyer.City,
+		Phone:          buyer.Phone,
+	}
 
-		orderRows = append(orderRows, orderRow)
+	if err := h.DB.PlaceOrder(orderRows, details, checkoutKey); err != nil {
+		if errors.Is(err, db.ErrCheckoutKeyUsed) && h.renderPlacedOrder(w, r, checkoutKey) {
+			return
+		}
+		if message := placeOrderErrorToString(err); message != "" {
+			log.Printf("Checkout rejected: %v", err)
+			h.renderCheckoutErrors(w, r, services.CheckoutErrors{services.CheckoutFieldCart: message})
+			return
+		}
+		h.handleError(w, "Failed to store order", http.StatusInternalServerError, err)
+		return
 	}
 
 	order := db.Order{
-		BuyerEmail: buyerEmail,
-		Rows:       orderRows,
+		BuyerEmail:     buyerEmail,
+		CreatedAt:      createdAt,
+		OrderID:        orderID,
+		Status:         db.OrderStatusPlaced,
+		Rows:           orderRows,
+		Country:        summary.Shipping.Country,
+		ShippingCost:   summary.Shipping.Cost,
+		DiscountCode:   discountCode,
+		DiscountAmount: summary.Discount,
+		GiftCardCode:   giftCardCode,
+		GiftCardAmount: summary.GiftCardAmount,
+		AccessToken:    accessToken,
+		TotalPrice:     summary.Total,
+		BuyerName:      buyer.Name,
+		Address:        buyer.Address,
+		PostalCode:     buyer.PostalCode,
+		City:           buyer.City,
+		Phone:          buyer.Phone,
+	}
+
+	if newsletter, _ := formBool(r, "newsletter"); newsletter {
+		if err := h.subscribe(buyerEmail, "checkout"); err != nil {
+			log.Printf("Failed to subscribe %s to the newsletter: %v", buyerEmail, err)
+		}
 	}
 
 	err = services.SendOrder(buyerEmail, order)
-	success := err == nil
 	if err != nil {
 		// store order failed, but don't crash the user experience
 		fmt.Printf("Failed to send order email: %v\n", err)
 	}
 
+	err = services.SendOrderConfirmation(order, h.paymentInstructions())
+	success := err == nil
+	if err != nil {
+		log.Printf("Failed to send order confirmation: %v", err)
+	}
+
+	h.renderCheckoutDone(w, r, success, accessToken)
+}
+
+// renderCheckoutDone empties the cart and thanks the buyer
+func (h *Handler) renderCheckoutDone(w http.ResponseWriter, r *http.Request, success bool, accessToken string) {
 	h.CartService.SaveCart(w, []services.CartItem{})
+	h.CartService.SaveDiscountCode(w, "")
+	h.CartService.SaveGiftCardCode(w, "")
 	h.updateCartSymbol(w, r, []services.CartItem{})
 
-	h.render(w, r, pages.ThanksForOrdering(success), true)
+	h.render(w, r, pages.ThanksForOrdering(success, "/order/"+accessToken), true)
+}
+
+// renderPlacedOrder shows the thanks page again when the checkout key already placed
+// an order, and reports whether it did
+func (h *Handler) renderPlacedOrder(w http.ResponseWriter, r *http.Request, checkoutKey string) bool {
+	orderID, err := h.DB.GetOrderIDForCheckoutKey(checkoutKey)
+	if err != nil {
+		log.Printf("Failed to look up checkout key: %v", err)
+		return false
+	}
+	if orderID == "" {
+		return false
+	}
+
+	details, err := h.DB.GetOrderDetails(orderID)
+	if err != nil {
+		log.Printf("Failed to get order %s for checkout key: %v", orderID, err)
+		return false
+	}
+
+	h.renderCheckoutDone(w, r, true, details.AccessToken)
+	return true
+}
+
+// validateCart checks every cart item against the database and returns a message
+// for the buyer when the cart can't be ordered as it is
+func (h *Handler) validateCart(cart []services.CartItem) string {
+	if len(cart) == 0 {
+		return "Din kundvagn är tom"
+	}
+
+	for _, item := range cart {
+		if item.Quantity < 1 {
+			return "Ogiltigt antal i kundvagnen"
+		}
+
+		switch item.Typ {
+		case services.CartItemTypeGiftCard:
+			amount, err := strconv.Atoi(item.PrintID)
+			if err != nil || !slices.Contains(services.GiftCardAmounts, amount) {
+				return "Ogiltigt presentkort i kundvagnen"
+			}
+		case services.CartItemTypeOriginal:
+			art, err := h.DB.GetArtById(item.PrintID)
+			if err != nil {
+				return "En av artiklarna i kundvagnen finns inte längre"
+			}
+			if !art.IsPurchasable() || item.Quantity != 1 {
+				return art.Title + " är inte längre till salu"
+			}
+		case services.CartItemTypePrint:
+			print, err := h.DB.GetPrintById(item.PrintID)
+			if err != nil || !print.ShowInStore {
+				return "En av artiklarna i kundvagnen finns inte längre"
+			}
+			title, stock := print.Title, print.QuantityLeft
+			if len(print.Variants) > 0 && item.VariantID == "" {
+				return "Välj en variant av " + print.Title
+			}
+			if len(print.Variants) > 0 || item.VariantID != "" {
+				variant, err := printVariant(print, item.VariantID)
+				if err != nil {
+					return "En av artiklarna i kundvagnen finns inte längre"
+				}
+				title, stock = print.Title+" – "+variant.Name, variant.QuantityLeft
+			}
+			if stock <= 0 {
+				return title + " är slutsåld"
+			}
+			if item.Quantity > stock {
+				return fmt.Sprintf("Det finns bara %d kvar av %s", stock, title)
+			}
+		default:
+			return "Okänd artikel i kundvagnen"
+		}
+	}
+	return ""
+}
+
+// placeOrderErrorToString explains why the order could not be placed, or returns
+// "" when the error is not the buyer's to fix
+func placeOrderErrorToString(err error) string {
+	switch {
+	case errors.Is(err, db.ErrOutOfStock):
+		return "En av artiklarna finns inte längre i lager i önskat antal"
+	case errors.Is(err, db.ErrArtUnavailable):
+		return "Verket är inte längre tillgängligt"
+	case errors.Is(err, db.ErrDiscountCodeExhausted):
+		return services.DiscountErrorToString(err)
+	case errors.Is(err, db.ErrGiftCardVoided), errors.Is(err, db.ErrGiftCardInsufficient):
+		return "Presentkortet kunde inte lösas in"
+	default:
+		return ""
+	}
+}
+
+// renderCheckoutErrors updates the message under every checkout field and leaves
+// the rest of the form as the buyer filled it in
+func (h *Handler) renderCheckoutErrors(w http.ResponseWriter, r *http.Request, fieldErrors services.CheckoutErrors) {
+	w.Header().Set("HX-Reswap", "none")
+	for _, field := range services.CheckoutFields {
+		h.render(w, r, pages.CheckoutFieldError(field, fieldErrors[field], true), true)
+	}
 }
 
 func (h *Handler) quantityChangeHandler(w http.ResponseWriter, r *http.Request) {
 	printID := chi.URLParam(r, "id")
 	typ := r.FormValue("type")
+	variantID := r.FormValue("variant_id")
 	quantityStr := r.FormValue("quantity")
 
 	cart, _ := h.CartService.GetCart(r)
 	newCart := []services.CartItem{}
 	for _, item := range cart {
-		if item.PrintID == printID && item.Typ == typ {
+		if item.Is(printID, typ, variantID) {
 			// Update quantity
 			// Convert quantityStr to int
 			var quantity int
@@ -110,6 +551,9 @@ func (h *Handler) quantityChangeHandler(w http.ResponseWriter, r *http.Request)
 			if err != nil || quantity < 1 {
 				quantity = 1 // Default to 1 if invalid
 			}
+			if item.Typ == services.CartItemTypeOriginal {
+				quantity = 1 // There is only one original
+			}
 			item.Quantity = quantity
 		}
 		newCart = append(newCart, item)
@@ -118,18 +562,18 @@ func (h *Handler) quantityChangeHandler(w http.ResponseWriter, r *http.Request)
 	h.CartService.SaveCart(w, newCart)
 
 	h.updateCartSymbol(w, r, newCart)
-
-	w.WriteHeader(http.StatusOK)
+	h.renderCartSummary(w, r, newCart, true)
 }
 
 func (h *Handler) removeFromCartHandler(w http.ResponseWriter, r *http.Request) {
 	printID := r.FormValue("print_id")
 	typ := r.FormValue("type")
+	variantID := r.FormValue("variant_id")
 
 	cart, _ := h.CartService.GetCart(r)
 	newCart := []services.CartItem{}
 	for _, item := range cart {
-		if item.PrintID == printID && item.Typ == typ {
+		if item.Is(printID, typ, variantID) {
 			continue // Skip this item to remove it
 		}
 		newCart = append(newCart, item)
@@ -139,7 +583,7 @@ func (h *Handler) removeFromCartHandler(w http.ResponseWriter, r *http.Request)
 
 	if len(newCart) == 0 {
 		// If cart is empty, oob render empty cart page
-		h.render(w, r, pages.Cart([]pages.CartItemView{}, true), true)
+		h.render(w, r, pages.Cart([]pages.CartItemView{}, pages.CartSummaryView{}, "", true), true)
 	}
 
 	h.updateCartSymbol(w, r, newCart)
@@ -154,23 +598,35 @@ func (h *Handler) cartPage(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	cartViews := make([]pages.CartItemView, len(cartItems))
-	for i, item := range cartItems {
-		print, err := h.DB.GetPrintById(item.PrintID)
-		if err != nil {
-			h.handleError(w, "Failed to load print for cart item", http.StatusInternalServerError, err)
-			return
-		}
+	lines, err := h.cartLines(cartItems)
+	if err != nil {
+		h.handleError(w, "Failed to load print for cart item", http.StatusInternalServerError, err)
+		return
+	}
+
+	cartViews := make([]pages.CartItemView, len(lines))
+	for i, line := range lines {
 		cartViews[i] = pages.CartItemView{
-			ThumbURL: print.ThumbURL,
-			Quantity: item.Quantity,
-			Title:    print.Title,
-			ID:       item.PrintID,
-			Typ:      item.Typ,
+			ThumbURL:      line.ThumbURL,
+			Renditions:    line.Renditions,
+			Quantity:      line.Item.Quantity,
+			Title:         line.Title,
+			ID:            line.Item.PrintID,
+			VariantID:     line.Item.VariantID,
+			Typ:           line.Item.Typ,
+			UnitPrice:     line.UnitPrice,
+			Shippable:     line.Shippable,
+			ShippingClass: services.ShippingClassForSize(line.Width, line.Height),
 		}
 	}
 
-	h.render(w, r, pages.Cart(cartViews, false), false)
+	summary := h.cartSummary(lines, h.cartOptions(r))
+	checkoutKey, err := db.NewCheckoutKey()
+	if err != nil {
+		h.handleError(w, "Failed to create checkout key", http.StatusInternalServerError, err)
+		return
+	}
+	h.render(w, r, pages.Cart(cartViews, summary, checkoutKey, false), false)
 
 	// oob update background
 	if h.isHTMX(r) {
@@ -185,18 +641,38 @@ func (h *Handler) addToCartHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	printID := r.FormValue("print_id")
+	variantID := r.FormValue("variant_id")
+	typ := r.FormValue("type")
+	if typ == "" {
+		typ = services.CartItemTypePrint
+	}
+	if typ != services.CartItemTypePrint {
+		variantID = ""
+	}
 
 	cart, _ := h.CartService.GetCart(r)
 	found := false
 	for i, item := range cart {
-		if item.PrintID == printID {
-			cart[i].Quantity++
+		if item.Is(printID, typ, variantID) {
+			if typ != services.CartItemTypeOriginal {
+				cart[i].Quantity++
+			}
 			found = true
 			break
 		}
 	}
 	if !found {
-		cart = append(cart, services.CartItem{PrintID: printID, Quantity: 1, Typ: "print"})
+		cart = append(cart, services.CartItem{PrintID: printID, VariantID: variantID, Quantity: 1, Typ: typ})
+	}
+
+	// check the item with the quantity it would have in the cart
+	for _, item := range cart {
+		if item.Is(printID, typ, variantID) {
+			if message := h.validateCart([]services.CartItem{item}); message != "" {
+				h.render(w, r, pages.CartAddError(message), true)
+				return
+			}
+		}
 	}
 
 	h.CartService.SaveCart(w, cart)
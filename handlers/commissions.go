@@ -0,0 +1,323 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"mime/multipart"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/sebwib/emma-site-htmx/components/pages"
+	"github.com/sebwib/emma-site-htmx/db"
+	"github.com/sebwib/emma-site-htmx/middleware"
+	"github.com/sebwib/emma-site-htmx/services"
+)
+
+// commissionMaxImageSize is the largest reference image that is accepted
+const commissionMaxImageSize = 10 << 20
+
+func (h *Handler) RegisterCommissionRoutes(r chi.Router, store *middleware.SessionStore) {
+	r.Get("/commission", h.commissionPage)
+	r.Post("/commission", h.requestCommission)
+	r.Get("/commission/{token}", h.commissionQuotePage)
+	r.Post("/commission/{token}/accept", h.acceptCommissionQuote)
+
+	r.Group(func(r chi.Router) {
+		r.Use(middleware.RequireAuth(store))
+		r.Get("/edit/commissions", h.commissionsPage)
+		r.Post("/edit/commissions/{id}/status", h.setCommissionStatus)
+		r.Post("/edit/commissions/{id}/quote", h.quoteCommission)
+	})
+}
+
+func (h *Handler) commissionPage(w http.ResponseWriter, r *http.Request) {
+	h.render(w, r, pages.CommissionRequest(services.CommissionForm{}, nil), false)
+}
+
+func (h *Handler) requestCommission(w http.ResponseWriter, r *http.Request) {
+	// anyone can post the form, so the whole request is limited and not only what
+	// is kept in memory. A megabyte on top of the images for the rest of the form.
+	r.Body = http.MaxBytesReader(w, r.Body, services.CommissionMaxReferences*commissionMaxImageSize+1<<20)
+	if err := r.ParseMultipartForm(services.CommissionMaxReferences * commissionMaxImageSize); err != nil {
+		status := http.StatusBadRequest
+		message := "Formuläret kunde inte läsas"
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			status = http.StatusRequestEntityTooLarge
+			message = fmt.Sprintf("Bilderna får vara högst %d MB tillsammans", services.CommissionMaxReferences*commissionMaxImageSize>>20)
+		}
+		w.WriteHeader(status)
+		h.render(w, r, pages.CommissionForm(services.CommissionForm{}, services.CommissionErrors{
+			services.CommissionFieldReferences: message,
+		}), true)
+		return
+	}
+
+	form := services.CommissionForm{
+		Name:        r.FormValue(services.CommissionFieldName),
+		Email:       r.FormValue(services.CommissionFieldEmail),
+		Subject:     r.FormValue(services.CommissionFieldSubject),
+		Size:        r.FormValue(services.CommissionFieldSize),
+		Budget:      r.FormValue(services.CommissionFieldBudget),
+		Deadline:    r.FormValue(services.CommissionFieldDeadline),
+		Description: r.FormValue(services.CommissionFieldDescription),
+	}.Normalize()
+
+	fieldErrors := services.ValidateCommissionForm(form)
+	files := r.MultipartForm.File[services.CommissionFieldReferences]
+	if len(files) > services.CommissionMaxReferences {
+		fieldErrors[services.CommissionFieldReferences] = fmt.Sprintf("Du kan bifoga högst %d bilder", services.CommissionMaxReferences)
+	}
+	if len(fieldErrors) > 0 {
+		h.render(w, r, pages.CommissionForm(form, fieldErrors), true)
+		return
+	}
+
+	references, message := h.uploadCommissionReferences(files)
+	if message != "" {
+		h.render(w, r, pages.CommissionForm(form, services.CommissionErrors{services.CommissionFieldReferences: message}), true)
+		return
+	}
+
+	commission, err := h.DB.AddCommission(db.Commission{
+		Name:        form.Name,
+		Email:       strings.ToLower(form.Email),
+		Subject:     form.Subject,
+		Size:        form.Size,
+		Budget:      form.BudgetAmount(),
+		Deadline:    form.Deadline,
+		Description: form.Description,
+		References:  references,
+	})
+	if err != nil {
+		h.deleteCommissionReferences(references)
+		h.handleError(w, "Kunde inte skicka förfrågan", http.StatusInternalServerError, err)
+		return
+	}
+
+	if err := services.SendCommissionRequest(commission); err != nil {
+		log.Printf("Failed to send commission request email: %v", err)
+	}
+
+	h.render(w, r, pages.CommissionThanks(), true)
+}
+
+// uploadCommissionReferences stores the reference images. When one of them can't be
+// stored the ones already uploaded are removed and a message for the form is returned.
+func (h *Handler) uploadCommissionReferences(files []*multipart.FileHeader) ([]db.CommissionReference, string) {
+	references := make([]db.CommissionReference, 0, len(files))
+	for _, header := range files {
+		if header.Size > commissionMaxImageSize {
+			h.deleteCommissionReferences(references)
+			return nil, fmt.Sprintf("%s är större än %d MB", header.Filename, commissionMaxImageSize>>20)
+		}
+
+		file, err := header.Open()
+		if err != nil {
+			h.deleteCommissionReferences(references)
+			return nil, fmt.Sprintf("%s kunde inte läsas", header.Filename)
+		}
+		url, thumbURL, err := h.ImageUploader.UploadImage(file, header)
+		file.Close()
+		if err != nil {
+			log.Printf("Failed to upload commission reference %s: %v", header.Filename, err)
+			h.deleteCommissionReferences(references)
+			return nil, commissionReferenceError(header.Filename, err)
+		}
+
+		references = append(references, db.CommissionReference{ImgURL: url, ThumbURL: thumbURL})
+	}
+	return references, ""
+}
+
+// commissionReferenceError tells the customer why a reference image was refused
+func commissionReferenceError(filename string, err error) string {
+	var uploadErr *services.UploadError
+	if !errors.As(err, &uploadErr) {
+		return fmt.Sprintf("%s kunde inte sparas, försök igen", filename)
+	}
+	switch uploadErr.Code {
+	case services.UploadTooLarge:
+		return fmt.Sprintf("%s är för stor", filename)
+	case services.UploadDimensionsTooSmall:
+		return fmt.Sprintf("%s har för låg upplösning", filename)
+	case services.UploadDimensionsTooLarge:
+		return fmt.Sprintf("%s har för hög upplösning", filename)
+	default:
+		return fmt.Sprintf("%s är inte en JPEG-, PNG- eller WebP-bild", filename)
+	}
+}
+
+func (h *Handler) deleteCommissionReferences(references []db.CommissionReference) {
+	for _, reference := range references {
+		for _, url := range []string{reference.ImgURL, reference.ThumbURL} {
+			if err := h.ImageUploader.DeleteImage(url); err != nil {
+				log.Printf("Failed to delete commission reference %s: %v", url, err)
+			}
+		}
+	}
+}
+
+func (h *Handler) commissionQuotePage(w http.ResponseWriter, r *http.Request) {
+	commission, err := h.DB.GetCommissionByToken(chi.URLParam(r, "token"))
+	if err != nil {
+		h.handleError(w, "Beställningen hittades inte", http.StatusNotFound, err)
+		return
+	}
+
+	accessToken := ""
+	if commission.OrderID != "" {
+		details, err := h.DB.GetOrderDetails(commission.OrderID)
+		if err != nil {
+			log.Printf("Failed to load deposit order %s: %v", commission.OrderID, err)
+		}
+		accessToken = details.AccessToken
+	}
+
+	h.render(w, r, pages.CommissionQuote(commission, accessToken), false)
+}
+
+// acceptCommissionQuote places the deposit order and takes the buyer to it
+func (h *Handler) acceptCommissionQuote(w http.ResponseWriter, r *http.Request) {
+	commission, err := h.DB.GetCommissionByToken(chi.URLParam(r, "token"))
+	if err != nil {
+		h.handleError(w, "Beställningen hittades inte", http.StatusNotFound, err)
+		return
+	}
+
+	orderID := uuid.NewString()
+	accessToken, err := db.NewOrderAccessToken()
+	if err != nil {
+		h.handleError(w, "Kunde inte skapa ordern", http.StatusInternalServerError, err)
+		return
+	}
+
+	row := db.OrderRow{
+		UUID:      uuid.NewString(),
+		OrderID:   orderID,
+		CreatedAt: time.Now().Format(time.RFC3339),
+		Email:     commission.Email,
+		PrintID:   commission.UUID,
+		Title:     "Handpenning för beställningsverk: " + commission.Subject,
+		Typ:       services.CartItemTypeCommission,
+		Quantity:  1,
+		Price:     commission.DepositAmount,
+		Status:    db.OrderStatusPlaced,
+	}
+	details := db.OrderDetails{
+		OrderID:      orderID,
+		Country:      services.DefaultShippingCountry,
+		ShippingZone: string(services.ShippingZoneForCountry(services.DefaultShippingCountry)),
+		AccessToken:  accessToken,
+		BuyerName:    commission.Name,
+	}
+
+	if err := h.DB.AcceptCommissionQuote(commission.Token, row, details); err != nil {
+		if errors.Is(err, db.ErrCommissionNotQuoted) {
+			h.handleError(w, "Offerten kan inte längre accepteras", http.StatusConflict, err)
+			return
+		}
+		h.handleError(w, "Kunde inte skapa ordern", http.StatusInternalServerError, err)
+		return
+	}
+
+	order, err := h.DB.GetOrderByID(orderID)
+	if err != nil {
+		h.handleError(w, "Kunde inte hämta ordern", http.StatusInternalServerError, err)
+		return
+	}
+	if err := services.SendOrder(order.BuyerEmail, order); err != nil {
+		log.Printf("Failed to send order email: %v", err)
+	}
+	if err := services.SendOrderConfirmation(order, h.paymentInstructions()); err != nil {
+		log.Printf("Failed to send order confirmation: %v", err)
+	}
+
+	w.Header().Set("HX-Redirect", "/order/"+accessToken)
+}
+
+func (h *Handler) commissionsPage(w http.ResponseWriter, r *http.Request) {
+	commissions, err := h.DB.GetCommissions()
+	if err != nil {
+		h.handleError(w, "Failed to load commissions", http.StatusInternalServerError, err)
+		return
+	}
+
+	h.render(w, r, pages.Commissions(commissions), false)
+}
+
+func (h *Handler) renderCommissionCard(w http.ResponseWriter, r *http.Request, commissionID string, message string) {
+	commission, err := h.DB.GetCommission(commissionID)
+	if err != nil {
+		h.handleError(w, "Commission not found", http.StatusNotFound, err)
+		return
+	}
+
+	h.render(w, r, pages.CommissionCard(commission, message), true)
+}
+
+func (h *Handler) setCommissionStatus(w http.ResponseWriter, r *http.Request) {
+	commissionID := chi.URLParam(r, "id")
+	status := db.CommissionStatus(r.FormValue("status"))
+	if !slices.Contains(db.CommissionStatuses, status) {
+		http.Error(w, "Invalid status", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.DB.SetCommissionStatus(commissionID, status); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			h.handleError(w, "Commission not found", http.StatusNotFound, err)
+			return
+		}
+		h.handleError(w, "Failed to update commission", http.StatusInternalServerError, err)
+		return
+	}
+
+	h.renderCommissionCard(w, r, commissionID, "")
+}
+
+// quoteCommission stores the quote and emails it to the requester
+func (h *Handler) quoteCommission(w http.ResponseWriter, r *http.Request) {
+	commissionID := chi.URLParam(r, "id")
+
+	amount, err := strconv.ParseFloat(r.FormValue("amount"), 64)
+	if err != nil || amount <= 0 {
+		h.renderCommissionCard(w, r, commissionID, "Enter a price")
+		return
+	}
+	deposit, err := strconv.ParseFloat(r.FormValue("deposit"), 64)
+	if err != nil || deposit <= 0 || deposit > amount {
+		h.renderCommissionCard(w, r, commissionID, "The deposit must be more than 0 and at most the price")
+		return
+	}
+
+	if err := h.DB.QuoteCommission(commissionID, amount, deposit, strings.TrimSpace(r.FormValue("note"))); err != nil {
+		if errors.Is(err, db.ErrCommissionNotQuotable) {
+			h.renderCommissionCard(w, r, commissionID, "The quote has already been accepted")
+			return
+		}
+		h.handleError(w, "Failed to save quote", http.StatusInternalServerError, err)
+		return
+	}
+
+	commission, err := h.DB.GetCommission(commissionID)
+	if err != nil {
+		h.handleError(w, "Commission not found", http.StatusNotFound, err)
+		return
+	}
+
+	message := ""
+	if err := services.SendCommissionQuote(commission); err != nil {
+		log.Printf("Failed to send commission quote: %v", err)
+		message = "The quote was saved but the email could not be sent: " + err.Error()
+	}
+
+	h.render(w, r, pages.CommissionCard(commission, message), true)
+}
@@ -0,0 +1,147 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/sebwib/emma-site-htmx/components/pages"
+	"github.com/sebwib/emma-site-htmx/db"
+	"github.com/sebwib/emma-site-htmx/middleware"
+)
+
+func (h *Handler) RegisterDiscountRoutes(r chi.Router, store *middleware.SessionStore) {
+	r.Group(func(r chi.Router) {
+		r.Use(middleware.RequireAuth(store))
+		r.Get("/edit/discounts", h.discountsPage)
+		r.Post("/edit/discounts", h.createDiscountCode)
+		r.Patch("/edit/discounts/{code}/active", h.toggleDiscountCode)
+	})
+}
+
+func (h *Handler) discountsPage(w http.ResponseWriter, r *http.Request) {
+	codes, err := h.DB.GetDiscountCodes()
+	if err != nil {
+		h.handleError(w, "Failed to load discount codes", http.StatusInternalServerError, err)
+		return
+	}
+
+	prints, err := h.DB.GetAllPrints()
+	if err != nil {
+		h.handleError(w, "Failed to load prints", http.StatusInternalServerError, err)
+		return
+	}
+
+	h.render(w, r, pages.Discounts(codes, prints), false)
+}
+
+// parseFormDateTime reads a datetime-local input value as RFC3339, empty if not set
+func parseFormDateTime(value string) (string, error) {
+	if value == "" {
+		return "", nil
+	}
+	t, err := time.ParseInLocation("2006-01-02T15:04", value, time.Local)
+	if err != nil {
+		return "", err
+	}
+	return t.Format(time.RFC3339), nil
+}
+
+// timeAfter compares two RFC3339 times, which can have different offsets across
+// daylight saving time
+func timeAfter(a, b string) bool {
+	ta, _ := time.Parse(time.RFC3339, a)
+	tb, _ := time.Parse(time.RFC3339, b)
+	return ta.After(tb)
+}
+
+// renderDiscountFormError shows why the code wasn't added under the form
+func (h *Handler) renderDiscountFormError(w http.ResponseWriter, r *http.Request, message string) {
+	w.Header().Set("HX-Reswap", "none")
+	h.render(w, r, pages.DiscountFormError(message, true), true)
+}
+
+func (h *Handler) createDiscountCode(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Failed to parse form", http.StatusBadRequest)
+		return
+	}
+
+	amount, err := strconv.ParseFloat(r.FormValue("amount"), 64)
+	if err != nil || amount <= 0 {
+		h.renderDiscountFormError(w, r, "Invalid amount")
+		return
+	}
+
+	kind := db.DiscountKind(r.FormValue("kind"))
+	if kind != db.DiscountKindPercent && kind != db.DiscountKindFixed {
+		h.renderDiscountFormError(w, r, "Invalid discount kind")
+		return
+	}
+	if kind == db.DiscountKindPercent && amount > 100 {
+		h.renderDiscountFormError(w, r, "Percentage cannot exceed 100")
+		return
+	}
+
+	// an unreadable date must not be saved as no limit at all
+	validFrom, err := parseFormDateTime(r.FormValue("valid_from"))
+	if err != nil {
+		h.renderDiscountFormError(w, r, "Invalid valid from date")
+		return
+	}
+	validTo, err := parseFormDateTime(r.FormValue("valid_to"))
+	if err != nil {
+		h.renderDiscountFormError(w, r, "Invalid valid to date")
+		return
+	}
+	if validFrom != "" && validTo != "" && !timeAfter(validTo, validFrom) {
+		h.renderDiscountFormError(w, r, "Valid to must be after valid from")
+		return
+	}
+
+	maxUses, _ := strconv.Atoi(r.FormValue("max_uses"))
+
+	code := db.DiscountCode{
+		Code:      r.FormValue("code"),
+		Kind:      kind,
+		Amount:    amount,
+		ValidFrom: validFrom,
+		ValidTo:   validTo,
+		MaxUses:   maxUses,
+		PrintIDs:  r.Form["print_ids"],
+		Active:    true,
+	}
+
+	if db.NormalizeDiscountCode(code.Code) == "" {
+		h.renderDiscountFormError(w, r, "Code is required")
+		return
+	}
+
+	if err := h.DB.AddDiscountCode(code); err != nil {
+		h.handleError(w, "Failed to create discount code", http.StatusInternalServerError, err)
+		return
+	}
+
+	w.Header().Set("HX-Redirect", "/edit/discounts")
+	w.WriteHeader(http.StatusOK)
+}
+
+func (h *Handler) toggleDiscountCode(w http.ResponseWriter, r *http.Request) {
+	code := chi.URLParam(r, "code")
+	value := r.FormValue("active")
+	active := value == "true" || value == "1" || value == "on"
+
+	if err := h.DB.SetDiscountCodeActive(code, active); err != nil {
+		h.handleError(w, "Failed to update discount code", http.StatusInternalServerError, err)
+		return
+	}
+
+	discountCode, err := h.DB.GetDiscountCode(code)
+	if err != nil {
+		h.handleError(w, "Failed to load discount code", http.StatusInternalServerError, err)
+		return
+	}
+
+	h.render(w, r, pages.DiscountRow(*discountCode), true)
+}
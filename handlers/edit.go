@@ -2,6 +2,7 @@ package handlers
 
 import (
 	"encoding/json"
+	"errors"
 	"log"
 	"net/http"
 	"strconv"
@@ -12,6 +13,7 @@ import (
 	"github.com/sebwib/emma-site-htmx/components/reusable"
 	"github.com/sebwib/emma-site-htmx/db"
 	"github.com/sebwib/emma-site-htmx/middleware"
+	"github.com/sebwib/emma-site-htmx/services"
 )
 
 func (h *Handler) RegisterEditRoutes(r chi.Router, store *middleware.SessionStore) {
@@ -51,6 +53,8 @@ func (h *Handler) patchPrintField(w http.ResponseWriter, r *http.Request) {
 	value := r.FormValue(field)
 
 	log.Printf("Patching print ID %s field %s to value %s", printID, field, value)
+	wasInStock := h.printInStock(printID)
+
 	// Convert value to appropriate type based on field
 	var err error
 	switch field {
@@ -67,6 +71,8 @@ func (h *Handler) patchPrintField(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	h.notifyWaitlistIfRestocked(printID, wasInStock)
+
 	print, err := h.DB.GetPrintById(printID)
 	if err != nil {
 		h.handleError(w, "Failed to load updated print", http.StatusInternalServerError, err)
@@ -81,6 +87,7 @@ func (h *Handler) patchPrint(w http.ResponseWriter, r *http.Request) {
 	printID := chi.URLParam(r, "id")
 
 	var patch db.PrintPatch
+	var images []db.Image
 	contentType := r.Header.Get("Content-Type")
 
 	// Handle both JSON (from drag-and-drop) and form data (from modal)
@@ -136,17 +143,37 @@ func (h *Handler) patchPrint(w http.ResponseWriter, r *http.Request) {
 		if thumbURL := r.FormValue("thumb_url"); thumbURL != "" {
 			patch.ThumbURL = &thumbURL
 		}
+		formImages, cover, ok, err := imagesFromForm(r)
+		if err != nil {
+			h.handleError(w, "Invalid images", http.StatusBadRequest, nil)
+			return
+		}
+		if ok {
+			images = formImages
+			patch.ImgURL = &cover.URL
+			patch.ThumbURL = &cover.ThumbURL
+		}
 		if soldStr := r.FormValue("show_in_store"); soldStr != "" {
 			showInStore := soldStr == "true" || soldStr == "1" || soldStr == "on"
 			patch.ShowInStore = &showInStore
 		}
 	}
 
+	wasInStock := h.printInStock(printID)
+
 	// Update art with only the fields that are set
 	if err := h.DB.UpdatePrint(printID, patch); err != nil {
 		h.handleError(w, "Failed to update print", http.StatusInternalServerError, err)
 		return
 	}
+	if images != nil {
+		if err := h.DB.SetImages(db.ImageOwnerPrint, printID, images); err != nil {
+			h.handleError(w, "Failed to save print images", http.StatusInternalServerError, err)
+			return
+		}
+	}
+
+	h.notifyWaitlistIfRestocked(printID, wasInStock)
 
 	if replaceParam := r.URL.Query().Get("replace"); replaceParam == "true" {
 		w.Header().Set("HX-Redirect", "/edit")
@@ -207,10 +234,27 @@ func (h *Handler) createPrint(w http.ResponseWriter, r *http.Request) {
 		ShowInStore:  showInStore,
 	}
 
-	if err := h.DB.AddPrint(print); err != nil {
+	images, cover, hasImages, err := imagesFromForm(r)
+	if err != nil {
+		h.handleError(w, "Invalid images", http.StatusBadRequest, nil)
+		return
+	}
+	if hasImages {
+		print.ImgURL = cover.URL
+		print.ThumbURL = cover.ThumbURL
+	}
+
+	printID, err := h.DB.AddPrint(print)
+	if err != nil {
 		h.handleError(w, "Failed to create print", http.StatusInternalServerError, err)
 		return
 	}
+	if hasImages {
+		if err := h.DB.SetImages(db.ImageOwnerPrint, printID, images); err != nil {
+			h.handleError(w, "Failed to save print images", http.StatusInternalServerError, err)
+			return
+		}
+	}
 
 	w.Header().Set("HX-Redirect", "/edit")
 	w.WriteHeader(http.StatusOK)
@@ -363,7 +407,7 @@ func (h *Handler) patchArtField(w http.ResponseWriter, r *http.Request) {
 	// Convert value to appropriate type based on field
 	var err error
 	switch field {
-	case "sold", "show_in_gallery":
+	case "sold", "show_in_gallery", "for_sale":
 		boolValue := value == "true" || value == "1" || value == "on"
 		err = h.DB.UpdateArtField(artID, field, boolValue)
 	default:
@@ -389,6 +433,7 @@ func (h *Handler) patchArt(w http.ResponseWriter, r *http.Request) {
 	artID := chi.URLParam(r, "id")
 
 	var patch db.ArtPatch
+	var images []db.Image
 	contentType := r.Header.Get("Content-Type")
 
 	// Handle both JSON (from drag-and-drop) and form data (from modal)
@@ -434,6 +479,20 @@ func (h *Handler) patchArt(w http.ResponseWriter, r *http.Request) {
 		if thumbURL := r.FormValue("thumb_url"); thumbURL != "" {
 			patch.ThumbURL = &thumbURL
 		}
+		formImages, cover, ok, err := imagesFromForm(r)
+		if err != nil {
+			h.handleError(w, "Invalid images", http.StatusBadRequest, nil)
+			return
+		}
+		if ok {
+			images = formImages
+			patch.ImgURL = &cover.URL
+			patch.ThumbURL = &cover.ThumbURL
+			patch.Placeholder = &cover.Placeholder
+			patch.DominantColor = &cover.DominantColor
+			patch.ImageWidth = &cover.Width
+			patch.ImageHeight = &cover.Height
+		}
 		if soldStr := r.FormValue("sold"); soldStr != "" {
 			sold := soldStr == "true" || soldStr == "1" || soldStr == "on"
 			patch.Sold = &sold
@@ -442,6 +501,14 @@ func (h *Handler) patchArt(w http.ResponseWriter, r *http.Request) {
 			showInGallery := showInGalleryStr == "true" || showInGalleryStr == "1" || showInGalleryStr == "on"
 			patch.ShowInGallery = &showInGallery
 		}
+		if priceStr := r.FormValue("price"); priceStr != "" {
+			if price, err := strconv.ParseFloat(priceStr, 64); err == nil {
+				patch.Price = &price
+			}
+		}
+		if forSale, ok := formBool(r, "for_sale"); ok {
+			patch.ForSale = &forSale
+		}
 	}
 
 	// Update art with only the fields that are set
@@ -449,6 +516,12 @@ func (h *Handler) patchArt(w http.ResponseWriter, r *http.Request) {
 		h.handleError(w, "Failed to update art", http.StatusInternalServerError, err)
 		return
 	}
+	if images != nil {
+		if err := h.DB.SetImages(db.ImageOwnerArt, artID, images); err != nil {
+			h.handleError(w, "Failed to save art images", http.StatusInternalServerError, err)
+			return
+		}
+	}
 
 	if replaceParam := r.URL.Query().Get("replace"); replaceParam == "true" {
 		w.Header().Set("HX-Redirect", "/edit")
@@ -466,30 +539,133 @@ func (h *Handler) patchArt(w http.ResponseWriter, r *http.Request) {
 }
 
 func (h *Handler) uploadImage(w http.ResponseWriter, r *http.Request) {
-	// Parse multipart form (max 10MB)
-	if err := r.ParseMultipartForm(10 << 20); err != nil {
-		http.Error(w, "Failed to parse form", http.StatusBadRequest)
+	limits := h.ImageUploader.UploadLimits()
+	// a megabyte on top of the image for the rest of the form
+	r.Body = http.MaxBytesReader(w, r.Body, limits.MaxBytes+1<<20)
+	if err := r.ParseMultipartForm(limits.MaxBytes); err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			uploadErr := limits.TooLargeError()
+			writeUploadError(w, http.StatusRequestEntityTooLarge, uploadErr.Code, uploadErr.Message)
+			return
+		}
+		writeUploadError(w, http.StatusBadRequest, "invalid_form", "The upload could not be read")
 		return
 	}
 
 	file, header, err := r.FormFile("image")
 	if err != nil {
-		http.Error(w, "Failed to get file", http.StatusBadRequest)
+		writeUploadError(w, http.StatusBadRequest, "missing_file", "Choose an image to upload")
 		return
 	}
 	defer file.Close()
 
 	// Upload image
-	url, thumbURL, err := h.ImageUploader.UploadImage(file, header)
+	uploaded, err := h.ImageUploader.UploadGalleryImage(file, header)
+	var uploadErr *services.UploadError
+	if errors.As(err, &uploadErr) {
+		writeUploadError(w, uploadErrorStatus(uploadErr.Code), uploadErr.Code, uploadErr.Message)
+		return
+	}
 	if err != nil {
 		log.Printf("Failed to upload image: %v", err)
-		http.Error(w, "Failed to upload image", http.StatusInternalServerError)
+		writeUploadError(w, http.StatusInternalServerError, "upload_failed", "The image could not be stored, try again")
 		return
 	}
+	if err := h.DB.AddImageRenditions(uploaded.Renditions); err != nil {
+		// the image works without them, the startup job makes them again
+		log.Printf("Failed to save renditions of %s: %v", uploaded.URL, err)
+	}
 
 	// Return the URL as JSON
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]string{"url": url, "thumb_url": thumbURL})
+	json.NewEncoder(w).Encode(map[string]any{
+		"url":            uploaded.URL,
+		"thumb_url":      uploaded.ThumbURL,
+		"placeholder":    uploaded.Placeholder.LQIP,
+		"dominant_color": uploaded.Placeholder.DominantColor,
+		"image_width":    uploaded.Placeholder.Width,
+		"image_height":   uploaded.Placeholder.Height,
+	})
+}
+
+// writeUploadError answers an upload with a JSON error the add modals show
+func writeUploadError(w http.ResponseWriter, status int, code services.UploadErrorCode, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]any{
+		"error": message,
+		"code":  code,
+	})
+}
+
+func uploadErrorStatus(code services.UploadErrorCode) int {
+	switch code {
+	case services.UploadTooLarge:
+		return http.StatusRequestEntityTooLarge
+	case services.UploadUnsupportedType:
+		return http.StatusUnsupportedMediaType
+	default:
+		return http.StatusUnprocessableEntity
+	}
+}
+
+// errImagesForm is returned by imagesFromForm when the image fields don't line up
+var errImagesForm = errors.New("invalid images")
+
+// imagesFromForm reads the images editor of the art and print modals, in the order
+// the images were arranged. The cover is the image picked as cover, or the first.
+// ok is false when the form has no images.
+func imagesFromForm(r *http.Request) (images []db.Image, cover db.Image, ok bool, err error) {
+	urls := r.Form["images_url"]
+	if len(urls) == 0 {
+		return nil, db.Image{}, false, nil
+	}
+	fields := [][]string{
+		r.Form["images_thumb_url"],
+		r.Form["images_placeholder"],
+		r.Form["images_dominant_color"],
+		r.Form["images_width"],
+		r.Form["images_height"],
+	}
+	for _, values := range fields {
+		if len(values) != len(urls) {
+			return nil, db.Image{}, false, errImagesForm
+		}
+	}
+
+	coverURL := r.FormValue("cover_url")
+	for i, url := range urls {
+		if url == "" {
+			return nil, db.Image{}, false, errImagesForm
+		}
+		width, _ := strconv.Atoi(fields[3][i])
+		height, _ := strconv.Atoi(fields[4][i])
+		placeholder := services.ImagePlaceholder{
+			LQIP:          fields[1][i],
+			DominantColor: fields[2][i],
+			Width:         width,
+			Height:        height,
+		}
+		// the values end up in style attributes
+		if !services.ValidPlaceholder(placeholder) {
+			placeholder = services.ImagePlaceholder{}
+		}
+
+		image := db.Image{
+			URL:           url,
+			ThumbURL:      fields[0][i],
+			Placeholder:   placeholder.LQIP,
+			DominantColor: placeholder.DominantColor,
+			Width:         placeholder.Width,
+			Height:        placeholder.Height,
+		}
+		images = append(images, image)
+		if url == coverURL || i == 0 {
+			cover = image
+		}
+	}
+	return images, cover, true, nil
 }
 
 func (h *Handler) createArt(w http.ResponseWriter, r *http.Request) {
@@ -502,6 +678,8 @@ func (h *Handler) createArt(w http.ResponseWriter, r *http.Request) {
 	width, _ := strconv.Atoi(r.FormValue("width"))
 	height, _ := strconv.Atoi(r.FormValue("height"))
 	sold, _ := strconv.ParseBool(r.FormValue("sold"))
+	price, _ := strconv.ParseFloat(r.FormValue("price"), 64)
+	forSale, _ := strconv.ParseBool(r.FormValue("for_sale"))
 
 	// Create new art entry
 	art := db.Art{
@@ -514,12 +692,34 @@ func (h *Handler) createArt(w http.ResponseWriter, r *http.Request) {
 		Year:        r.FormValue("year"),
 		Description: r.FormValue("description"),
 		Sold:        sold,
+		Price:       price,
+		ForSale:     forSale,
+	}
+	images, cover, hasImages, err := imagesFromForm(r)
+	if err != nil {
+		h.handleError(w, "Invalid images", http.StatusBadRequest, nil)
+		return
+	}
+	if hasImages {
+		art.ImgURL = cover.URL
+		art.ThumbURL = cover.ThumbURL
+		art.Placeholder = cover.Placeholder
+		art.DominantColor = cover.DominantColor
+		art.ImageWidth = cover.Width
+		art.ImageHeight = cover.Height
 	}
 
-	if err := h.DB.AddArt(art); err != nil {
+	artID, err := h.DB.AddArt(art)
+	if err != nil {
 		h.handleError(w, "Failed to create art", http.StatusInternalServerError, err)
 		return
 	}
+	if hasImages {
+		if err := h.DB.SetImages(db.ImageOwnerArt, artID, images); err != nil {
+			h.handleError(w, "Failed to save art images", http.StatusInternalServerError, err)
+			return
+		}
+	}
 
 	w.Header().Set("HX-Redirect", "/edit")
 	w.WriteHeader(http.StatusOK)
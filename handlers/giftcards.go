@@ -0,0 +1,105 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/sebwib/emma-site-htmx/components/pages"
+	"github.com/sebwib/emma-site-htmx/db"
+	"github.com/sebwib/emma-site-htmx/middleware"
+	"github.com/sebwib/emma-site-htmx/services"
+)
+
+func (h *Handler) RegisterGiftCardRoutes(r chi.Router, store *middleware.SessionStore) {
+	r.Group(func(r chi.Router) {
+		r.Use(middleware.RequireAuth(store))
+		r.Get("/edit/giftcards", h.giftCardsPage)
+		r.Get("/edit/giftcards/lookup", h.lookupGiftCard)
+		r.Post("/edit/giftcards", h.issueGiftCard)
+		r.Post("/edit/giftcards/{code}/void", h.voidGiftCard)
+	})
+}
+
+func (h *Handler) giftCardsPage(w http.ResponseWriter, r *http.Request) {
+	cards, err := h.DB.GetGiftCards()
+	if err != nil {
+		h.handleError(w, "Failed to load gift cards", http.StatusInternalServerError, err)
+		return
+	}
+
+	h.render(w, r, pages.GiftCards(cards), false)
+}
+
+func (h *Handler) lookupGiftCard(w http.ResponseWriter, r *http.Request) {
+	code := r.URL.Query().Get("code")
+
+	card, err := h.DB.GetGiftCard(code)
+	if errors.Is(err, sql.ErrNoRows) {
+		h.render(w, r, pages.GiftCardNotFound(code), true)
+		return
+	}
+	if err != nil {
+		h.handleError(w, "Failed to look up gift card", http.StatusInternalServerError, err)
+		return
+	}
+
+	ledger, err := h.DB.GetGiftCardLedger(card.Code)
+	if err != nil {
+		h.handleError(w, "Failed to load gift card ledger", http.StatusInternalServerError, err)
+		return
+	}
+
+	h.render(w, r, pages.GiftCardDetails(*card, ledger), true)
+}
+
+func (h *Handler) issueGiftCard(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Failed to parse form", http.StatusBadRequest)
+		return
+	}
+
+	amount, err := strconv.ParseFloat(r.FormValue("amount"), 64)
+	if err != nil || amount <= 0 {
+		http.Error(w, "Invalid amount", http.StatusBadRequest)
+		return
+	}
+
+	card, err := h.DB.AddGiftCard(db.GiftCard{
+		InitialAmount: amount,
+		Email:         r.FormValue("email"),
+	})
+	if err != nil {
+		h.handleError(w, "Failed to issue gift card", http.StatusInternalServerError, err)
+		return
+	}
+
+	if card.Email != "" && r.FormValue("send_email") != "" {
+		if err := services.SendGiftCard(card.Email, card); err != nil {
+			log.Printf("Failed to send gift card %s: %v", card.Code, err)
+		}
+	}
+
+	w.Header().Set("HX-Redirect", "/edit/giftcards")
+	w.WriteHeader(http.StatusOK)
+}
+
+func (h *Handler) voidGiftCard(w http.ResponseWriter, r *http.Request) {
+	code := chi.URLParam(r, "code")
+
+	if err := h.DB.VoidGiftCard(code); err != nil {
+		h.handleError(w, "Failed to void gift card", http.StatusInternalServerError, err)
+		return
+	}
+
+	card, err := h.DB.GetGiftCard(code)
+	if err != nil {
+		h.handleError(w, "Failed to load gift card", http.StatusInternalServerError, err)
+		return
+	}
+
+	h.render(w, r, pages.GiftCardRow(*card), true)
+}
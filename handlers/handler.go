@@ -3,6 +3,7 @@ package handlers
 import (
 	"log"
 	"net/http"
+	"sync"
 
 	"github.com/a-h/templ"
 	"github.com/go-chi/chi/v5"
@@ -20,6 +21,9 @@ type Handler struct {
 	Routes        []partial.Route
 	ImageUploader *services.ImageUploader
 	CartService   *services.CartService
+
+	// newsletterSenders holds the ids of newsletters being sent right now
+	newsletterSenders sync.Map
 }
 
 func (h *Handler) getRoutesWithReferences(routes []partial.Route) []partial.Route {
@@ -91,6 +95,17 @@ func (h *Handler) handleError(w http.ResponseWriter, message string, statusCode
 	http.Error(w, message, statusCode)
 }
 
+// formBool reads a checkbox value. A hidden input with the same name placed before the
+// checkbox sends "false" when it is unchecked, so the last value wins.
+func formBool(r *http.Request, name string) (value bool, ok bool) {
+	values := r.Form[name]
+	if len(values) == 0 {
+		return false, false
+	}
+	last := values[len(values)-1]
+	return last == "true" || last == "1" || last == "on", true
+}
+
 func (h *Handler) RegisterModalRoutes(r chi.Router) {
 	r.Get("/modal/close", h.closeModal)
 }
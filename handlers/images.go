@@ -0,0 +1,260 @@
+package handlers
+
+import (
+	"bytes"
+	"errors"
+	"log"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/sebwib/emma-site-htmx/components/pages"
+	"github.com/sebwib/emma-site-htmx/middleware"
+	"github.com/sebwib/emma-site-htmx/services"
+)
+
+func (h *Handler) RegisterImageRoutes(r chi.Router, store *middleware.SessionStore) {
+	r.Get("/img/{key}", h.resizedImage)
+
+	r.Group(func(r chi.Router) {
+		r.Use(middleware.RequireAuth(store))
+		r.Get("/edit/originals/{key}", h.originalImage)
+		r.Get("/edit/images", h.imageGCPage)
+		r.Post("/edit/images/collect", h.collectImageGarbage)
+		r.Get("/edit/images/originals", h.publicOriginalsPage)
+		r.Post("/edit/images/originals/copy", h.copyOriginalsToPrivate)
+		r.Post("/edit/images/originals/delete", h.deletePublicCopies)
+	})
+}
+
+// resizedImage serves an uploaded image resized to ?w= in the format in ?fmt=. Without
+// a format the best one the browser accepts is picked.
+func (h *Handler) resizedImage(w http.ResponseWriter, r *http.Request) {
+	key := chi.URLParam(r, "key")
+	if unescaped, err := url.PathUnescape(key); err == nil {
+		key = unescaped
+	}
+
+	width, err := strconv.Atoi(r.URL.Query().Get("w"))
+	if err != nil {
+		h.handleError(w, "Invalid width", http.StatusBadRequest, nil)
+		return
+	}
+
+	formatName := r.URL.Query().Get("fmt")
+	if formatName == "" || formatName == "auto" {
+		formatName = negotiateImageFormat(r.Header.Get("Accept"))
+		w.Header().Set("Vary", "Accept")
+	}
+	format, ok := services.ImageFormatByName(formatName)
+	if !ok {
+		h.handleError(w, "Invalid format", http.StatusBadRequest, nil)
+		return
+	}
+
+	image, err := h.ImageUploader.ResizeImage(key, width, format)
+	if errors.Is(err, services.ErrWidthNotAllowed) {
+		h.handleError(w, "Width not allowed", http.StatusBadRequest, nil)
+		return
+	}
+	if errors.Is(err, services.ErrImageNotFound) {
+		h.handleError(w, "Image not found", http.StatusNotFound, nil)
+		return
+	}
+	if err != nil {
+		h.handleError(w, "Failed to resize image", http.StatusInternalServerError, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", image.ContentType)
+	w.Header().Set("ETag", image.ETag)
+	w.Header().Set("Cache-Control", "public, max-age=604800")
+	// ServeContent answers If-None-Match with 304 Not Modified
+	http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(image.Data))
+}
+
+// originalImage serves an uploaded image as it was uploaded, without watermark. Only
+// admins can download originals.
+func (h *Handler) originalImage(w http.ResponseWriter, r *http.Request) {
+	key := chi.URLParam(r, "key")
+	if unescaped, err := url.PathUnescape(key); err == nil {
+		key = unescaped
+	}
+
+	data, err := h.ImageUploader.ReadOriginal(key)
+	if errors.Is(err, services.ErrImageNotFound) {
+		h.handleError(w, "Image not found", http.StatusNotFound, nil)
+		return
+	}
+	if err != nil {
+		h.handleError(w, "Failed to read image", http.StatusInternalServerError, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", http.DetectContentType(data))
+	w.Header().Set("Cache-Control", "private, no-store")
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("inline", map[string]string{"filename": key}))
+	http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(data))
+}
+
+// negotiateImageFormat picks the smallest format the Accept header allows
+func negotiateImageFormat(accept string) string {
+	switch {
+	case strings.Contains(accept, "image/avif"):
+		return services.FormatAVIF.Name
+	case strings.Contains(accept, "image/webp"):
+		return services.FormatWebP.Name
+	}
+	return services.FormatJPEG.Name
+}
+
+// imageGCInterval is how often the image garbage collection runs
+const imageGCInterval = 24 * time.Hour
+
+// StartImageGC runs the image garbage collection once a day. It only reports what it
+// would delete unless IMAGE_GC_DELETE is "true".
+func (h *Handler) StartImageGC() {
+	dryRun := os.Getenv("IMAGE_GC_DELETE") != "true"
+	go func() {
+		for {
+			report, err := h.collectImages(dryRun)
+			if err != nil {
+				log.Printf("Image garbage collection failed: %v", err)
+			} else if dryRun {
+				log.Printf("Image garbage collection dry run: %d orphaned images (%d bytes), %d within the grace period", len(report.Orphans), report.OrphanedSize(), len(report.Recent))
+			} else if len(report.Deleted) > 0 {
+				log.Printf("Image garbage collection deleted %d orphaned images (%d bytes)", len(report.Deleted), report.OrphanedSize())
+			}
+			time.Sleep(imageGCInterval)
+		}
+	}()
+}
+
+// collectImages runs the garbage collection and forgets the renditions it deleted
+func (h *Handler) collectImages(dryRun bool) (services.ImageGCReport, error) {
+	references, err := h.DB.GetImageReferences()
+	if err != nil {
+		return services.ImageGCReport{}, err
+	}
+
+	report, err := h.ImageUploader.CollectGarbage(references, services.ImageGCGraceFromEnv(), dryRun)
+	if len(report.DeletedURLs) > 0 {
+		if err := h.DB.DeleteImageRenditionsByURL(report.DeletedURLs); err != nil {
+			log.Printf("Failed to forget deleted renditions: %v", err)
+		}
+	}
+	return report, err
+}
+
+// imageGCPage lists the images that would be deleted, it is always a dry run
+func (h *Handler) imageGCPage(w http.ResponseWriter, r *http.Request) {
+	report, err := h.collectImages(true)
+	if err != nil {
+		h.handleError(w, "Failed to look for orphaned images", http.StatusInternalServerError, err)
+		return
+	}
+
+	h.render(w, r, pages.ImageGC(report), false)
+}
+
+func (h *Handler) collectImageGarbage(w http.ResponseWriter, r *http.Request) {
+	report, err := h.collectImages(false)
+	if err != nil {
+		h.handleError(w, "Failed to delete orphaned images", http.StatusInternalServerError, err)
+		return
+	}
+
+	h.render(w, r, pages.ImageGCReport(report), true)
+}
+
+// findPublicOriginals looks for the originals that are still in the public store
+func (h *Handler) findPublicOriginals() (services.PublicOriginalsReport, error) {
+	references, err := h.DB.GetImageReferences()
+	if err != nil {
+		return services.PublicOriginalsReport{}, err
+	}
+	originals, err := h.DB.GetOriginalImageURLs()
+	if err != nil {
+		return services.PublicOriginalsReport{}, err
+	}
+	return h.ImageUploader.FindPublicOriginals(originals, references)
+}
+
+// publicOriginalsPage lists the originals uploaded before they were kept private,
+// nothing is moved until an admin asks for it
+func (h *Handler) publicOriginalsPage(w http.ResponseWriter, r *http.Request) {
+	report, err := h.findPublicOriginals()
+	if err != nil {
+		h.handleError(w, "Failed to look for public originals", http.StatusInternalServerError, err)
+		return
+	}
+
+	h.render(w, r, pages.PublicOriginals(report), false)
+}
+
+// copyOriginalsToPrivate copies the public originals to the private store and points
+// the database at the copies. The public copies are kept until deletePublicCopies.
+func (h *Handler) copyOriginalsToPrivate(w http.ResponseWriter, r *http.Request) {
+	report, err := h.findPublicOriginals()
+	if err != nil {
+		h.handleError(w, "Failed to look for public originals", http.StatusInternalServerError, err)
+		return
+	}
+
+	moved, err := h.ImageUploader.CopyOriginalsToPrivate(report.Public, func(from []string, to string) error {
+		for _, url := range from {
+			if err := h.DB.ReplaceImageURL(url, to); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if moved > 0 {
+		log.Printf("Copied %d originals to the private store", moved)
+	}
+	if err != nil {
+		h.handleError(w, "Failed to copy the originals", http.StatusInternalServerError, err)
+		return
+	}
+
+	report, err = h.findPublicOriginals()
+	if err != nil {
+		h.handleError(w, "Failed to look for public originals", http.StatusInternalServerError, err)
+		return
+	}
+	report.Moved = moved
+	h.render(w, r, pages.PublicOriginalsReport(report), true)
+}
+
+// deletePublicCopies deletes the public copies of the originals in the private store.
+// The report is made from the database as it is now, so only copies nothing refers
+// to any more are deleted.
+func (h *Handler) deletePublicCopies(w http.ResponseWriter, r *http.Request) {
+	report, err := h.findPublicOriginals()
+	if err != nil {
+		h.handleError(w, "Failed to look for public originals", http.StatusInternalServerError, err)
+		return
+	}
+
+	deleted, err := h.ImageUploader.DeletePublicCopies(report.Copied)
+	if deleted > 0 {
+		log.Printf("Deleted %d public copies of originals", deleted)
+	}
+	if err != nil {
+		h.handleError(w, "Failed to delete the public copies", http.StatusInternalServerError, err)
+		return
+	}
+
+	report, err = h.findPublicOriginals()
+	if err != nil {
+		h.handleError(w, "Failed to look for public originals", http.StatusInternalServerError, err)
+		return
+	}
+	report.Deleted = deleted
+	h.render(w, r, pages.PublicOriginalsReport(report), true)
+}
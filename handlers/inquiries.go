@@ -0,0 +1,211 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/sebwib/emma-site-htmx/components/pages"
+	"github.com/sebwib/emma-site-htmx/db"
+	"github.com/sebwib/emma-site-htmx/middleware"
+	"github.com/sebwib/emma-site-htmx/services"
+)
+
+func (h *Handler) RegisterInquiryRoutes(r chi.Router, store *middleware.SessionStore) {
+	r.Get("/inquiry", h.inquiryForm)
+	r.Post("/inquiry", h.sendInquiry)
+
+	r.Group(func(r chi.Router) {
+		r.Use(middleware.RequireAuth(store))
+		r.Get("/edit/inquiries", h.inquiriesPage)
+		r.Post("/edit/inquiries/{id}/answered", h.setInquiryAnswered)
+		r.Post("/edit/inquiries/{id}/convert", h.convertInquiry)
+	})
+}
+
+func (h *Handler) inquiryForm(w http.ResponseWriter, r *http.Request) {
+	h.render(w, r, pages.InquiryForm(r.URL.Query().Get("art_id"), services.InquiryForm{}, nil), true)
+}
+
+func (h *Handler) sendInquiry(w http.ResponseWriter, r *http.Request) {
+	artID := r.FormValue("art_id")
+	form := services.InquiryForm{
+		Name:    r.FormValue(services.InquiryFieldName),
+		Email:   r.FormValue(services.InquiryFieldEmail),
+		Message: r.FormValue(services.InquiryFieldMessage),
+	}.Normalize()
+
+	if fieldErrors := services.ValidateInquiryForm(form); len(fieldErrors) > 0 {
+		h.render(w, r, pages.InquiryForm(artID, form, fieldErrors), true)
+		return
+	}
+
+	inquiry := db.Inquiry{
+		Name:    form.Name,
+		Email:   strings.ToLower(form.Email),
+		Message: form.Message,
+	}
+	if artID != "" {
+		art, err := h.DB.GetArtById(artID)
+		if err != nil {
+			h.handleError(w, "Verket hittades inte", http.StatusNotFound, err)
+			return
+		}
+		inquiry.ArtID = art.Id
+		inquiry.ArtTitle = art.Title
+	}
+
+	inquiry, err := h.DB.AddInquiry(inquiry)
+	if err != nil {
+		h.handleError(w, "Kunde inte skicka meddelandet", http.StatusInternalServerError, err)
+		return
+	}
+
+	if err := services.SendInquiry(inquiry); err != nil {
+		// the inquiry is in the admin inbox even when the email fails
+		log.Printf("Failed to send inquiry email: %v", err)
+	}
+
+	h.render(w, r, pages.InquiryThanks(artID), true)
+}
+
+func (h *Handler) inquiriesPage(w http.ResponseWriter, r *http.Request) {
+	inquiries, err := h.DB.GetInquiries()
+	if err != nil {
+		h.handleError(w, "Failed to load inquiries", http.StatusInternalServerError, err)
+		return
+	}
+
+	arts, err := h.DB.GetArts()
+	if err != nil {
+		h.handleError(w, "Failed to load art", http.StatusInternalServerError, err)
+		return
+	}
+	artsByID := make(map[string]db.Art, len(arts))
+	for _, art := range arts {
+		artsByID[art.Id] = art
+	}
+
+	h.render(w, r, pages.Inquiries(inquiries, artsByID), false)
+}
+
+// renderInquiryRow renders the inquiry's row of the inbox
+func (h *Handler) renderInquiryRow(w http.ResponseWriter, r *http.Request, inquiryID string) {
+	inquiry, err := h.DB.GetInquiry(inquiryID)
+	if err != nil {
+		h.handleError(w, "Inquiry not found", http.StatusNotFound, err)
+		return
+	}
+
+	var art db.Art
+	if inquiry.ArtID != "" {
+		if found, err := h.DB.GetArtById(inquiry.ArtID); err == nil {
+			art = *found
+		}
+	}
+
+	h.render(w, r, pages.InquiryRow(inquiry, art), true)
+}
+
+func (h *Handler) setInquiryAnswered(w http.ResponseWriter, r *http.Request) {
+	inquiryID := chi.URLParam(r, "id")
+
+	answered := r.FormValue("answered") == "true"
+
+	if err := h.DB.SetInquiryAnswered(inquiryID, answered); err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			h.handleError(w, "Inquiry not found", http.StatusNotFound, err)
+		case errors.Is(err, db.ErrInquiryConverted):
+			h.handleError(w, "Inquiry has already been converted to an order", http.StatusConflict, err)
+		default:
+			h.handleError(w, "Failed to update inquiry", http.StatusInternalServerError, err)
+		}
+		return
+	}
+
+	h.renderInquiryRow(w, r, inquiryID)
+}
+
+// convertInquiry places an order for the inquired original at the agreed price and
+// sends the buyer the order confirmation. Delivery is arranged with the buyer, so
+// the order has no shipping cost.
+func (h *Handler) convertInquiry(w http.ResponseWriter, r *http.Request) {
+	inquiry, err := h.DB.GetInquiry(chi.URLParam(r, "id"))
+	if err != nil {
+		h.handleError(w, "Inquiry not found", http.StatusNotFound, err)
+		return
+	}
+	if inquiry.ArtID == "" {
+		http.Error(w, "Inquiry is not about an artwork", http.StatusBadRequest)
+		return
+	}
+
+	art, err := h.DB.GetArtById(inquiry.ArtID)
+	if err != nil {
+		h.handleError(w, "Art not found", http.StatusNotFound, err)
+		return
+	}
+
+	price, err := strconv.ParseFloat(r.FormValue("price"), 64)
+	if err != nil || price <= 0 {
+		http.Error(w, "Invalid price", http.StatusBadRequest)
+		return
+	}
+
+	orderID := uuid.NewString()
+	accessToken, err := db.NewOrderAccessToken()
+	if err != nil {
+		h.handleError(w, "Failed to create order", http.StatusInternalServerError, err)
+		return
+	}
+
+	row := db.OrderRow{
+		UUID:      uuid.NewString(),
+		OrderID:   orderID,
+		CreatedAt: time.Now().Format(time.RFC3339),
+		Email:     inquiry.Email,
+		PrintID:   art.Id,
+		Title:     art.Title + " (original)",
+		Typ:       services.CartItemTypeOriginal,
+		Quantity:  1,
+		Price:     price,
+		Status:    db.OrderStatusPlaced,
+	}
+	details := db.OrderDetails{
+		OrderID:      orderID,
+		Country:      services.DefaultShippingCountry,
+		ShippingZone: string(services.ShippingZoneForCountry(services.DefaultShippingCountry)),
+		AccessToken:  accessToken,
+		BuyerName:    inquiry.Name,
+	}
+
+	if err := h.DB.ConvertInquiryToOrder(inquiry.UUID, row, details); err != nil {
+		switch {
+		case errors.Is(err, db.ErrInquiryConverted):
+			h.handleError(w, "Inquiry has already been converted to an order", http.StatusConflict, err)
+		case errors.Is(err, db.ErrArtUnavailable):
+			h.handleError(w, "The artwork is sold or reserved for another order", http.StatusConflict, err)
+		default:
+			h.handleError(w, "Failed to create order", http.StatusInternalServerError, err)
+		}
+		return
+	}
+
+	order, err := h.DB.GetOrderByID(orderID)
+	if err != nil {
+		h.handleError(w, "Failed to load order", http.StatusInternalServerError, err)
+		return
+	}
+	if err := services.SendOrderConfirmation(order, h.paymentInstructions()); err != nil {
+		log.Printf("Failed to send order confirmation: %v", err)
+	}
+
+	w.Header().Set("HX-Redirect", "/orders")
+}
@@ -0,0 +1,228 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/sebwib/emma-site-htmx/components/pages"
+	"github.com/sebwib/emma-site-htmx/components/partial"
+	"github.com/sebwib/emma-site-htmx/db"
+	"github.com/sebwib/emma-site-htmx/lib/markdown"
+	"github.com/sebwib/emma-site-htmx/middleware"
+	"github.com/sebwib/emma-site-htmx/services"
+)
+
+func (h *Handler) RegisterNewsletterRoutes(r chi.Router, store *middleware.SessionStore) {
+	r.Post("/newsletter/subscribe", h.subscribeNewsletter)
+	r.Get("/newsletter/confirm/{token}", h.confirmNewsletter)
+	r.Get("/newsletter/unsubscribe/{token}", h.unsubscribeNewsletterPage)
+	r.Post("/newsletter/unsubscribe/{token}", h.unsubscribeNewsletter)
+
+	r.Group(func(r chi.Router) {
+		r.Use(middleware.RequireAuth(store))
+		r.Get("/edit/newsletter", h.newslettersPage)
+		r.Post("/edit/newsletter", h.saveNewsletter)
+		r.Post("/edit/newsletter/preview", h.previewNewsletter)
+		r.Get("/edit/newsletter/{id}", h.newsletterRow)
+		r.Post("/edit/newsletter/{id}/send", h.sendNewsletter)
+	})
+}
+
+// subscribe signs the email up and sends the confirmation email. Signing up again
+// while pending only sends another one after a day.
+func (h *Handler) subscribe(email string, source string) error {
+	subscriber, sendConfirmation, err := h.DB.AddSubscriber(strings.ToLower(email), source)
+	if err != nil {
+		return err
+	}
+	if !sendConfirmation {
+		return nil
+	}
+
+	if err := services.SendNewsletterConfirmation(subscriber); err != nil {
+		log.Printf("Failed to send newsletter confirmation to %s: %v", subscriber.Email, err)
+	}
+	return nil
+}
+
+func (h *Handler) subscribeNewsletter(w http.ResponseWriter, r *http.Request) {
+	email := strings.TrimSpace(r.FormValue("email"))
+	if !services.IsValidEmail(email) {
+		h.render(w, r, partial.NewsletterSignup("Ange en giltig e-postadress"), true)
+		return
+	}
+
+	if err := h.subscribe(email, "footer"); err != nil {
+		h.handleError(w, "Kunde inte spara prenumerationen", http.StatusInternalServerError, err)
+		return
+	}
+
+	// the same answer whether or not the email was already subscribed
+	h.render(w, r, partial.NewsletterSignupThanks(), true)
+}
+
+func (h *Handler) confirmNewsletter(w http.ResponseWriter, r *http.Request) {
+	_, err := h.DB.ConfirmSubscriber(chi.URLParam(r, "token"))
+	if errors.Is(err, sql.ErrNoRows) {
+		h.handleError(w, "Länken är ogiltig", http.StatusNotFound, err)
+		return
+	}
+	if err != nil {
+		h.handleError(w, "Kunde inte bekräfta prenumerationen", http.StatusInternalServerError, err)
+		return
+	}
+
+	h.render(w, r, pages.NewsletterConfirmed(), false)
+}
+
+func (h *Handler) unsubscribeNewsletterPage(w http.ResponseWriter, r *http.Request) {
+	h.render(w, r, pages.NewsletterUnsubscribe(chi.URLParam(r, "token"), false), false)
+}
+
+func (h *Handler) unsubscribeNewsletter(w http.ResponseWriter, r *http.Request) {
+	err := h.DB.Unsubscribe(chi.URLParam(r, "token"))
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		h.handleError(w, "Kunde inte avsluta prenumerationen", http.StatusInternalServerError, err)
+		return
+	}
+
+	h.render(w, r, pages.NewsletterUnsubscribe("", true), true)
+}
+
+func (h *Handler) newslettersPage(w http.ResponseWriter, r *http.Request) {
+	newsletters, err := h.DB.GetNewsletters()
+	if err != nil {
+		h.handleError(w, "Failed to load newsletters", http.StatusInternalServerError, err)
+		return
+	}
+
+	counts, err := h.DB.CountSubscribers()
+	if err != nil {
+		h.handleError(w, "Failed to count subscribers", http.StatusInternalServerError, err)
+		return
+	}
+
+	// ?id= loads a draft into the composer
+	var draft db.Newsletter
+	if id := r.URL.Query().Get("id"); id != "" {
+		draft, err = h.DB.GetNewsletter(id)
+		if err != nil || draft.Status != db.NewsletterStatusDraft {
+			h.handleError(w, "Draft not found", http.StatusNotFound, err)
+			return
+		}
+	}
+
+	h.render(w, r, pages.Newsletters(newsletters, counts, draft), false)
+}
+
+func (h *Handler) saveNewsletter(w http.ResponseWriter, r *http.Request) {
+	subject := strings.TrimSpace(r.FormValue("subject"))
+	body := strings.TrimSpace(r.FormValue("body"))
+	if subject == "" || body == "" {
+		http.Error(w, "Subject and body are required", http.StatusBadRequest)
+		return
+	}
+
+	if id := r.FormValue("id"); id != "" {
+		if err := h.DB.UpdateNewsletter(id, subject, body); err != nil {
+			h.handleError(w, "Failed to save newsletter", http.StatusConflict, err)
+			return
+		}
+	} else if _, err := h.DB.AddNewsletter(subject, body); err != nil {
+		h.handleError(w, "Failed to save newsletter", http.StatusInternalServerError, err)
+		return
+	}
+
+	w.Header().Set("HX-Redirect", "/edit/newsletter")
+}
+
+func (h *Handler) previewNewsletter(w http.ResponseWriter, r *http.Request) {
+	h.render(w, r, pages.NewsletterPreview(markdown.ToHTML(r.FormValue("body"))), true)
+}
+
+func (h *Handler) newsletterRow(w http.ResponseWriter, r *http.Request) {
+	newsletter, err := h.DB.GetNewsletter(chi.URLParam(r, "id"))
+	if err != nil {
+		h.handleError(w, "Newsletter not found", http.StatusNotFound, err)
+		return
+	}
+
+	h.render(w, r, pages.NewsletterRow(newsletter), true)
+}
+
+func (h *Handler) sendNewsletter(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+
+	if err := h.DB.QueueNewsletter(id); err != nil {
+		if errors.Is(err, db.ErrNewsletterNotDraft) {
+			h.handleError(w, "Newsletter has already been sent", http.StatusConflict, err)
+			return
+		}
+		h.handleError(w, "Failed to queue newsletter", http.StatusInternalServerError, err)
+		return
+	}
+
+	go h.deliverNewsletter(id)
+
+	h.newsletterRow(w, r)
+}
+
+// ResumeNewsletters continues sends that were interrupted by a restart
+func (h *Handler) ResumeNewsletters() {
+	newsletters, err := h.DB.GetSendingNewsletters()
+	if err != nil {
+		log.Printf("Failed to load newsletters being sent: %v", err)
+		return
+	}
+
+	for _, newsletter := range newsletters {
+		go h.deliverNewsletter(newsletter.UUID)
+	}
+}
+
+// deliverNewsletter sends the pending deliveries one at a time with a pause between
+// them, and marks the newsletter as sent when none are left
+func (h *Handler) deliverNewsletter(id string) {
+	if _, running := h.newsletterSenders.LoadOrStore(id, true); running {
+		return
+	}
+	defer h.newsletterSenders.Delete(id)
+
+	newsletter, err := h.DB.GetNewsletter(id)
+	if err != nil {
+		log.Printf("Failed to load newsletter %s: %v", id, err)
+		return
+	}
+
+	for {
+		delivery, err := h.DB.NextNewsletterDelivery(id)
+		if errors.Is(err, sql.ErrNoRows) {
+			break
+		}
+		if err != nil {
+			log.Printf("Failed to load next delivery of newsletter %s: %v", id, err)
+			return
+		}
+
+		status, deliveryError := db.DeliveryStatusSent, ""
+		if err := services.SendNewsletter(newsletter, delivery); err != nil {
+			log.Printf("Failed to send newsletter to %s: %v", delivery.Email, err)
+			status, deliveryError = db.DeliveryStatusFailed, err.Error()
+		}
+		if err := h.DB.SetNewsletterDeliveryStatus(delivery.UUID, status, deliveryError); err != nil {
+			log.Printf("Failed to store newsletter delivery: %v", err)
+			return
+		}
+
+		time.Sleep(services.NewsletterSendInterval)
+	}
+
+	if err := h.DB.FinishNewsletter(id); err != nil {
+		log.Printf("Failed to finish newsletter %s: %v", id, err)
+	}
+}
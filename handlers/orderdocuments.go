@@ -0,0 +1,148 @@
+package handlers
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/sebwib/emma-site-htmx/components/pages"
+	"github.com/sebwib/emma-site-htmx/db"
+	"github.com/sebwib/emma-site-htmx/middleware"
+	"github.com/sebwib/emma-site-htmx/services"
+)
+
+// RegisterOrderDocumentRoutes adds the packing slip and invoice routes. The PDFs
+// hold the buyer's address and contact details, and invoices get numbers and are
+// emailed, so they are for the admin only.
+func (h *Handler) RegisterOrderDocumentRoutes(r chi.Router, store *middleware.SessionStore) {
+	r.Group(func(r chi.Router) {
+		r.Use(middleware.RequireAuth(store))
+		r.Get("/orders/{orderID}/packing-slip.pdf", h.packingSlip)
+		r.Get("/orders/{orderID}/invoice.pdf", h.invoice)
+		r.Post("/orders/{orderID}/send_invoice", h.sendInvoice)
+	})
+}
+
+func (h *Handler) storedText(referenceID string) string {
+	texts, err := h.DB.GetStoredTextByReferenceID(referenceID)
+	if err != nil || len(texts) == 0 {
+		return ""
+	}
+	return texts[0].Content
+}
+
+func (h *Handler) sellerDetails() services.SellerDetails {
+	return services.NewSellerDetails(h.storedText("seller_details"), h.storedText("invoice_terms"))
+}
+
+// orderThumbnails loads small JPEG versions of the pictures on each order row
+func (h *Handler) orderThumbnails(order db.Order) map[string][]byte {
+	thumbnails := make(map[string][]byte, len(order.Rows))
+	for _, row := range order.Rows {
+		var thumbURL string
+		switch row.Typ {
+		case services.CartItemTypePrint:
+			print, err := h.DB.GetPrintById(row.PrintID)
+			if err != nil {
+				continue
+			}
+			thumbURL = print.ThumbURL
+		case services.CartItemTypeOriginal:
+			art, err := h.DB.GetArtById(row.PrintID)
+			if err != nil {
+				continue
+			}
+			thumbURL = art.ThumbURL
+		default:
+			continue
+		}
+
+		data, err := h.ImageUploader.ReadImage(thumbURL)
+		if err != nil {
+			log.Printf("Failed to read thumbnail %s: %v", thumbURL, err)
+			continue
+		}
+		thumbnail, err := services.ThumbnailJPEG(data)
+		if err != nil {
+			log.Printf("Failed to scale thumbnail %s: %v", thumbURL, err)
+			continue
+		}
+		thumbnails[row.UUID] = thumbnail
+	}
+	return thumbnails
+}
+
+func writePDF(w http.ResponseWriter, filename string, data []byte) {
+	w.Header().Set("Content-Type", "application/pdf")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("inline; filename=%q", filename))
+	w.Write(data)
+}
+
+func (h *Handler) packingSlip(w http.ResponseWriter, r *http.Request) {
+	order, err := h.DB.GetOrderByID(chi.URLParam(r, "orderID"))
+	if err != nil || order.OrderID == "" {
+		h.handleError(w, "Order not found", http.StatusNotFound, err)
+		return
+	}
+
+	data, err := services.PackingSlipPDF(order, h.sellerDetails(), h.orderThumbnails(order))
+	if err != nil {
+		h.handleError(w, "Failed to create packing slip", http.StatusInternalServerError, err)
+		return
+	}
+
+	writePDF(w, "foljesedel-"+services.OrderNumber(order)+".pdf", data)
+}
+
+// invoiceForOrder assigns an invoice number if needed and renders the invoice
+func (h *Handler) invoiceForOrder(orderID string) (db.Order, []byte, error) {
+	if _, _, err := h.DB.AssignInvoiceNumber(orderID); err != nil {
+		return db.Order{}, nil, err
+	}
+
+	order, err := h.DB.GetOrderByID(orderID)
+	if err != nil {
+		return db.Order{}, nil, err
+	}
+
+	data, err := services.InvoicePDF(order, h.sellerDetails())
+	return order, data, err
+}
+
+func (h *Handler) invoice(w http.ResponseWriter, r *http.Request) {
+	order, err := h.DB.GetOrderByID(chi.URLParam(r, "orderID"))
+	if err != nil || order.OrderID == "" {
+		h.handleError(w, "Order not found", http.StatusNotFound, err)
+		return
+	}
+
+	order, data, err := h.invoiceForOrder(order.OrderID)
+	if err != nil {
+		h.handleError(w, "Failed to create invoice", http.StatusInternalServerError, err)
+		return
+	}
+
+	writePDF(w, services.InvoiceFilename(order), data)
+}
+
+func (h *Handler) sendInvoice(w http.ResponseWriter, r *http.Request) {
+	order, err := h.DB.GetOrderByID(chi.URLParam(r, "orderID"))
+	if err != nil || order.OrderID == "" {
+		h.handleError(w, "Order not found", http.StatusNotFound, err)
+		return
+	}
+
+	order, data, err := h.invoiceForOrder(order.OrderID)
+	if err != nil {
+		h.handleError(w, "Failed to create invoice", http.StatusInternalServerError, err)
+		return
+	}
+
+	if err := services.SendInvoice(order, data); err != nil {
+		h.handleError(w, "Failed to send invoice", http.StatusInternalServerError, err)
+		return
+	}
+
+	h.render(w, r, pages.OrderSingle(order), true)
+}
@@ -1,22 +1,84 @@
 package handlers
 
 import (
+	"errors"
+	"log"
 	"net/http"
+	"slices"
+	"strings"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/sebwib/emma-site-htmx/components/pages"
+	"github.com/sebwib/emma-site-htmx/db"
 	"github.com/sebwib/emma-site-htmx/middleware"
+	"github.com/sebwib/emma-site-htmx/services"
 )
 
 func (h *Handler) RegisterOrderRoutes(r chi.Router, store *middleware.SessionStore) {
+	r.Get("/order/{token}", h.buyerOrderPage)
+	r.Post("/order/{token}/cancel", h.cancelBuyerOrder)
+
 	r.Group(func(r chi.Router) {
-		//r.Use(middleware.RequireAuth(store))
+		r.Use(middleware.RequireAuth(store))
 		r.Get("/orders", h.ordersPage)
 		r.Post("/orders/{orderID}/update_status", h.updateOrderStatus)
+		r.Post("/orders/{orderID}/cancel", h.cancelOrder)
 		r.Post("/orders/{orderID}/row/{rowID}/toggle_paid", h.toggleOrderRowPaid)
 	})
 }
 
+func (h *Handler) paymentInstructions() string {
+	return h.storedText("payment_instructions")
+}
+
+func (h *Handler) renderBuyerOrder(w http.ResponseWriter, r *http.Request, order db.Order, raw bool) {
+	events, err := h.DB.GetOrderEvents(order.OrderID)
+	if err != nil {
+		h.handleError(w, "Kunde inte hämta beställningen", http.StatusInternalServerError, err)
+		return
+	}
+
+	h.render(w, r, pages.BuyerOrder(order, events, h.paymentInstructions()), raw)
+}
+
+func (h *Handler) buyerOrderPage(w http.ResponseWriter, r *http.Request) {
+	order, err := h.DB.GetOrderByAccessToken(chi.URLParam(r, "token"))
+	if err != nil || order.OrderID == "" {
+		h.handleError(w, "Beställningen hittades inte", http.StatusNotFound, err)
+		return
+	}
+
+	h.renderBuyerOrder(w, r, order, false)
+}
+
+func (h *Handler) cancelBuyerOrder(w http.ResponseWriter, r *http.Request) {
+	order, err := h.DB.GetOrderByAccessToken(chi.URLParam(r, "token"))
+	if err != nil || order.OrderID == "" {
+		h.handleError(w, "Beställningen hittades inte", http.StatusNotFound, err)
+		return
+	}
+
+	inStock := h.orderPrintsInStock(order)
+	if err := h.DB.CancelOrder(order.OrderID); err != nil {
+		if errors.Is(err, db.ErrOrderNotCancellable) {
+			h.handleError(w, "Beställningen kan inte längre avbeställas", http.StatusConflict, err)
+			return
+		}
+		h.handleError(w, "Kunde inte avbeställa", http.StatusInternalServerError, err)
+		return
+	}
+
+	h.notifyWaitlistsIfRestocked(inStock)
+
+	order, err = h.DB.GetOrderByID(order.OrderID)
+	if err != nil {
+		h.handleError(w, "Kunde inte hämta beställningen", http.StatusInternalServerError, err)
+		return
+	}
+
+	h.renderBuyerOrder(w, r, order, true)
+}
+
 func (h *Handler) ordersPage(w http.ResponseWriter, r *http.Request) {
 	orders, err := h.DB.GetAllOrders()
 	if err != nil {
@@ -31,18 +93,94 @@ func (h *Handler) updateOrderStatus(w http.ResponseWriter, r *http.Request) {
 	orderID := chi.URLParam(r, "orderID")
 
 	orderStatus := r.FormValue("order_status")
-	err := h.DB.UpdateOrderStatus(orderID, orderStatus)
+	previous, err := h.DB.GetOrderByID(orderID)
+	if err != nil {
+		h.handleError(w, "Failed to get order", 500, err)
+		return
+	}
+
+	if r.Form.Has("tracking_number") {
+		carrier := services.Carrier(r.FormValue("carrier"))
+		if carrier != "" && !slices.Contains(services.Carriers, carrier) {
+			http.Error(w, "Unknown carrier", http.StatusBadRequest)
+			return
+		}
+		trackingNumber := strings.TrimSpace(r.FormValue("tracking_number"))
+		if err := h.DB.SetOrderTracking(orderID, string(carrier), trackingNumber); err != nil {
+			h.handleError(w, "Failed to update tracking", 500, err)
+			return
+		}
+	}
+
+	if orderStatus != "" {
+		err = h.DB.UpdateOrderStatus(orderID, orderStatus)
+		if errors.Is(err, db.ErrInvalidOrderStatus) {
+			http.Error(w, "Invalid order status", http.StatusBadRequest)
+			return
+		}
+		if err != nil {
+			h.handleError(w, "Failed to update order status", 500, err)
+			return
+		}
+	}
+
+	order, err := h.DB.GetOrderByID(orderID)
+	if err != nil {
+		h.handleError(w, "Failed to get order", 500, err)
+		return
+	}
+
+	if order.Status != previous.Status {
+		note := ""
+		if order.Status == db.OrderStatusShipped && order.TrackingNumber != "" {
+			note = services.CarrierName(services.Carrier(order.Carrier)) + " " + order.TrackingNumber
+		}
+		if err := h.DB.AddOrderEvent(orderID, db.OrderEventKind(order.Status), note); err != nil {
+			log.Printf("Failed to store order event: %v", err)
+		}
+
+		if order.Status == db.OrderStatusShipped {
+			if err := services.SendOrderShipped(order); err != nil {
+				log.Printf("Failed to send shipped email for order %s: %v", orderID, err)
+			}
+		}
+	}
+
+	h.render(w, r, pages.OrderSingle(order), true)
+}
+
+// cancelOrder cancels an unpaid order for the admin, releasing its stock and
+// reserved originals, and lets the buyer know
+func (h *Handler) cancelOrder(w http.ResponseWriter, r *http.Request) {
+	orderID := chi.URLParam(r, "orderID")
+	previous, err := h.DB.GetOrderByID(orderID)
 	if err != nil {
-		h.handleError(w, "Failed to update order status", 500, err)
+		h.handleError(w, "Failed to get order", 500, err)
+		return
+	}
+	inStock := h.orderPrintsInStock(previous)
+
+	if err := h.DB.CancelUnpaidOrder(orderID); err != nil {
+		if errors.Is(err, db.ErrOrderNotCancellable) {
+			h.handleError(w, "Order can't be cancelled once something is paid or shipped", http.StatusConflict, err)
+			return
+		}
+		h.handleError(w, "Failed to cancel order", 500, err)
 		return
 	}
 
+	h.notifyWaitlistsIfRestocked(inStock)
+
 	order, err := h.DB.GetOrderByID(orderID)
 	if err != nil {
 		h.handleError(w, "Failed to get order", 500, err)
 		return
 	}
 
+	if err := services.SendOrderCancelled(order); err != nil {
+		log.Printf("Failed to send cancellation email for order %s: %v", orderID, err)
+	}
+
 	h.render(w, r, pages.OrderSingle(order), true)
 }
 
@@ -55,7 +193,22 @@ func (h *Handler) toggleOrderRowPaid(w http.ResponseWriter, r *http.Request) {
 	if hasPaidStr == "true" || hasPaidStr == "on" || hasPaidStr == "1" {
 		hasPaid = true
 	}
-	err := h.DB.UpdateOrderPaidStatus(rowID, hasPaid)
+	previous, err := h.DB.GetOrderByID(orderID)
+	if err != nil {
+		h.handleError(w, "Failed to get order", 500, err)
+		return
+	}
+	// paying a cancelled order would sell its released art and issue gift cards
+	if previous.Status == db.OrderStatusCancelled {
+		h.handleError(w, "Order is cancelled", http.StatusConflict, nil)
+		return
+	}
+
+	err = h.DB.UpdateOrderPaidStatus(rowID, hasPaid)
+	if errors.Is(err, db.ErrOrderCancelled) {
+		h.handleError(w, "Order is cancelled", http.StatusConflict, nil)
+		return
+	}
 	if err != nil {
 		h.handleError(w, "Failed to toggle order row paid status", 500, err)
 		return
@@ -67,6 +220,61 @@ func (h *Handler) toggleOrderRowPaid(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if order.HasPaidAll && !previous.HasPaidAll {
+		if err := h.DB.AddOrderEvent(orderID, db.OrderEventPaid, ""); err != nil {
+			log.Printf("Failed to store order event: %v", err)
+		}
+	}
+
+	if hasPaid {
+		for _, row := range order.Rows {
+			if row.UUID != rowID {
+				continue
+			}
+			switch row.Typ {
+			case services.CartItemTypeGiftCard:
+				if err := h.issueGiftCards(row); err != nil {
+					h.handleError(w, "Failed to issue gift cards", 500, err)
+					return
+				}
+			case services.CartItemTypeOriginal:
+				if err := h.DB.MarkArtSold(row.PrintID); err != nil {
+					h.handleError(w, "Failed to mark art as sold", 500, err)
+					return
+				}
+			case services.CartItemTypeCommission:
+				if err := h.DB.StartCommissionForOrder(row.OrderID); err != nil {
+					h.handleError(w, "Failed to start commission", 500, err)
+					return
+				}
+			}
+		}
+	}
+
 	h.render(w, r, pages.OrderSingle(order), true)
 	w.WriteHeader(http.StatusOK)
 }
+
+// issueGiftCards creates the cards bought on a paid order row, once per row
+func (h *Handler) issueGiftCards(row db.OrderRow) error {
+	issued, err := h.DB.GetGiftCardsForOrderRow(row.UUID)
+	if err != nil {
+		return err
+	}
+
+	for i := len(issued); i < row.Quantity; i++ {
+		card, err := h.DB.AddGiftCard(db.GiftCard{
+			InitialAmount: row.Price,
+			Email:         row.Email,
+			OrderRowID:    row.UUID,
+		})
+		if err != nil {
+			return err
+		}
+
+		if err := services.SendGiftCard(row.Email, card); err != nil {
+			log.Printf("Failed to send gift card %s: %v", card.Code, err)
+		}
+	}
+	return nil
+}
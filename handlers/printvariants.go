@@ -0,0 +1,144 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/sebwib/emma-site-htmx/components/pages"
+	"github.com/sebwib/emma-site-htmx/db"
+	"github.com/sebwib/emma-site-htmx/middleware"
+)
+
+func (h *Handler) RegisterPrintVariantRoutes(r chi.Router, store *middleware.SessionStore) {
+	r.Group(func(r chi.Router) {
+		r.Use(middleware.RequireAuth(store))
+		r.Post("/edit/print/{id}/variants", h.createPrintVariant)
+		r.Patch("/edit/print/{id}/variants/{variantID}", h.patchPrintVariant)
+		r.Delete("/edit/print/{id}/variants/{variantID}", h.deletePrintVariant)
+	})
+}
+
+func (h *Handler) renderPrintVariants(w http.ResponseWriter, r *http.Request, printID string) {
+	variants, err := h.DB.GetPrintVariants(printID)
+	if err != nil {
+		h.handleError(w, "Failed to load print variants", http.StatusInternalServerError, err)
+		return
+	}
+
+	h.render(w, r, pages.PrintVariants(printID, variants), true)
+}
+
+func (h *Handler) createPrintVariant(w http.ResponseWriter, r *http.Request) {
+	printID := chi.URLParam(r, "id")
+
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Failed to parse form", http.StatusBadRequest)
+		return
+	}
+
+	name := r.FormValue("name")
+	if name == "" {
+		http.Error(w, "Name is required", http.StatusBadRequest)
+		return
+	}
+
+	price, err := strconv.ParseFloat(r.FormValue("price"), 64)
+	if err != nil || price < 0 {
+		http.Error(w, "Invalid price", http.StatusBadRequest)
+		return
+	}
+
+	width, _ := strconv.Atoi(r.FormValue("width"))
+	height, _ := strconv.Atoi(r.FormValue("height"))
+	quantityLeft, _ := strconv.Atoi(r.FormValue("quantity_left"))
+	ordering, _ := strconv.Atoi(r.FormValue("ordering"))
+	framed, _ := formBool(r, "framed")
+
+	variant := db.PrintVariant{
+		PrintID:      printID,
+		Name:         name,
+		SKU:          r.FormValue("sku"),
+		Width:        width,
+		Height:       height,
+		Framed:       framed,
+		Price:        price,
+		QuantityLeft: quantityLeft,
+		Ordering:     ordering,
+	}
+
+	wasInStock := h.printInStock(printID)
+
+	if err := h.DB.AddPrintVariant(variant); err != nil {
+		h.handleError(w, "Failed to create print variant", http.StatusInternalServerError, err)
+		return
+	}
+
+	h.notifyWaitlistIfRestocked(printID, wasInStock)
+
+	h.renderPrintVariants(w, r, printID)
+}
+
+func (h *Handler) patchPrintVariant(w http.ResponseWriter, r *http.Request) {
+	printID := chi.URLParam(r, "id")
+	variantID := chi.URLParam(r, "variantID")
+
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Failed to parse form", http.StatusBadRequest)
+		return
+	}
+
+	var patch db.PrintVariantPatch
+	if name := r.FormValue("name"); name != "" {
+		patch.Name = &name
+	}
+	if r.Form.Has("sku") {
+		sku := r.FormValue("sku")
+		patch.SKU = &sku
+	}
+	if width, err := strconv.Atoi(r.FormValue("width")); err == nil {
+		patch.Width = &width
+	}
+	if height, err := strconv.Atoi(r.FormValue("height")); err == nil {
+		patch.Height = &height
+	}
+	if price, err := strconv.ParseFloat(r.FormValue("price"), 64); err == nil {
+		patch.Price = &price
+	}
+	if quantityLeft, err := strconv.Atoi(r.FormValue("quantity_left")); err == nil {
+		patch.QuantityLeft = &quantityLeft
+	}
+	if ordering, err := strconv.Atoi(r.FormValue("ordering")); err == nil {
+		patch.Ordering = &ordering
+	}
+	if framed, ok := formBool(r, "framed"); ok {
+		patch.Framed = &framed
+	}
+
+	wasInStock := h.printInStock(printID)
+
+	if err := h.DB.UpdatePrintVariant(variantID, patch); err != nil {
+		h.handleError(w, "Failed to update print variant", http.StatusInternalServerError, err)
+		return
+	}
+
+	h.notifyWaitlistIfRestocked(printID, wasInStock)
+
+	h.renderPrintVariants(w, r, printID)
+}
+
+func (h *Handler) deletePrintVariant(w http.ResponseWriter, r *http.Request) {
+	printID := chi.URLParam(r, "id")
+	variantID := chi.URLParam(r, "variantID")
+
+	wasInStock := h.printInStock(printID)
+
+	if err := h.DB.DeletePrintVariant(variantID); err != nil {
+		h.handleError(w, "Failed to delete print variant", http.StatusInternalServerError, err)
+		return
+	}
+
+	h.notifyWaitlistIfRestocked(printID, wasInStock)
+
+	h.renderPrintVariants(w, r, printID)
+}
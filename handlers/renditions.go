@@ -0,0 +1,121 @@
+package handlers
+
+import (
+	"log"
+
+	"github.com/sebwib/emma-site-htmx/db"
+	"github.com/sebwib/emma-site-htmx/services"
+)
+
+// CreateMissingRenditions resizes the art and print images that were uploaded before
+// renditions existed, or before the rendition widths were changed. It runs once at
+// startup and takes a while for a large gallery, so it is started in the background.
+func (h *Handler) CreateMissingRenditions() {
+	arts, err := h.DB.GetArts()
+	if err != nil {
+		log.Printf("Failed to load art for renditions: %v", err)
+		return
+	}
+	prints, err := h.DB.GetAllPrints()
+	if err != nil {
+		log.Printf("Failed to load prints for renditions: %v", err)
+		return
+	}
+	images, err := h.DB.GetAllImages()
+	if err != nil {
+		log.Printf("Failed to load images for renditions: %v", err)
+		return
+	}
+
+	seen := map[string]bool{}
+	created := 0
+	check := func(imageURL string) {
+		if imageURL == "" || seen[imageURL] {
+			return
+		}
+		seen[imageURL] = true
+
+		existing, err := h.DB.GetImageRenditions(imageURL)
+		if err != nil {
+			log.Printf("Failed to load renditions of %s: %v", imageURL, err)
+			return
+		}
+		if !h.ImageUploader.NeedsRenditions(existing) {
+			return
+		}
+
+		data, err := h.ImageUploader.ReadImage(imageURL)
+		if err != nil {
+			log.Printf("Failed to read %s for renditions: %v", imageURL, err)
+			return
+		}
+		renditions, err := h.ImageUploader.CreateRenditions(imageURL, data)
+		if err != nil {
+			log.Printf("Failed to create renditions of %s: %v", imageURL, err)
+			return
+		}
+		if err := h.DB.AddImageRenditions(renditions); err != nil {
+			log.Printf("Failed to save renditions of %s: %v", imageURL, err)
+			return
+		}
+		created++
+	}
+
+	for _, art := range arts {
+		check(art.ImgURL)
+	}
+	for _, print := range prints {
+		check(print.ImgURL)
+	}
+	for _, image := range images {
+		check(image.URL)
+	}
+
+	if created > 0 {
+		log.Printf("Created renditions for %d images", created)
+	}
+}
+
+// CreateMissingPlaceholders makes the placeholders of art that was added before
+// placeholders existed
+func (h *Handler) CreateMissingPlaceholders() {
+	arts, err := h.DB.GetArts()
+	if err != nil {
+		log.Printf("Failed to load art for placeholders: %v", err)
+		return
+	}
+
+	created := 0
+	for _, art := range arts {
+		if art.Placeholder != "" || art.ImgURL == "" {
+			continue
+		}
+
+		data, err := h.ImageUploader.ReadImage(art.ImgURL)
+		if err != nil {
+			log.Printf("Failed to read %s for placeholder: %v", art.ImgURL, err)
+			continue
+		}
+		placeholder, err := services.CreatePlaceholder(data)
+		if err != nil {
+			log.Printf("Failed to create placeholder of %s: %v", art.ImgURL, err)
+			continue
+		}
+
+		patch := db.ArtPatch{
+			Placeholder:   &placeholder.LQIP,
+			DominantColor: &placeholder.DominantColor,
+			ImageWidth:    &placeholder.Width,
+			ImageHeight:   &placeholder.Height,
+		}
+		if err := h.DB.UpdateArt(art.Id, patch); err != nil {
+			log.Printf("Failed to save placeholder of %s: %v", art.Id, err)
+			continue
+		}
+		created++
+	}
+
+	if created > 0 {
+		log.Printf("Created placeholders for %d artworks", created)
+	}
+}
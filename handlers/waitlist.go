@@ -0,0 +1,128 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/sebwib/emma-site-htmx/components/pages"
+	"github.com/sebwib/emma-site-htmx/db"
+	"github.com/sebwib/emma-site-htmx/services"
+)
+
+func (h *Handler) RegisterWaitlistRoutes(r chi.Router) {
+	r.Post("/prints/{id}/waitlist", h.joinWaitlist)
+	r.Get("/waitlist/unsubscribe/{token}", h.unsubscribeWaitlistPage)
+	r.Post("/waitlist/unsubscribe/{token}", h.unsubscribeWaitlist)
+}
+
+func (h *Handler) joinWaitlist(w http.ResponseWriter, r *http.Request) {
+	printID := chi.URLParam(r, "id")
+
+	print, err := h.DB.GetPrintById(printID)
+	if err != nil || !print.ShowInStore {
+		h.handleError(w, "Printen hittades inte", http.StatusNotFound, err)
+		return
+	}
+
+	// the waitlist only ever hears about restocks, a print in stock can just be bought
+	if print.InStock() {
+		h.render(w, r, pages.WaitlistForm(printID, "Printen finns i lager och kan köpas direkt"), true)
+		return
+	}
+
+	email := strings.TrimSpace(r.FormValue("email"))
+	if !services.IsValidEmail(email) {
+		h.render(w, r, pages.WaitlistForm(printID, "Ange en giltig e-postadress"), true)
+		return
+	}
+
+	if err := h.DB.AddToWaitlist(printID, strings.ToLower(email)); err != nil {
+		h.handleError(w, "Kunde inte spara bevakningen", http.StatusInternalServerError, err)
+		return
+	}
+
+	h.render(w, r, pages.WaitlistThanks(printID), true)
+}
+
+func (h *Handler) unsubscribeWaitlistPage(w http.ResponseWriter, r *http.Request) {
+	h.render(w, r, pages.WaitlistUnsubscribe(chi.URLParam(r, "token"), false), false)
+}
+
+func (h *Handler) unsubscribeWaitlist(w http.ResponseWriter, r *http.Request) {
+	if _, err := h.DB.RemoveFromWaitlist(chi.URLParam(r, "token")); err != nil {
+		h.handleError(w, "Kunde inte avsluta bevakningen", http.StatusInternalServerError, err)
+		return
+	}
+
+	h.render(w, r, pages.WaitlistUnsubscribe("", true), true)
+}
+
+// printInStock reports whether the print can be bought right now, false when it can't be loaded
+func (h *Handler) printInStock(printID string) bool {
+	print, err := h.DB.GetPrintById(printID)
+	return err == nil && print.InStock()
+}
+
+// orderPrintsInStock records which of the order's prints are in stock, before
+// cancelling puts the order's stock back
+func (h *Handler) orderPrintsInStock(order db.Order) map[string]bool {
+	inStock := map[string]bool{}
+	for _, row := range order.Rows {
+		if row.Typ == services.CartItemTypePrint {
+			inStock[row.PrintID] = h.printInStock(row.PrintID)
+		}
+	}
+	return inStock
+}
+
+// notifyWaitlistsIfRestocked notifies the waitlists of the prints that were sold out
+// before, see orderPrintsInStock
+func (h *Handler) notifyWaitlistsIfRestocked(inStock map[string]bool) {
+	for printID, wasInStock := range inStock {
+		h.notifyWaitlistIfRestocked(printID, wasInStock)
+	}
+}
+
+// notifyWaitlistIfRestocked emails the print's waitlist when it went from sold out to
+// in stock. The emails are sent in the background so the admin doesn't wait for them.
+func (h *Handler) notifyWaitlistIfRestocked(printID string, wasInStock bool) {
+	if wasInStock {
+		return
+	}
+
+	print, err := h.DB.GetPrintById(printID)
+	if err != nil || !print.InStock() {
+		return
+	}
+
+	entries, err := h.DB.GetPendingWaitlist(printID)
+	if err != nil {
+		log.Printf("Failed to load waitlist for print %s: %v", printID, err)
+		return
+	}
+	if len(entries) == 0 {
+		return
+	}
+
+	go func() {
+		for _, entry := range entries {
+			claimed, err := h.DB.ClaimWaitlistEntry(entry.UUID)
+			if err != nil {
+				log.Printf("Failed to claim waitlist entry %s: %v", entry.UUID, err)
+				continue
+			}
+			if !claimed {
+				continue
+			}
+
+			if err := services.SendBackInStock(entry, print.Title); err != nil {
+				log.Printf("Failed to send back in stock email to %s: %v", entry.Email, err)
+				if err := h.DB.UnclaimWaitlistEntry(entry.UUID); err != nil {
+					log.Printf("Failed to reset waitlist entry %s: %v", entry.UUID, err)
+				}
+			}
+		}
+	}()
+}
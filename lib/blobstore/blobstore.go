@@ -0,0 +1,64 @@
+// Package blobstore stores uploaded files by key. The site uses the local file
+// system in development and an S3 compatible bucket in production, and the image
+// code only talks to the BlobStore interface.
+package blobstore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// ErrNotFound is returned by Get when there is no blob with the key
+var ErrNotFound = errors.New("blob not found")
+
+// Object describes a stored blob
+type Object struct {
+	Key     string
+	Size    int64
+	ModTime time.Time
+}
+
+// BlobStore stores blobs under slash separated keys like "thumb-abc.jpg" or
+// "renditions/abc/800.webp"
+type BlobStore interface {
+	// Put stores data under key, replacing any blob already there
+	Put(ctx context.Context, key string, data []byte, contentType string) error
+	// Get returns the blob, or ErrNotFound
+	Get(ctx context.Context, key string) ([]byte, error)
+	// Delete removes the blob. Deleting a missing blob is not an error.
+	Delete(ctx context.Context, key string) error
+	// URL is the public address of the blob
+	URL(key string) string
+	// List returns the blobs whose key starts with prefix, sorted by key
+	List(ctx context.Context, prefix string) ([]Object, error)
+}
+
+// KeyForURL returns the key of a URL made by store.URL
+func KeyForURL(store BlobStore, url string) (string, bool) {
+	key, ok := strings.CutPrefix(url, store.URL(""))
+	if !ok || key == "" {
+		return "", false
+	}
+	return key, true
+}
+
+// validateKey rejects keys that could escape the store's root
+func validateKey(key string) error {
+	if key == "" || strings.HasPrefix(key, "/") || strings.Contains(key, "\\") {
+		return fmt.Errorf("invalid blob key %q", key)
+	}
+	for _, part := range strings.Split(key, "/") {
+		if part == "" || part == "." || part == ".." {
+			return fmt.Errorf("invalid blob key %q", key)
+		}
+	}
+	return nil
+}
+
+// joinURL joins a base URL and a key with exactly one slash
+func joinURL(base string, key string) string {
+	return strings.TrimRight(base, "/") + "/" + key
+}
@@ -0,0 +1,180 @@
+package blobstore
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"slices"
+	"testing"
+)
+
+func TestValidateKey(t *testing.T) {
+	tests := []struct {
+		key   string
+		valid bool
+	}{
+		{"abc.jpg", true},
+		{"thumb-abc.jpg", true},
+		{"renditions/abc/800.webp", true},
+		{"cache/img/1600-1a2b3c4d/abc.jpg.avif", true},
+		{"..abc.jpg", true},
+		{"", false},
+		{".", false},
+		{"..", false},
+		{"../abc.jpg", false},
+		{"a/../../abc.jpg", false},
+		{"a/./b.jpg", false},
+		{"a/..", false},
+		{"/etc/passwd", false},
+		{"a//b.jpg", false},
+		{"a/", false},
+		{`..\abc.jpg`, false},
+		{`a\b.jpg`, false},
+	}
+	for _, test := range tests {
+		err := validateKey(test.key)
+		if test.valid && err != nil {
+			t.Errorf("validateKey(%q) = %v, want nil", test.key, err)
+		}
+		if !test.valid && err == nil {
+			t.Errorf("validateKey(%q) = nil, want an error", test.key)
+		}
+	}
+}
+
+func TestJoinURL(t *testing.T) {
+	tests := []struct {
+		base, key, want string
+	}{
+		{"/static/upload", "a.jpg", "/static/upload/a.jpg"},
+		{"/static/upload/", "a.jpg", "/static/upload/a.jpg"},
+		{"https://cdn.example.com//", "renditions/a/800.webp", "https://cdn.example.com/renditions/a/800.webp"},
+		{"/static/upload", "", "/static/upload/"},
+	}
+	for _, test := range tests {
+		if got := joinURL(test.base, test.key); got != test.want {
+			t.Errorf("joinURL(%q, %q) = %q, want %q", test.base, test.key, got, test.want)
+		}
+	}
+}
+
+func TestKeyForURL(t *testing.T) {
+	store := NewMemoryStore("/static/upload")
+	tests := []struct {
+		url string
+		key string
+		ok  bool
+	}{
+		{"/static/upload/a.jpg", "a.jpg", true},
+		{"/static/upload/renditions/a/800.webp", "renditions/a/800.webp", true},
+		{"/static/upload/", "", false},
+		{"/static/upload", "", false},
+		{"/static/uploads/a.jpg", "", false},
+		{"/static/img/a.jpg", "", false},
+		{"https://bucket.s3.amazonaws.com/a.jpg", "", false},
+		{"a.jpg", "", false},
+	}
+	for _, test := range tests {
+		key, ok := KeyForURL(store, test.url)
+		if key != test.key || ok != test.ok {
+			t.Errorf("KeyForURL(%q) = %q, %v, want %q, %v", test.url, key, ok, test.key, test.ok)
+		}
+	}
+}
+
+func TestMemoryStore(t *testing.T) {
+	testBlobStore(t, NewMemoryStore("/static/upload"))
+}
+
+// testBlobStore checks the behaviour every BlobStore shares
+func testBlobStore(t *testing.T, store BlobStore) {
+	t.Helper()
+	ctx := context.Background()
+
+	if _, err := store.Get(ctx, "missing.jpg"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Get of a missing key = %v, want ErrNotFound", err)
+	}
+
+	blobs := map[string][]byte{
+		"b.jpg":                   []byte("b"),
+		"a.jpg":                   []byte("a"),
+		"renditions/a/800.webp":   []byte("a 800 webp"),
+		"renditions/a/1600.jpg":   []byte("a 1600 jpg"),
+		"renditions/b/800.webp":   []byte("b 800 webp"),
+		"cache/img/800/a.jpg.jpg": []byte("a resized"),
+	}
+	for key, data := range blobs {
+		if err := store.Put(ctx, key, data, "image/jpeg"); err != nil {
+			t.Fatalf("Put(%q) = %v", key, err)
+		}
+	}
+	for key, want := range blobs {
+		got, err := store.Get(ctx, key)
+		if err != nil || !bytes.Equal(got, want) {
+			t.Errorf("Get(%q) = %q, %v, want %q", key, got, err, want)
+		}
+	}
+
+	// Put replaces
+	if err := store.Put(ctx, "a.jpg", []byte("new a"), "image/jpeg"); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := store.Get(ctx, "a.jpg"); string(got) != "new a" {
+		t.Errorf("Get after replacing = %q, want %q", got, "new a")
+	}
+
+	listTests := []struct {
+		prefix string
+		want   []string
+	}{
+		{"", []string{"a.jpg", "b.jpg", "cache/img/800/a.jpg.jpg", "renditions/a/1600.jpg", "renditions/a/800.webp", "renditions/b/800.webp"}},
+		{"renditions/", []string{"renditions/a/1600.jpg", "renditions/a/800.webp", "renditions/b/800.webp"}},
+		{"renditions/a/", []string{"renditions/a/1600.jpg", "renditions/a/800.webp"}},
+		{"a", []string{"a.jpg"}},
+		{"nothing/", nil},
+	}
+	for _, test := range listTests {
+		objects, err := store.List(ctx, test.prefix)
+		if err != nil {
+			t.Fatalf("List(%q) = %v", test.prefix, err)
+		}
+		if got := objectKeys(objects); !slices.Equal(got, test.want) {
+			t.Errorf("List(%q) = %q, want %q", test.prefix, got, test.want)
+		}
+	}
+
+	objects, err := store.List(ctx, "a.jpg")
+	if err != nil || len(objects) != 1 {
+		t.Fatalf("List(a.jpg) = %v, %v", objects, err)
+	}
+	if objects[0].Size != int64(len("new a")) {
+		t.Errorf("Size = %d, want %d", objects[0].Size, len("new a"))
+	}
+	if objects[0].ModTime.IsZero() {
+		t.Error("ModTime isn't set")
+	}
+
+	if err := store.Delete(ctx, "a.jpg"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.Get(ctx, "a.jpg"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Get after Delete = %v, want ErrNotFound", err)
+	}
+	if err := store.Delete(ctx, "a.jpg"); err != nil {
+		t.Errorf("Delete of a missing key = %v, want nil", err)
+	}
+
+	for _, key := range []string{"", "../escape.jpg", "a/../../escape.jpg", "/abs.jpg"} {
+		if err := store.Put(ctx, key, []byte("x"), "image/jpeg"); err == nil {
+			t.Errorf("Put(%q) = nil, want an error", key)
+		}
+	}
+}
+
+func objectKeys(objects []Object) []string {
+	var keys []string
+	for _, object := range objects {
+		keys = append(keys, object.Key)
+	}
+	return keys
+}
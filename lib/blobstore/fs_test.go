@@ -0,0 +1,133 @@
+package blobstore
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestFSStore(t *testing.T) {
+	store, err := NewFSStore(filepath.Join(t.TempDir(), "upload"), "/static/upload")
+	if err != nil {
+		t.Fatal(err)
+	}
+	testBlobStore(t, store)
+}
+
+func TestFSStorePut(t *testing.T) {
+	root := t.TempDir()
+	store, err := NewFSStore(root, "/static/upload")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	if err := store.Put(ctx, "renditions/a/800.webp", []byte("first"), "image/webp"); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Put(ctx, "renditions/a/800.webp", []byte("second"), "image/webp"); err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(root, "renditions", "a", "800.webp")
+	data, err := os.ReadFile(path)
+	if err != nil || string(data) != "second" {
+		t.Errorf("file = %q, %v, want %q", data, err, "second")
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mode := info.Mode().Perm(); mode != 0644 {
+		t.Errorf("mode = %v, want 0644 so the file server can read it", mode)
+	}
+
+	// the blob is written to a temporary file and renamed into place
+	entries, err := os.ReadDir(filepath.Dir(path))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, entry := range entries {
+		if strings.HasPrefix(entry.Name(), ".upload-") {
+			t.Errorf("temporary file %s was left behind", entry.Name())
+		}
+	}
+}
+
+func TestFSStoreListSkipsTemporaryFiles(t *testing.T) {
+	root := t.TempDir()
+	store, err := NewFSStore(root, "/static/upload")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	if err := store.Put(ctx, "a.jpg", []byte("a"), "image/jpeg"); err != nil {
+		t.Fatal(err)
+	}
+	// an upload in progress, or one interrupted by a crash
+	if err := os.WriteFile(filepath.Join(root, ".upload-123"), []byte("half"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(filepath.Join(root, "renditions", "a"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(root, "renditions", "a", ".upload-456"), []byte("half"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	objects, err := store.List(ctx, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if keys := objectKeys(objects); len(keys) != 1 || keys[0] != "a.jpg" {
+		t.Errorf("List = %q, want [a.jpg]", keys)
+	}
+}
+
+func TestFSStoreStaysInRoot(t *testing.T) {
+	dir := t.TempDir()
+	root := filepath.Join(dir, "upload")
+	store, err := NewFSStore(root, "/static/upload")
+	if err != nil {
+		t.Fatal(err)
+	}
+	secret := filepath.Join(dir, "secret.txt")
+	if err := os.WriteFile(secret, []byte("secret"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	if _, err := store.Get(ctx, "../secret.txt"); err == nil {
+		t.Error("Get(../secret.txt) read outside the root")
+	}
+	if err := store.Delete(ctx, "../secret.txt"); err == nil {
+		t.Error("Delete(../secret.txt) = nil, want an error")
+	}
+	if _, err := os.Stat(secret); err != nil {
+		t.Errorf("file outside the root is gone: %v", err)
+	}
+	if err := store.Put(ctx, "../escape.jpg", []byte("x"), "image/jpeg"); err == nil {
+		t.Error("Put(../escape.jpg) = nil, want an error")
+	}
+	if _, err := os.Stat(filepath.Join(dir, "escape.jpg")); err == nil {
+		t.Error("Put wrote outside the root")
+	}
+}
+
+func TestFSStoreURL(t *testing.T) {
+	store, err := NewFSStore(t.TempDir(), "/static/upload")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	url := store.URL("renditions/a/800.webp")
+	if url != "/static/upload/renditions/a/800.webp" {
+		t.Errorf("URL = %q", url)
+	}
+	if key, ok := KeyForURL(store, url); !ok || key != "renditions/a/800.webp" {
+		t.Errorf("KeyForURL(%q) = %q, %v", url, key, ok)
+	}
+}
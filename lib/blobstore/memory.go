@@ -0,0 +1,91 @@
+package blobstore
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MemoryStore keeps blobs in memory. It stands in for a real store when trying out
+// the image code without a bucket or a writable upload directory.
+type MemoryStore struct {
+	mu      sync.Mutex
+	blobs   map[string]memoryBlob
+	baseURL string
+
+	// Now is used for the blobs' ModTime, so the age of blobs can be controlled
+	Now func() time.Time
+}
+
+type memoryBlob struct {
+	data        []byte
+	contentType string
+	modTime     time.Time
+}
+
+func NewMemoryStore(baseURL string) *MemoryStore {
+	return &MemoryStore{
+		blobs:   map[string]memoryBlob{},
+		baseURL: baseURL,
+		Now:     time.Now,
+	}
+}
+
+func (s *MemoryStore) Put(ctx context.Context, key string, data []byte, contentType string) error {
+	if err := validateKey(key); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.blobs[key] = memoryBlob{
+		data:        append([]byte(nil), data...),
+		contentType: contentType,
+		modTime:     s.Now(),
+	}
+	return nil
+}
+
+func (s *MemoryStore) Get(ctx context.Context, key string) ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	blob, ok := s.blobs[key]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return append([]byte(nil), blob.data...), nil
+}
+
+// ContentType returns the content type the blob was stored with
+func (s *MemoryStore) ContentType(key string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.blobs[key].contentType
+}
+
+func (s *MemoryStore) Delete(ctx context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.blobs, key)
+	return nil
+}
+
+func (s *MemoryStore) URL(key string) string {
+	return joinURL(s.baseURL, key)
+}
+
+func (s *MemoryStore) List(ctx context.Context, prefix string) ([]Object, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var objects []Object
+	for key, blob := range s.blobs {
+		if strings.HasPrefix(key, prefix) {
+			objects = append(objects, Object{Key: key, Size: int64(len(blob.data)), ModTime: blob.modTime})
+		}
+	}
+	sort.Slice(objects, func(i, j int) bool { return objects[i].Key < objects[j].Key })
+	return objects, nil
+}
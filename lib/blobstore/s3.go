@@ -0,0 +1,181 @@
+package blobstore
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+// S3Config configures an S3 compatible bucket
+type S3Config struct {
+	Bucket    string
+	Region    string
+	AccessKey string
+	SecretKey string
+
+	// Endpoint is set for S3 compatible services like MinIO, e.g. "http://localhost:9000"
+	Endpoint string
+	// UsePathStyle addresses the bucket as endpoint/bucket/key instead of bucket.endpoint/key.
+	// MinIO needs it unless it is set up with virtual host style domains.
+	UsePathStyle bool
+	// PublicBaseURL is where the bucket is served to visitors, e.g. a CDN in front of it.
+	// When empty the URL is built from the endpoint.
+	PublicBaseURL string
+}
+
+// S3Store keeps blobs in an S3 compatible bucket
+type S3Store struct {
+	client  *s3.Client
+	bucket  string
+	baseURL string
+}
+
+func NewS3Store(cfg S3Config) (*S3Store, error) {
+	return newS3Store(cfg, nil)
+}
+
+// newS3Store sends the requests through httpClient when it is set, which lets the
+// tests talk to a fake S3
+func newS3Store(cfg S3Config, httpClient s3.HTTPClient) (*S3Store, error) {
+	if cfg.Bucket == "" {
+		return nil, errors.New("s3 bucket is missing")
+	}
+	if cfg.Region == "" {
+		if cfg.Endpoint == "" {
+			return nil, errors.New("s3 region is missing")
+		}
+		// S3 compatible services usually ignore the region but the signer needs one
+		cfg.Region = "us-east-1"
+	}
+
+	baseURL, err := s3BaseURL(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	client := s3.New(s3.Options{
+		Region:       cfg.Region,
+		Credentials:  credentials.NewStaticCredentialsProvider(cfg.AccessKey, cfg.SecretKey, ""),
+		UsePathStyle: cfg.UsePathStyle,
+	}, func(o *s3.Options) {
+		if cfg.Endpoint != "" {
+			o.BaseEndpoint = aws.String(cfg.Endpoint)
+		}
+		if httpClient != nil {
+			o.HTTPClient = httpClient
+		}
+	})
+
+	return &S3Store{client: client, bucket: cfg.Bucket, baseURL: baseURL}, nil
+}
+
+// s3BaseURL is the public URL of the bucket root
+func s3BaseURL(cfg S3Config) (string, error) {
+	if cfg.PublicBaseURL != "" {
+		return strings.TrimRight(cfg.PublicBaseURL, "/"), nil
+	}
+	if cfg.Endpoint == "" {
+		// the address uploads have always been stored with
+		return fmt.Sprintf("https://%s.s3.amazonaws.com", cfg.Bucket), nil
+	}
+
+	endpoint, err := url.Parse(cfg.Endpoint)
+	if err != nil || endpoint.Scheme == "" || endpoint.Host == "" {
+		return "", fmt.Errorf("invalid s3 endpoint %q", cfg.Endpoint)
+	}
+	if cfg.UsePathStyle {
+		return strings.TrimRight(endpoint.String(), "/") + "/" + cfg.Bucket, nil
+	}
+	return endpoint.Scheme + "://" + cfg.Bucket + "." + endpoint.Host, nil
+}
+
+func (s *S3Store) Put(ctx context.Context, key string, data []byte, contentType string) error {
+	if err := validateKey(key); err != nil {
+		return err
+	}
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+
+	_, err := s.client.PutObject(ctx, &s3.PutObjectInput{
+		Bucket:      aws.String(s.bucket),
+		Key:         aws.String(key),
+		Body:        bytes.NewReader(data),
+		ContentType: aws.String(contentType),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to upload %s to s3: %w", key, err)
+	}
+	return nil
+}
+
+func (s *S3Store) Get(ctx context.Context, key string) ([]byte, error) {
+	if err := validateKey(key); err != nil {
+		return nil, err
+	}
+
+	output, err := s.client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		var noSuchKey *types.NoSuchKey
+		if errors.As(err, &noSuchKey) {
+			return nil, ErrNotFound
+		}
+		return nil, fmt.Errorf("failed to get %s from s3: %w", key, err)
+	}
+	defer output.Body.Close()
+
+	return io.ReadAll(output.Body)
+}
+
+func (s *S3Store) Delete(ctx context.Context, key string) error {
+	if err := validateKey(key); err != nil {
+		return err
+	}
+
+	_, err := s.client.DeleteObject(ctx, &s3.DeleteObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to delete %s from s3: %w", key, err)
+	}
+	return nil
+}
+
+func (s *S3Store) URL(key string) string {
+	return joinURL(s.baseURL, key)
+}
+
+func (s *S3Store) List(ctx context.Context, prefix string) ([]Object, error) {
+	var objects []Object
+	paginator := s3.NewListObjectsV2Paginator(s.client, &s3.ListObjectsV2Input{
+		Bucket: aws.String(s.bucket),
+		Prefix: aws.String(prefix),
+	})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list s3 bucket: %w", err)
+		}
+		for _, object := range page.Contents {
+			objects = append(objects, Object{
+				Key:     aws.ToString(object.Key),
+				Size:    aws.ToInt64(object.Size),
+				ModTime: aws.ToTime(object.LastModified),
+			})
+		}
+	}
+	return objects, nil
+}
@@ -0,0 +1,291 @@
+package blobstore
+
+import (
+	"context"
+	"encoding/xml"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeS3 is just enough of the S3 API for S3Store, for one bucket addressed either
+// path style or virtual host style
+type fakeS3 struct {
+	bucket string
+
+	mu       sync.Mutex
+	objects  map[string]fakeS3Object
+	requests []fakeS3Request
+}
+
+type fakeS3Object struct {
+	data        []byte
+	contentType string
+	modTime     time.Time
+}
+
+type fakeS3Request struct {
+	Method string
+	Host   string
+	Path   string
+}
+
+func newFakeS3(t *testing.T, bucket string) (*fakeS3, *httptest.Server) {
+	fake := &fakeS3{bucket: bucket, objects: map[string]fakeS3Object{}}
+	server := httptest.NewServer(fake)
+	t.Cleanup(server.Close)
+	return fake, server
+}
+
+// client sends every request to the server whatever host it is for, so virtual
+// host style names like bucket.s3.test work without DNS
+func (f *fakeS3) client(server *httptest.Server) *http.Client {
+	address := server.Listener.Addr().String()
+	return &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, network, _ string) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, network, address)
+		},
+	}}
+}
+
+func (f *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.requests = append(f.requests, fakeS3Request{Method: r.Method, Host: r.Host, Path: r.URL.Path})
+
+	// bucket.host/key or host/bucket/key
+	key := strings.TrimPrefix(r.URL.Path, "/")
+	if host, _, _ := strings.Cut(r.Host, ":"); !strings.HasPrefix(host, f.bucket+".") {
+		var ok bool
+		if key, ok = strings.CutPrefix(key, f.bucket); !ok {
+			f.error(w, http.StatusNotFound, "NoSuchBucket")
+			return
+		}
+		key = strings.TrimPrefix(key, "/")
+	}
+
+	switch {
+	case r.Method == http.MethodGet && key == "" && r.URL.Query().Get("list-type") == "2":
+		f.list(w, r.URL.Query().Get("prefix"))
+	case r.Method == http.MethodPut && key != "":
+		data, err := io.ReadAll(r.Body)
+		if err != nil {
+			f.error(w, http.StatusBadRequest, "IncompleteBody")
+			return
+		}
+		f.objects[key] = fakeS3Object{data: data, contentType: r.Header.Get("Content-Type"), modTime: time.Now().UTC()}
+		w.Header().Set("ETag", `"etag"`)
+		w.WriteHeader(http.StatusOK)
+	case r.Method == http.MethodGet && key != "":
+		object, ok := f.objects[key]
+		if !ok {
+			f.error(w, http.StatusNotFound, "NoSuchKey")
+			return
+		}
+		w.Header().Set("Content-Type", object.contentType)
+		w.Write(object.data)
+	case r.Method == http.MethodDelete && key != "":
+		delete(f.objects, key)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		f.error(w, http.StatusMethodNotAllowed, "MethodNotAllowed")
+	}
+}
+
+func (f *fakeS3) list(w http.ResponseWriter, prefix string) {
+	type content struct {
+		Key          string
+		Size         int64
+		LastModified string
+	}
+	result := struct {
+		XMLName     xml.Name `xml:"ListBucketResult"`
+		Name        string
+		Prefix      string
+		KeyCount    int
+		IsTruncated bool
+		Contents    []content
+	}{Name: f.bucket, Prefix: prefix}
+
+	for key, object := range f.objects {
+		if strings.HasPrefix(key, prefix) {
+			result.Contents = append(result.Contents, content{
+				Key:          key,
+				Size:         int64(len(object.data)),
+				LastModified: object.modTime.Format(time.RFC3339),
+			})
+		}
+	}
+	sort.Slice(result.Contents, func(i, j int) bool { return result.Contents[i].Key < result.Contents[j].Key })
+	result.KeyCount = len(result.Contents)
+
+	w.Header().Set("Content-Type", "application/xml")
+	xml.NewEncoder(w).Encode(result)
+}
+
+func (f *fakeS3) error(w http.ResponseWriter, status int, code string) {
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(status)
+	xml.NewEncoder(w).Encode(struct {
+		XMLName xml.Name `xml:"Error"`
+		Code    string
+		Message string
+	}{Code: code, Message: code})
+}
+
+func (f *fakeS3) lastRequest() fakeS3Request {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.requests[len(f.requests)-1]
+}
+
+func TestS3StorePathStyle(t *testing.T) {
+	fake, server := newFakeS3(t, "art")
+	store, err := newS3Store(S3Config{
+		Bucket:       "art",
+		AccessKey:    "key",
+		SecretKey:    "secret",
+		Endpoint:     server.URL,
+		UsePathStyle: true,
+	}, fake.client(server))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testBlobStore(t, store)
+
+	if err := store.Put(context.Background(), "renditions/a/800.webp", []byte("x"), "image/webp"); err != nil {
+		t.Fatal(err)
+	}
+	request := fake.lastRequest()
+	if request.Path != "/art/renditions/a/800.webp" || request.Host != server.Listener.Addr().String() {
+		t.Errorf("path style request went to %s%s", request.Host, request.Path)
+	}
+	if got := fake.objects["renditions/a/800.webp"].contentType; got != "image/webp" {
+		t.Errorf("content type = %q, want image/webp", got)
+	}
+
+	url := store.URL("renditions/a/800.webp")
+	if want := server.URL + "/art/renditions/a/800.webp"; url != want {
+		t.Errorf("URL = %q, want %q", url, want)
+	}
+	if key, ok := KeyForURL(store, url); !ok || key != "renditions/a/800.webp" {
+		t.Errorf("KeyForURL(%q) = %q, %v", url, key, ok)
+	}
+}
+
+func TestS3StoreVirtualHostStyle(t *testing.T) {
+	fake, server := newFakeS3(t, "art")
+	port := server.Listener.Addr().(*net.TCPAddr).Port
+	endpoint := "http://s3.test:" + strconv.Itoa(port)
+	store, err := newS3Store(S3Config{
+		Bucket:    "art",
+		AccessKey: "key",
+		SecretKey: "secret",
+		Endpoint:  endpoint,
+	}, fake.client(server))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testBlobStore(t, store)
+
+	if err := store.Put(context.Background(), "a.jpg", []byte("x"), "image/jpeg"); err != nil {
+		t.Fatal(err)
+	}
+	request := fake.lastRequest()
+	if want := "art.s3.test:" + strconv.Itoa(port); request.Host != want || request.Path != "/a.jpg" {
+		t.Errorf("virtual host request went to %s%s, want %s/a.jpg", request.Host, request.Path, want)
+	}
+
+	url := store.URL("a.jpg")
+	if want := "http://art.s3.test:" + strconv.Itoa(port) + "/a.jpg"; url != want {
+		t.Errorf("URL = %q, want %q", url, want)
+	}
+	if key, ok := KeyForURL(store, url); !ok || key != "a.jpg" {
+		t.Errorf("KeyForURL(%q) = %q, %v", url, key, ok)
+	}
+}
+
+func TestS3StorePublicBaseURL(t *testing.T) {
+	fake, server := newFakeS3(t, "art")
+	store, err := newS3Store(S3Config{
+		Bucket:        "art",
+		AccessKey:     "key",
+		SecretKey:     "secret",
+		Endpoint:      server.URL,
+		UsePathStyle:  true,
+		PublicBaseURL: "https://cdn.example.com/images/",
+	}, fake.client(server))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// blobs are still stored in the bucket, only the URLs point at the CDN
+	if err := store.Put(context.Background(), "a.jpg", []byte("x"), "image/jpeg"); err != nil {
+		t.Fatal(err)
+	}
+	if request := fake.lastRequest(); request.Path != "/art/a.jpg" {
+		t.Errorf("request went to %s", request.Path)
+	}
+
+	url := store.URL("a.jpg")
+	if url != "https://cdn.example.com/images/a.jpg" {
+		t.Errorf("URL = %q", url)
+	}
+	if key, ok := KeyForURL(store, url); !ok || key != "a.jpg" {
+		t.Errorf("KeyForURL(%q) = %q, %v", url, key, ok)
+	}
+	if _, ok := KeyForURL(store, server.URL+"/art/a.jpg"); ok {
+		t.Error("KeyForURL accepted the bucket URL when the CDN is the public one")
+	}
+}
+
+func TestS3BaseURL(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  S3Config
+		want string
+	}{
+		{"aws", S3Config{Bucket: "art", Region: "eu-north-1"}, "https://art.s3.amazonaws.com"},
+		{"path style", S3Config{Bucket: "art", Endpoint: "http://localhost:9000", UsePathStyle: true}, "http://localhost:9000/art"},
+		{"path style with slash", S3Config{Bucket: "art", Endpoint: "http://localhost:9000/", UsePathStyle: true}, "http://localhost:9000/art"},
+		{"virtual host", S3Config{Bucket: "art", Endpoint: "https://s3.example.com"}, "https://art.s3.example.com"},
+		{"virtual host with port", S3Config{Bucket: "art", Endpoint: "http://minio.local:9000"}, "http://art.minio.local:9000"},
+		{"cdn", S3Config{Bucket: "art", Endpoint: "http://localhost:9000", PublicBaseURL: "https://cdn.example.com/"}, "https://cdn.example.com"},
+		{"cdn without endpoint", S3Config{Bucket: "art", Region: "eu-north-1", PublicBaseURL: "https://cdn.example.com"}, "https://cdn.example.com"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := s3BaseURL(test.cfg)
+			if err != nil || got != test.want {
+				t.Errorf("s3BaseURL = %q, %v, want %q", got, err, test.want)
+			}
+		})
+	}
+
+	for _, endpoint := range []string{"localhost:9000", "://bad", "/just/a/path"} {
+		if _, err := s3BaseURL(S3Config{Bucket: "art", Endpoint: endpoint}); err == nil {
+			t.Errorf("s3BaseURL accepted the endpoint %q", endpoint)
+		}
+	}
+}
+
+func TestNewS3StoreConfig(t *testing.T) {
+	if _, err := NewS3Store(S3Config{Region: "eu-north-1"}); err == nil {
+		t.Error("NewS3Store accepted a config without a bucket")
+	}
+	if _, err := NewS3Store(S3Config{Bucket: "art"}); err == nil {
+		t.Error("NewS3Store accepted AWS without a region")
+	}
+	if _, err := NewS3Store(S3Config{Bucket: "art", Endpoint: "http://localhost:9000"}); err != nil {
+		t.Errorf("NewS3Store needs a region for an S3 compatible endpoint: %v", err)
+	}
+}
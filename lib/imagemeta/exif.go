@@ -0,0 +1,105 @@
+package imagemeta
+
+import (
+	"bytes"
+	"encoding/binary"
+	"strings"
+)
+
+const (
+	tagOrientation = 0x0112
+	tagCopyright   = 0x8298
+
+	typeASCII = 2
+	typeShort = 3
+
+	// maxCopyrightLength keeps the rewritten EXIF block well within a JPEG segment
+	maxCopyrightLength = 1000
+)
+
+// readTIFF reads the orientation and copyright from the first IFD of an EXIF block
+func readTIFF(tiff []byte) Metadata {
+	meta := Metadata{Orientation: 1}
+	if len(tiff) < 8 {
+		return meta
+	}
+
+	var order binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return meta
+	}
+	if order.Uint16(tiff[2:]) != 42 {
+		return meta
+	}
+
+	ifd := int(order.Uint32(tiff[4:]))
+	if ifd < 8 || ifd+2 > len(tiff) {
+		return meta
+	}
+	count := int(order.Uint16(tiff[ifd:]))
+	for i := range count {
+		entry := ifd + 2 + i*12
+		if entry+12 > len(tiff) {
+			break
+		}
+		tag := order.Uint16(tiff[entry:])
+		typ := order.Uint16(tiff[entry+2:])
+		n := int(order.Uint32(tiff[entry+4:]))
+
+		switch {
+		case tag == tagOrientation && typ == typeShort:
+			if orientation := int(order.Uint16(tiff[entry+8:])); orientation >= 1 && orientation <= 8 {
+				meta.Orientation = orientation
+			}
+		case tag == tagCopyright && typ == typeASCII && n > 0:
+			value := tiff[entry+8 : entry+12]
+			if n > 4 {
+				offset := int(order.Uint32(tiff[entry+8:]))
+				if offset < 0 || offset+n > len(tiff) {
+					continue
+				}
+				value = tiff[offset : offset+n]
+			} else {
+				value = value[:n]
+			}
+			// photographer and editor copyrights are separated by a NUL
+			parts := strings.Split(strings.TrimRight(string(value), "\x00"), "\x00")
+			meta.Copyright = strings.TrimSpace(strings.Join(parts, " "))
+		}
+	}
+	return meta
+}
+
+// copyrightTIFF is an EXIF block holding nothing but the copyright
+func copyrightTIFF(copyright string) []byte {
+	if len(copyright) > maxCopyrightLength {
+		copyright = copyright[:maxCopyrightLength]
+	}
+	value := append([]byte(copyright), 0)
+
+	var b bytes.Buffer
+	b.WriteString("MM\x00\x2a")
+	binary.Write(&b, binary.BigEndian, uint32(8)) // the IFD follows the header
+	binary.Write(&b, binary.BigEndian, uint16(1))
+	binary.Write(&b, binary.BigEndian, uint16(tagCopyright))
+	binary.Write(&b, binary.BigEndian, uint16(typeASCII))
+	binary.Write(&b, binary.BigEndian, uint32(len(value)))
+	if len(value) <= 4 {
+		padded := make([]byte, 4)
+		copy(padded, value)
+		b.Write(padded)
+	} else {
+		// header, entry count, one entry and the next IFD offset come first
+		binary.Write(&b, binary.BigEndian, uint32(8+2+12+4))
+	}
+	binary.Write(&b, binary.BigEndian, uint32(0)) // no more IFDs
+	if len(value) > 4 {
+		b.Write(value)
+	}
+	return b.Bytes()
+}
@@ -0,0 +1,246 @@
+package imagemeta
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"testing"
+)
+
+// The fixtures carry these in their metadata, none of them may survive Strip
+var secrets = []string{"SECRET-MAKE", "SECRET-GPS", "SECRET-XMP", "SECRET-COMMENT", "SECRET-IPTC", "SECRET-MPF", "SECRET-TEXT"}
+
+const (
+	tagMake       = 0x010F
+	tagGPSIFD     = 0x8825
+	tagGPSDatum   = 0x0012
+	tagGPSLatRef  = 0x0001
+	typeLong      = 4
+	xmpNamespace  = "http://ns.adobe.com/xap/1.0/\x00"
+	iccProfileTag = "ICC_PROFILE\x00"
+)
+
+// byteOrder is what the fixtures need of binary.LittleEndian and binary.BigEndian
+type byteOrder interface {
+	binary.ByteOrder
+	binary.AppendByteOrder
+}
+
+// tiffEntry is an IFD entry of a test EXIF block. value is in the block's byte
+// order, ifd makes the entry point at a sub IFD like the GPS IFD.
+type tiffEntry struct {
+	tag   uint16
+	typ   uint16
+	count uint32
+	value []byte
+	ifd   []tiffEntry
+}
+
+func shortEntry(order byteOrder, tag uint16, value uint16) tiffEntry {
+	return tiffEntry{tag: tag, typ: typeShort, count: 1, value: order.AppendUint16(nil, value)}
+}
+
+func asciiEntry(tag uint16, value string) tiffEntry {
+	return tiffEntry{tag: tag, typ: typeASCII, count: uint32(len(value) + 1), value: append([]byte(value), 0)}
+}
+
+func buildTIFF(order byteOrder, entries []tiffEntry) []byte {
+	b := []byte("MM")
+	if order == binary.LittleEndian {
+		b = []byte("II")
+	}
+	b = order.AppendUint16(b, 42)
+	b = order.AppendUint32(b, 8)
+	return appendIFD(b, order, entries)
+}
+
+// appendIFD appends the IFD, then the values that don't fit in its entries, then
+// its sub IFDs
+func appendIFD(b []byte, order byteOrder, entries []tiffEntry) []byte {
+	dataStart := len(b) + 2 + len(entries)*12 + 4
+	var data []byte
+	var pointers []int
+
+	b = order.AppendUint16(b, uint16(len(entries)))
+	for _, entry := range entries {
+		b = order.AppendUint16(b, entry.tag)
+		switch {
+		case entry.ifd != nil:
+			b = order.AppendUint16(b, typeLong)
+			b = order.AppendUint32(b, 1)
+			pointers = append(pointers, len(b))
+			b = order.AppendUint32(b, 0)
+		case len(entry.value) <= 4:
+			b = order.AppendUint16(b, entry.typ)
+			b = order.AppendUint32(b, entry.count)
+			b = append(b, entry.value...)
+			b = append(b, make([]byte, 4-len(entry.value))...)
+		default:
+			b = order.AppendUint16(b, entry.typ)
+			b = order.AppendUint32(b, entry.count)
+			b = order.AppendUint32(b, uint32(dataStart+len(data)))
+			data = append(data, entry.value...)
+		}
+	}
+	b = order.AppendUint32(b, 0)
+	b = append(b, data...)
+
+	for _, entry := range entries {
+		if entry.ifd == nil {
+			continue
+		}
+		order.PutUint32(b[pointers[0]:], uint32(len(b)))
+		pointers = pointers[1:]
+		b = appendIFD(b, order, entry.ifd)
+	}
+	return b
+}
+
+// phoneEXIF is an EXIF block like a phone writes, with the camera, a GPS position
+// and optionally a copyright
+func phoneEXIF(order byteOrder, orientation uint16, copyright string) []byte {
+	entries := []tiffEntry{
+		asciiEntry(tagMake, "SECRET-MAKE"),
+		shortEntry(order, tagOrientation, orientation),
+	}
+	if copyright != "" {
+		entries = append(entries, asciiEntry(tagCopyright, copyright))
+	}
+	entries = append(entries, tiffEntry{tag: tagGPSIFD, ifd: []tiffEntry{
+		asciiEntry(tagGPSLatRef, "N"),
+		asciiEntry(tagGPSDatum, "SECRET-GPS WGS-84"),
+	}})
+	return buildTIFF(order, entries)
+}
+
+// testImage is a small image with a different colour in every pixel
+func testImage(width, height int) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := range height {
+		for x := range width {
+			img.Set(x, y, color.RGBA{R: uint8(x * 40), G: uint8(y * 40), B: 200, A: 255})
+		}
+	}
+	return img
+}
+
+func jpegSegmentBytes(marker byte, payload []byte) []byte {
+	b := []byte{0xFF, marker}
+	b = binary.BigEndian.AppendUint16(b, uint16(len(payload)+2))
+	return append(b, payload...)
+}
+
+// testJPEG encodes a small JPEG with the segments right after the start of image
+func testJPEG(t testing.TB, segments ...[]byte) []byte {
+	t.Helper()
+	var encoded bytes.Buffer
+	if err := jpeg.Encode(&encoded, testImage(6, 4), nil); err != nil {
+		t.Fatal(err)
+	}
+	data := encoded.Bytes()
+
+	out := append([]byte(nil), data[:2]...)
+	for _, segment := range segments {
+		out = append(out, segment...)
+	}
+	return append(out, data[2:]...)
+}
+
+func jpegEXIF(tiff []byte) []byte {
+	return jpegSegmentBytes(markerAPP1, append([]byte("Exif\x00\x00"), tiff...))
+}
+
+// phoneJPEG is a JPEG with everything a phone and an editor put in one
+func phoneJPEG(t testing.TB, order byteOrder, orientation uint16, copyright string) []byte {
+	return testJPEG(t,
+		jpegSegmentBytes(markerAPP0, []byte("JFIF\x00\x01\x01\x00\x00\x01\x00\x01\x00\x00")),
+		jpegEXIF(phoneEXIF(order, orientation, copyright)),
+		jpegSegmentBytes(markerAPP1, []byte(xmpNamespace+"<x:xmpmeta>SECRET-XMP</x:xmpmeta>")),
+		jpegSegmentBytes(markerAPP2, []byte(iccProfileTag+"\x01\x01profile")),
+		jpegSegmentBytes(markerAPP2, []byte("MPF\x00SECRET-MPF")),
+		jpegSegmentBytes(0xED, []byte("Photoshop 3.0\x00SECRET-IPTC")),
+		jpegSegmentBytes(markerCOM, []byte("SECRET-COMMENT")),
+	)
+}
+
+func pngChunkBytes(typ string, payload []byte) []byte {
+	b := binary.BigEndian.AppendUint32(nil, uint32(len(payload)))
+	b = append(b, typ...)
+	b = append(b, payload...)
+	crc := crc32.NewIEEE()
+	crc.Write([]byte(typ))
+	crc.Write(payload)
+	return binary.BigEndian.AppendUint32(b, crc.Sum32())
+}
+
+// testPNG encodes a small PNG with the chunks right after the header
+func testPNG(t testing.TB, chunks ...[]byte) []byte {
+	t.Helper()
+	var encoded bytes.Buffer
+	if err := png.Encode(&encoded, testImage(6, 4)); err != nil {
+		t.Fatal(err)
+	}
+	data := encoded.Bytes()
+
+	// the signature and the 13 byte IHDR chunk
+	headerEnd := len(pngSignature) + 12 + 13
+	out := append([]byte(nil), data[:headerEnd]...)
+	for _, chunk := range chunks {
+		out = append(out, chunk...)
+	}
+	return append(out, data[headerEnd:]...)
+}
+
+func phonePNG(t testing.TB, order byteOrder, orientation uint16, copyright string) []byte {
+	return testPNG(t,
+		pngChunkBytes("eXIf", phoneEXIF(order, orientation, copyright)),
+		pngChunkBytes("tEXt", []byte("Comment\x00SECRET-TEXT")),
+		pngChunkBytes("zTXt", []byte("Description\x00\x00SECRET-COMMENT")),
+		pngChunkBytes("iTXt", []byte("XML:com.adobe.xmp\x00\x00\x00\x00\x00<x:xmpmeta>SECRET-XMP</x:xmpmeta>")),
+	)
+}
+
+func webpChunkBytes(fourCC string, payload []byte) []byte {
+	b := append([]byte(fourCC), binary.LittleEndian.AppendUint32(nil, uint32(len(payload)))...)
+	b = append(b, payload...)
+	if len(payload)%2 == 1 {
+		b = append(b, 0)
+	}
+	return b
+}
+
+// vp8x is the extended header of a 6x4 WebP
+func vp8x(flags byte) []byte {
+	return webpChunkBytes("VP8X", []byte{flags, 0, 0, 0, 5, 0, 0, 3, 0, 0})
+}
+
+// vp8l stands in for the image data, Strip copies it without decoding it
+var vp8l = webpChunkBytes("VP8L", []byte{0x2F, 5, 0xC0, 0, 0, 0x07, 0x10, 0x11, 0xFD, 0x0F})
+
+func testWebP(chunks ...[]byte) []byte {
+	body := []byte("WEBP")
+	for _, chunk := range chunks {
+		body = append(body, chunk...)
+	}
+	out := append([]byte("RIFF"), binary.LittleEndian.AppendUint32(nil, uint32(len(body)))...)
+	return append(out, body...)
+}
+
+// phoneWebP is an extended WebP with EXIF and XMP. Some writers put the JPEG style
+// "Exif" header in front of the EXIF chunk.
+func phoneWebP(order byteOrder, orientation uint16, copyright string, exifHeader bool) []byte {
+	exif := phoneEXIF(order, orientation, copyright)
+	if exifHeader {
+		exif = append([]byte("Exif\x00\x00"), exif...)
+	}
+	return testWebP(
+		vp8x(webpFlagEXIF|webpFlagXMP),
+		vp8l,
+		webpChunkBytes("EXIF", exif),
+		webpChunkBytes("XMP ", []byte("<x:xmpmeta>SECRET-XMP</x:xmpmeta>")),
+	)
+}
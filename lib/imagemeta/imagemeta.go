@@ -0,0 +1,77 @@
+// Package imagemeta reads and removes the metadata of uploaded images. Photos from
+// phones carry GPS positions and camera details in EXIF and XMP, and only the
+// orientation and the copyright notice are of any use to the site.
+package imagemeta
+
+import (
+	"bytes"
+	"errors"
+)
+
+// ErrUnsupportedFormat is returned by Strip for images that aren't JPEG, PNG or WebP
+var ErrUnsupportedFormat = errors.New("unsupported image format")
+
+var errInvalidImage = errors.New("invalid image data")
+
+// Metadata is what the site uses of an image's metadata
+type Metadata struct {
+	// Orientation is the EXIF orientation, 1 is the right way up and 2 to 8 are
+	// mirrored and rotated variants
+	Orientation int
+	Copyright   string
+}
+
+// Read returns the image's metadata. Missing or broken metadata reads as the right
+// way up without a copyright.
+func Read(data []byte) Metadata {
+	switch {
+	case isJPEG(data):
+		return readJPEG(data)
+	case isPNG(data):
+		return readPNG(data)
+	case isWebP(data):
+		return readWebP(data)
+	}
+	return Metadata{Orientation: 1}
+}
+
+// Strip returns the image without EXIF, XMP, IPTC and comments. The pixels aren't
+// touched, so a rotated image has to be turned with Orient first. When copyright
+// isn't empty it is written back as the only metadata.
+func Strip(data []byte, copyright string) ([]byte, error) {
+	switch {
+	case isJPEG(data):
+		return stripJPEG(data, copyright)
+	case isPNG(data):
+		return stripPNG(data, copyright)
+	case isWebP(data):
+		return stripWebP(data, copyright)
+	}
+	return nil, ErrUnsupportedFormat
+}
+
+// Format tells from its first bytes if the data is a "jpeg", "png" or "webp" image,
+// whatever the file is called. It returns "" for anything else.
+func Format(data []byte) string {
+	switch {
+	case isJPEG(data):
+		return "jpeg"
+	case isPNG(data):
+		return "png"
+	case isWebP(data):
+		return "webp"
+	}
+	return ""
+}
+
+func isJPEG(data []byte) bool {
+	return len(data) > 3 && data[0] == 0xFF && data[1] == 0xD8 && data[2] == 0xFF
+}
+
+func isPNG(data []byte) bool {
+	return bytes.HasPrefix(data, pngSignature)
+}
+
+func isWebP(data []byte) bool {
+	return len(data) >= 12 && string(data[:4]) == "RIFF" && string(data[8:12]) == "WEBP"
+}
@@ -0,0 +1,362 @@
+package imagemeta
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"image/jpeg"
+	"image/png"
+	"strings"
+	"testing"
+)
+
+const testCopyright = "© Emma Jelk 2026"
+
+var byteOrders = []struct {
+	name  string
+	order byteOrder
+}{
+	{"little endian", binary.LittleEndian},
+	{"big endian", binary.BigEndian},
+}
+
+func TestReadOrientation(t *testing.T) {
+	for _, byteOrder := range byteOrders {
+		for orientation := uint16(1); orientation <= 8; orientation++ {
+			order := byteOrder.order
+			fixtures := map[string][]byte{
+				"jpeg":             phoneJPEG(t, order, orientation, ""),
+				"png":              phonePNG(t, order, orientation, ""),
+				"webp":             phoneWebP(order, orientation, "", false),
+				"webp exif header": phoneWebP(order, orientation, "", true),
+			}
+			for name, data := range fixtures {
+				if got := Read(data).Orientation; got != int(orientation) {
+					t.Errorf("%s %s: orientation = %d, want %d", name, byteOrder.name, got, orientation)
+				}
+			}
+		}
+	}
+}
+
+func TestReadDefaults(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"empty", nil},
+		{"not an image", []byte("GIF89a")},
+		{"jpeg without exif", testJPEG(t)},
+		{"png without exif", testPNG(t)},
+		{"simple webp", testWebP(vp8l)},
+		{"orientation out of range", testJPEG(t, jpegEXIF(buildTIFF(binary.BigEndian, []tiffEntry{shortEntry(binary.BigEndian, tagOrientation, 9)})))},
+		{"orientation of the wrong type", testJPEG(t, jpegEXIF(buildTIFF(binary.BigEndian, []tiffEntry{asciiEntry(tagOrientation, "6")})))},
+	}
+	for _, test := range tests {
+		if got := Read(test.data); got != (Metadata{Orientation: 1}) {
+			t.Errorf("%s: Read = %+v, want the right way up without a copyright", test.name, got)
+		}
+	}
+}
+
+func TestReadCopyright(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"jpeg exif", phoneJPEG(t, binary.LittleEndian, 1, testCopyright)},
+		{"png exif", phonePNG(t, binary.BigEndian, 1, testCopyright)},
+		{"png tEXt", testPNG(t, pngChunkBytes("tEXt", []byte("Copyright\x00\xa9 Emma Jelk 2026")))},
+		{"png iTXt", testPNG(t, pngChunkBytes("iTXt", []byte("Copyright\x00\x00\x00sv\x00Upphovsrätt\x00"+testCopyright)))},
+		{"png text over exif", testPNG(t,
+			pngChunkBytes("iTXt", []byte("Copyright\x00\x00\x00\x00\x00"+testCopyright)),
+			pngChunkBytes("eXIf", phoneEXIF(binary.BigEndian, 1, "someone else")),
+		)},
+		{"webp exif", phoneWebP(binary.LittleEndian, 1, testCopyright, false)},
+	}
+	for _, test := range tests {
+		if got := Read(test.data).Copyright; got != testCopyright {
+			t.Errorf("%s: copyright = %q, want %q", test.name, got, testCopyright)
+		}
+	}
+}
+
+func TestStrip(t *testing.T) {
+	type check func(t *testing.T, stripped []byte)
+	decodes := map[string]check{
+		"jpeg": func(t *testing.T, stripped []byte) {
+			img, err := jpeg.Decode(bytes.NewReader(stripped))
+			if err != nil {
+				t.Fatalf("stripped JPEG doesn't decode: %v", err)
+			}
+			if size := img.Bounds().Size(); size.X != 6 || size.Y != 4 {
+				t.Errorf("stripped JPEG is %v", size)
+			}
+		},
+		"png": func(t *testing.T, stripped []byte) {
+			img, err := png.Decode(bytes.NewReader(stripped))
+			if err != nil {
+				t.Fatalf("stripped PNG doesn't decode: %v", err)
+			}
+			if img.At(5, 3) != testImage(6, 4).At(5, 3) {
+				t.Error("stripping changed the pixels")
+			}
+		},
+		"webp": func(t *testing.T, stripped []byte) {
+			if size := binary.LittleEndian.Uint32(stripped[4:]); int(size) != len(stripped)-8 {
+				t.Errorf("RIFF size = %d, want %d", size, len(stripped)-8)
+			}
+			chunks, err := webpChunks(stripped)
+			if err != nil {
+				t.Fatalf("stripped WebP doesn't parse: %v", err)
+			}
+			if chunks[0].fourCC != "VP8X" || chunks[1].fourCC != "VP8L" {
+				t.Errorf("stripped WebP starts with %s %s", chunks[0].fourCC, chunks[1].fourCC)
+			}
+			if !bytes.Equal(chunks[1].raw, vp8l) {
+				t.Error("stripping changed the image data")
+			}
+		},
+	}
+
+	for _, copyright := range []string{testCopyright, "© E", ""} {
+		fixtures := []struct {
+			name   string
+			format string
+			data   []byte
+		}{
+			{"jpeg", "jpeg", phoneJPEG(t, binary.LittleEndian, 6, "phone owner")},
+			{"png", "png", phonePNG(t, binary.BigEndian, 6, "phone owner")},
+			{"webp", "webp", phoneWebP(binary.LittleEndian, 6, "phone owner", false)},
+			{"webp exif header", "webp", phoneWebP(binary.BigEndian, 6, "phone owner", true)},
+		}
+		for _, fixture := range fixtures {
+			t.Run(fixture.name+" "+copyright, func(t *testing.T) {
+				stripped, err := Strip(fixture.data, copyright)
+				if err != nil {
+					t.Fatal(err)
+				}
+				for _, secret := range secrets {
+					if bytes.Contains(stripped, []byte(secret)) {
+						t.Errorf("%s survived", secret)
+					}
+				}
+				if bytes.Contains(stripped, []byte("phone owner")) {
+					t.Error("the original copyright survived")
+				}
+				if got := Format(stripped); got != fixture.format {
+					t.Errorf("Format = %q, want %q", got, fixture.format)
+				}
+
+				// the pixels aren't turned, so neither is the orientation kept
+				want := Metadata{Orientation: 1, Copyright: copyright}
+				if got := Read(stripped); got != want {
+					t.Errorf("Read(stripped) = %+v, want %+v", got, want)
+				}
+				decodes[fixture.format](t, stripped)
+
+				// stripping again changes nothing
+				again, err := Strip(stripped, copyright)
+				if err != nil || !bytes.Equal(again, stripped) {
+					t.Errorf("stripping twice changed the image, err %v", err)
+				}
+			})
+		}
+	}
+}
+
+func TestStripJPEGKeepsColourSegments(t *testing.T) {
+	stripped, err := Strip(phoneJPEG(t, binary.BigEndian, 1, ""), testCopyright)
+	if err != nil {
+		t.Fatal(err)
+	}
+	segments, _, err := jpegSegments(stripped)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var markers []byte
+	for _, segment := range segments {
+		if segment.marker >= markerAPP0 && segment.marker <= markerCOM {
+			markers = append(markers, segment.marker)
+		}
+	}
+	// JFIF first, then the copyright, then the ICC profile
+	if want := []byte{markerAPP0, markerAPP1, markerAPP2}; !bytes.Equal(markers, want) {
+		t.Errorf("segments = % X, want % X", markers, want)
+	}
+	if !bytes.Contains(stripped, []byte(iccProfileTag+"\x01\x01profile")) {
+		t.Error("the ICC profile is gone")
+	}
+}
+
+func TestStripWebPFlags(t *testing.T) {
+	tests := []struct {
+		name      string
+		data      []byte
+		copyright string
+		flags     byte
+	}{
+		{"metadata removed", phoneWebP(binary.LittleEndian, 1, "", false), "", 0},
+		{"copyright written", phoneWebP(binary.LittleEndian, 1, "", false), testCopyright, webpFlagEXIF},
+		{"other flags kept", testWebP(vp8x(0x10|webpFlagXMP), vp8l), testCopyright, 0x10 | webpFlagEXIF},
+	}
+	for _, test := range tests {
+		stripped, err := Strip(test.data, test.copyright)
+		if err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+		if flags := stripped[20]; flags != test.flags {
+			t.Errorf("%s: VP8X flags = %#x, want %#x", test.name, flags, test.flags)
+		}
+	}
+}
+
+func TestStripSimpleWebPLosesCopyright(t *testing.T) {
+	data := testWebP(vp8l)
+	stripped, err := Strip(data, testCopyright)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(stripped, data) {
+		t.Error("Strip changed a WebP without an extended header")
+	}
+}
+
+func TestStripLongCopyright(t *testing.T) {
+	copyright := strings.Repeat("x", maxCopyrightLength+100)
+	stripped, err := Strip(testJPEG(t), copyright)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := Read(stripped).Copyright; got != copyright[:maxCopyrightLength] {
+		t.Errorf("copyright is %d long, want %d", len(got), maxCopyrightLength)
+	}
+}
+
+func TestStripUnsupported(t *testing.T) {
+	for _, data := range [][]byte{nil, []byte("GIF89a"), []byte("RIFF\x04\x00\x00\x00WAVE")} {
+		if _, err := Strip(data, ""); !errors.Is(err, ErrUnsupportedFormat) {
+			t.Errorf("Strip(%q) = %v, want ErrUnsupportedFormat", data, err)
+		}
+	}
+}
+
+func TestMalformed(t *testing.T) {
+	jpegHead := []byte{0xFF, 0xD8}
+	pngHead := testPNG(t)[:len(pngSignature)+25]
+
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"jpeg segment past the end", append(append([]byte(nil), jpegHead...), 0xFF, markerAPP1, 0x10, 0x00, 'E', 'x')},
+		{"jpeg segment length too short", append(append([]byte(nil), jpegHead...), 0xFF, markerAPP1, 0x00, 0x01, 0xFF, markerSOS)},
+		{"jpeg without a marker", append(append([]byte(nil), jpegHead...), 0xFF, 0x00, 0x00)},
+		{"jpeg cut in a segment length", append(append([]byte(nil), jpegHead...), 0xFF, markerAPP1, 0x00)},
+		{"jpeg without scan", append(append([]byte(nil), jpegHead...), jpegSegmentBytes(markerCOM, []byte("x"))...)},
+		{"png chunk past the end", append(append([]byte(nil), pngHead...), 0x00, 0x00, 0x10, 0x00, 't', 'E', 'X', 't', 'x')},
+		{"png chunk length overflow", append(append([]byte(nil), pngHead...), 0xFF, 0xFF, 0xFF, 0xFF, 't', 'E', 'X', 't', 0, 0, 0, 0)},
+		{"png cut in a chunk header", append(append([]byte(nil), pngHead...), 0x00, 0x00)},
+		{"webp chunk past the end", append(testWebP(vp8x(0)), "EXIF\x00\x10\x00\x00II"...)},
+		{"webp chunk size overflow", append(testWebP(vp8x(0)), "EXIF\xFF\xFF\xFF\xFF"...)},
+		{"webp cut in a chunk header", append(testWebP(vp8x(0)), "EXI"...)},
+		{"webp short extended header", testWebP(webpChunkBytes("VP8X", nil), vp8l)},
+		{"webp second extended header", testWebP(vp8x(0), vp8l, webpChunkBytes("VP8X", nil))},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := Read(test.data); got != (Metadata{Orientation: 1}) {
+				t.Errorf("Read = %+v", got)
+			}
+			if _, err := Strip(test.data, testCopyright); !errors.Is(err, errInvalidImage) {
+				t.Errorf("Strip = %v, want errInvalidImage", err)
+			}
+		})
+	}
+}
+
+func TestMalformedEXIF(t *testing.T) {
+	valid := phoneEXIF(binary.LittleEndian, 6, testCopyright)
+	tests := []struct {
+		name string
+		tiff []byte
+	}{
+		{"empty", nil},
+		{"unknown byte order", append([]byte("XX"), valid[2:]...)},
+		{"wrong magic", append([]byte("II\x2B\x00"), valid[4:]...)},
+		{"IFD past the end", []byte("II\x2A\x00\xFF\xFF\x00\x00")},
+		{"too many entries", []byte("II\x2A\x00\x08\x00\x00\x00\xFF\xFF")},
+		{"copyright past the end", buildTIFF(binary.LittleEndian, []tiffEntry{{tag: tagCopyright, typ: typeASCII, count: 0xFFFF, value: []byte("Emma Jelk")}})},
+		{"cut", valid[:len(valid)/2]},
+	}
+	for _, test := range tests {
+		for name, data := range map[string][]byte{
+			"jpeg": testJPEG(t, jpegEXIF(test.tiff)),
+			"png":  testPNG(t, pngChunkBytes("eXIf", test.tiff)),
+			"webp": testWebP(vp8x(webpFlagEXIF), vp8l, webpChunkBytes("EXIF", test.tiff)),
+		} {
+			got := Read(data)
+			if got.Orientation < 1 || got.Orientation > 8 {
+				t.Errorf("%s %s: orientation = %d", test.name, name, got.Orientation)
+			}
+			if _, err := Strip(data, testCopyright); err != nil {
+				t.Errorf("%s %s: Strip = %v, broken EXIF is dropped like any other", test.name, name, err)
+			}
+		}
+	}
+}
+
+// Cutting a fixture anywhere or breaking any of its header bytes must give an
+// error or a smaller image, never a panic
+func TestTruncatedAndCorrupted(t *testing.T) {
+	fixtures := map[string][]byte{
+		"jpeg": phoneJPEG(t, binary.LittleEndian, 6, testCopyright),
+		"png":  phonePNG(t, binary.BigEndian, 6, testCopyright),
+		"webp": phoneWebP(binary.LittleEndian, 6, testCopyright, true),
+	}
+	for name, data := range fixtures {
+		for n := range len(data) {
+			checkNoPanic(t, name+" cut", data[:n])
+		}
+		for i := range min(len(data), 400) {
+			for _, b := range []byte{0x00, 0x01, 0x7F, 0xFF} {
+				corrupted := append([]byte(nil), data...)
+				corrupted[i] = b
+				checkNoPanic(t, name+" corrupted", corrupted)
+			}
+		}
+	}
+}
+
+func checkNoPanic(t *testing.T, name string, data []byte) {
+	t.Helper()
+	defer func() {
+		if r := recover(); r != nil {
+			t.Fatalf("%s: panic on %d bytes % X: %v", name, len(data), data, r)
+		}
+	}()
+	Read(data)
+	Strip(data, testCopyright)
+	Format(data)
+}
+
+func FuzzStrip(f *testing.F) {
+	f.Add(phoneJPEG(f, binary.LittleEndian, 6, testCopyright))
+	f.Add(phonePNG(f, binary.BigEndian, 3, testCopyright))
+	f.Add(phoneWebP(binary.LittleEndian, 8, testCopyright, true))
+	f.Add(testWebP(vp8l))
+	f.Fuzz(func(t *testing.T, data []byte) {
+		meta := Read(data)
+		if meta.Orientation < 1 || meta.Orientation > 8 {
+			t.Errorf("orientation = %d", meta.Orientation)
+		}
+		stripped, err := Strip(data, testCopyright)
+		if err != nil {
+			return
+		}
+		if _, err := Strip(stripped, testCopyright); err != nil {
+			t.Errorf("Strip of a stripped image = %v", err)
+		}
+	})
+}
@@ -0,0 +1,128 @@
+package imagemeta
+
+import (
+	"bytes"
+	"encoding/binary"
+)
+
+var exifHeader = []byte("Exif\x00\x00")
+
+const (
+	markerSOS   = 0xDA
+	markerAPP0  = 0xE0
+	markerAPP1  = 0xE1
+	markerAPP2  = 0xE2
+	markerAPP14 = 0xEE
+	markerCOM   = 0xFE
+)
+
+// jpegSegment is a marker segment from before the image data
+type jpegSegment struct {
+	marker  byte
+	raw     []byte
+	payload []byte
+}
+
+// jpegSegments splits a JPEG into the segments before the image data and the rest,
+// starting at the start of scan marker
+func jpegSegments(data []byte) ([]jpegSegment, []byte, error) {
+	var segments []jpegSegment
+	pos := 2
+	for {
+		if pos+2 > len(data) || data[pos] != 0xFF {
+			return nil, nil, errInvalidImage
+		}
+		marker := data[pos+1]
+		switch {
+		case marker == 0xFF:
+			// fill byte
+			pos++
+			continue
+		case marker == markerSOS:
+			return segments, data[pos:], nil
+		case marker == 0x01 || (marker >= 0xD0 && marker <= 0xD7):
+			// markers without a length
+			segments = append(segments, jpegSegment{marker: marker, raw: data[pos : pos+2]})
+			pos += 2
+			continue
+		}
+
+		if pos+4 > len(data) {
+			return nil, nil, errInvalidImage
+		}
+		length := int(binary.BigEndian.Uint16(data[pos+2:]))
+		end := pos + 2 + length
+		if length < 2 || end > len(data) {
+			return nil, nil, errInvalidImage
+		}
+		segments = append(segments, jpegSegment{marker: marker, raw: data[pos:end], payload: data[pos+4 : end]})
+		pos = end
+	}
+}
+
+func readJPEG(data []byte) Metadata {
+	segments, _, err := jpegSegments(data)
+	if err != nil {
+		return Metadata{Orientation: 1}
+	}
+	for _, segment := range segments {
+		if segment.marker == markerAPP1 && bytes.HasPrefix(segment.payload, exifHeader) {
+			return readTIFF(segment.payload[len(exifHeader):])
+		}
+	}
+	return Metadata{Orientation: 1}
+}
+
+func stripJPEG(data []byte, copyright string) ([]byte, error) {
+	segments, scan, err := jpegSegments(data)
+	if err != nil {
+		return nil, err
+	}
+
+	var out bytes.Buffer
+	out.Write(data[:2])
+	wroteCopyright := copyright == ""
+	for _, segment := range segments {
+		// JFIF wants its APP0 first, the copyright goes right after it
+		if !wroteCopyright && segment.marker != markerAPP0 {
+			writeJPEGExif(&out, copyright)
+			wroteCopyright = true
+		}
+		if keepJPEGSegment(segment) {
+			out.Write(segment.raw)
+		}
+	}
+	if !wroteCopyright {
+		writeJPEGExif(&out, copyright)
+	}
+	out.Write(scan)
+	return out.Bytes(), nil
+}
+
+func keepJPEGSegment(segment jpegSegment) bool {
+	switch {
+	case segment.marker == markerAPP0:
+		// JFIF
+		return true
+	case segment.marker == markerAPP2:
+		// the colour profile, but not the multi picture index that points into the file
+		return bytes.HasPrefix(segment.payload, []byte("ICC_PROFILE\x00"))
+	case segment.marker == markerAPP14:
+		// Adobe, tells how the colours are encoded
+		return true
+	case segment.marker >= markerAPP1 && segment.marker <= 0xEF:
+		// EXIF, XMP, IPTC and camera maker data
+		return false
+	case segment.marker == markerCOM:
+		return false
+	}
+	return true
+}
+
+func writeJPEGExif(out *bytes.Buffer, copyright string) {
+	tiff := copyrightTIFF(copyright)
+	out.Write([]byte{0xFF, markerAPP1})
+	binary.Write(out, binary.BigEndian, uint16(2+len(exifHeader)+len(tiff)))
+	out.Write(exifHeader)
+	out.Write(tiff)
+}
@@ -0,0 +1,71 @@
+package imagemeta
+
+import (
+	"image"
+	"image/color"
+	"strings"
+	"testing"
+)
+
+// letterImage is an image with a colour per letter, rows are separated by "/"
+func letterImage(rows string) *image.RGBA {
+	lines := strings.Split(rows, "/")
+	img := image.NewRGBA(image.Rect(0, 0, len(lines[0]), len(lines)))
+	for y, line := range lines {
+		for x, letter := range line {
+			img.Set(x, y, color.RGBA{R: uint8(letter), A: 255})
+		}
+	}
+	return img
+}
+
+func imageLetters(img image.Image) string {
+	bounds := img.Bounds()
+	var rows []string
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		var row strings.Builder
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			r, _, _, _ := img.At(x, y).RGBA()
+			row.WriteByte(byte(r >> 8))
+		}
+		rows = append(rows, row.String())
+	}
+	return strings.Join(rows, "/")
+}
+
+func TestOrient(t *testing.T) {
+	// the stored image, and how each orientation has to be turned to show it the
+	// right way up
+	const stored = "ABC/DEF"
+	tests := []struct {
+		orientation int
+		want        string
+	}{
+		{0, "ABC/DEF"},
+		{1, "ABC/DEF"},
+		{2, "CBA/FED"},
+		{3, "FED/CBA"},
+		{4, "DEF/ABC"},
+		{5, "AD/BE/CF"},
+		{6, "DA/EB/FC"},
+		{7, "FC/EB/DA"},
+		{8, "CF/BE/AD"},
+		{9, "ABC/DEF"},
+	}
+	for _, test := range tests {
+		got := Orient(letterImage(stored), test.orientation)
+		if letters := imageLetters(got); letters != test.want {
+			t.Errorf("Orient(%s, %d) = %s, want %s", stored, test.orientation, letters, test.want)
+		}
+		if got.Bounds().Min != (image.Point{}) {
+			t.Errorf("Orient(%d) bounds start at %v", test.orientation, got.Bounds().Min)
+		}
+	}
+}
+
+func TestOrientSubImage(t *testing.T) {
+	img := letterImage("xxxx/xABC/xDEF").SubImage(image.Rect(1, 1, 4, 3))
+	if got := imageLetters(Orient(img, 6)); got != "DA/EB/FC" {
+		t.Errorf("Orient of a sub image = %s, want DA/EB/FC", got)
+	}
+}
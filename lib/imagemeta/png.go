@@ -0,0 +1,138 @@
+package imagemeta
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"strings"
+)
+
+var pngSignature = []byte("\x89PNG\r\n\x1a\n")
+
+const pngCopyrightKeyword = "Copyright"
+
+// pngChunk is a chunk of a PNG, raw includes the length, type and CRC
+type pngChunk struct {
+	typ     string
+	raw     []byte
+	payload []byte
+}
+
+func pngChunks(data []byte) ([]pngChunk, error) {
+	var chunks []pngChunk
+	pos := len(pngSignature)
+	for pos < len(data) {
+		if pos+12 > len(data) {
+			return nil, errInvalidImage
+		}
+		length := int(binary.BigEndian.Uint32(data[pos:]))
+		end := pos + 12 + length
+		if length < 0 || end > len(data) {
+			return nil, errInvalidImage
+		}
+		chunks = append(chunks, pngChunk{
+			typ:     string(data[pos+4 : pos+8]),
+			raw:     data[pos:end],
+			payload: data[pos+8 : pos+8+length],
+		})
+		pos = end
+	}
+	return chunks, nil
+}
+
+func readPNG(data []byte) Metadata {
+	meta := Metadata{Orientation: 1}
+	chunks, err := pngChunks(data)
+	if err != nil {
+		return meta
+	}
+
+	for _, chunk := range chunks {
+		switch chunk.typ {
+		case "eXIf":
+			exif := readTIFF(chunk.payload)
+			meta.Orientation = exif.Orientation
+			if meta.Copyright == "" {
+				meta.Copyright = exif.Copyright
+			}
+		case "tEXt", "iTXt":
+			if copyright, ok := pngTextCopyright(chunk); ok {
+				meta.Copyright = copyright
+			}
+		}
+	}
+	return meta
+}
+
+// pngTextCopyright returns the text of an uncompressed Copyright text chunk
+func pngTextCopyright(chunk pngChunk) (string, bool) {
+	keyword, text, ok := bytes.Cut(chunk.payload, []byte{0})
+	if !ok || string(keyword) != pngCopyrightKeyword {
+		return "", false
+	}
+
+	if chunk.typ == "tEXt" {
+		// tEXt is Latin-1
+		runes := make([]rune, len(text))
+		for i, b := range text {
+			runes[i] = rune(b)
+		}
+		return strings.TrimSpace(string(runes)), true
+	}
+
+	// iTXt: compression flag, compression method, language tag and translated keyword
+	if len(text) < 2 || text[0] != 0 {
+		return "", false
+	}
+	rest := text[2:]
+	for range 2 {
+		_, after, ok := bytes.Cut(rest, []byte{0})
+		if !ok {
+			return "", false
+		}
+		rest = after
+	}
+	return strings.TrimSpace(string(rest)), true
+}
+
+func stripPNG(data []byte, copyright string) ([]byte, error) {
+	chunks, err := pngChunks(data)
+	if err != nil {
+		return nil, err
+	}
+
+	var out bytes.Buffer
+	out.Write(pngSignature)
+	for _, chunk := range chunks {
+		switch chunk.typ {
+		case "eXIf", "tEXt", "zTXt", "iTXt":
+			continue
+		}
+		out.Write(chunk.raw)
+		// the header always comes first, the copyright can follow it
+		if chunk.typ == "IHDR" && copyright != "" {
+			writePNGCopyright(&out, copyright)
+		}
+	}
+	return out.Bytes(), nil
+}
+
+func writePNGCopyright(out *bytes.Buffer, copyright string) {
+	if len(copyright) > maxCopyrightLength {
+		copyright = copyright[:maxCopyrightLength]
+	}
+
+	// an uncompressed iTXt without language, as tEXt can't hold UTF-8
+	var payload bytes.Buffer
+	payload.WriteString(pngCopyrightKeyword)
+	payload.Write([]byte{0, 0, 0, 0, 0})
+	payload.WriteString(copyright)
+
+	binary.Write(out, binary.BigEndian, uint32(payload.Len()))
+	crc := crc32.NewIEEE()
+	crc.Write([]byte("iTXt"))
+	crc.Write(payload.Bytes())
+	out.WriteString("iTXt")
+	out.Write(payload.Bytes())
+	binary.Write(out, binary.BigEndian, crc.Sum32())
+}
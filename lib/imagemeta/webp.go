@@ -0,0 +1,110 @@
+package imagemeta
+
+import (
+	"bytes"
+	"encoding/binary"
+)
+
+const (
+	webpFlagEXIF = 0x08
+	webpFlagXMP  = 0x04
+
+	// webpVP8XSize is the size of the extended header's payload
+	webpVP8XSize = 10
+)
+
+// webpChunk is a chunk of a WebP file, raw includes the header and padding
+type webpChunk struct {
+	fourCC  string
+	raw     []byte
+	payload []byte
+}
+
+func webpChunks(data []byte) ([]webpChunk, error) {
+	var chunks []webpChunk
+	pos := 12
+	for pos < len(data) {
+		if pos+8 > len(data) {
+			return nil, errInvalidImage
+		}
+		size := int(binary.LittleEndian.Uint32(data[pos+4:]))
+		end := pos + 8 + size + size%2
+		if size < 0 || pos+8+size > len(data) {
+			return nil, errInvalidImage
+		}
+		// some writers leave out the padding of the last chunk
+		end = min(end, len(data))
+		chunks = append(chunks, webpChunk{
+			fourCC:  string(data[pos : pos+4]),
+			raw:     data[pos:end],
+			payload: data[pos+8 : pos+8+size],
+		})
+		pos = end
+	}
+	return chunks, nil
+}
+
+func readWebP(data []byte) Metadata {
+	chunks, err := webpChunks(data)
+	if err != nil {
+		return Metadata{Orientation: 1}
+	}
+	for _, chunk := range chunks {
+		if chunk.fourCC == "EXIF" {
+			return readTIFF(bytes.TrimPrefix(chunk.payload, exifHeader))
+		}
+	}
+	return Metadata{Orientation: 1}
+}
+
+func stripWebP(data []byte, copyright string) ([]byte, error) {
+	chunks, err := webpChunks(data)
+	if err != nil {
+		return nil, err
+	}
+
+	// a simple WebP without the extended header can't carry EXIF, its copyright is lost
+	extended := len(chunks) > 0 && chunks[0].fourCC == "VP8X"
+	keepCopyright := copyright != "" && extended
+
+	var body bytes.Buffer
+	for _, chunk := range chunks {
+		switch chunk.fourCC {
+		case "EXIF", "XMP ":
+			continue
+		case "VP8X":
+			if len(chunk.payload) < webpVP8XSize {
+				return nil, errInvalidImage
+			}
+			header := append([]byte(nil), chunk.raw...)
+			flags := header[8] &^ (webpFlagEXIF | webpFlagXMP)
+			if keepCopyright {
+				flags |= webpFlagEXIF
+			}
+			header[8] = flags
+			body.Write(header)
+		default:
+			body.Write(chunk.raw)
+		}
+		// put back the padding a writer left out, or the chunks after it move
+		if body.Len()%2 == 1 {
+			body.WriteByte(0)
+		}
+	}
+	if keepCopyright {
+		tiff := copyrightTIFF(copyright)
+		body.WriteString("EXIF")
+		binary.Write(&body, binary.LittleEndian, uint32(len(tiff)))
+		body.Write(tiff)
+		if len(tiff)%2 == 1 {
+			body.WriteByte(0)
+		}
+	}
+
+	var out bytes.Buffer
+	out.WriteString("RIFF")
+	binary.Write(&out, binary.LittleEndian, uint32(4+body.Len()))
+	out.WriteString("WEBP")
+	out.Write(body.Bytes())
+	return out.Bytes(), nil
+}
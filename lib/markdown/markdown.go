@@ -0,0 +1,113 @@
+// Package markdown renders the small subset of Markdown used in newsletters:
+// headings, paragraphs, bullet and numbered lists, horizontal rules, bold,
+// italics and links. Everything else is shown as text.
+package markdown
+
+import (
+	"html"
+	"regexp"
+	"strings"
+)
+
+var (
+	linkPattern    = regexp.MustCompile(`\[([^\]]+)\]\(([^)\s]+)\)`)
+	boldPattern    = regexp.MustCompile(`\*\*([^*]+)\*\*`)
+	italicPattern  = regexp.MustCompile(`\*([^*]+)\*|_([^_]+)_`)
+	orderedPattern = regexp.MustCompile(`^\d+\.\s+`)
+)
+
+// ToHTML converts src to HTML. Raw HTML in src is escaped.
+func ToHTML(src string) string {
+	var out strings.Builder
+	var paragraph []string
+	listTag := ""
+
+	flushParagraph := func() {
+		if len(paragraph) > 0 {
+			out.WriteString("<p>" + strings.Join(paragraph, "<br>\n") + "</p>\n")
+			paragraph = nil
+		}
+	}
+	closeList := func() {
+		if listTag != "" {
+			out.WriteString("</" + listTag + ">\n")
+			listTag = ""
+		}
+	}
+	openList := func(tag string) {
+		if listTag != tag {
+			closeList()
+			out.WriteString("<" + tag + ">\n")
+			listTag = tag
+		}
+	}
+
+	for _, line := range strings.Split(strings.ReplaceAll(src, "\r\n", "\n"), "\n") {
+		trimmed := strings.TrimSpace(line)
+
+		switch {
+		case trimmed == "":
+			flushParagraph()
+			closeList()
+		case trimmed == "---" || trimmed == "***":
+			flushParagraph()
+			closeList()
+			out.WriteString("<hr>\n")
+		case headingLevel(trimmed) > 0:
+			flushParagraph()
+			closeList()
+			level := headingLevel(trimmed)
+			tag := "h" + string(rune('0'+level))
+			out.WriteString("<" + tag + ">" + inline(strings.TrimSpace(trimmed[level:])) + "</" + tag + ">\n")
+		case strings.HasPrefix(trimmed, "- ") || strings.HasPrefix(trimmed, "* "):
+			flushParagraph()
+			openList("ul")
+			out.WriteString("<li>" + inline(strings.TrimSpace(trimmed[2:])) + "</li>\n")
+		case orderedPattern.MatchString(trimmed):
+			flushParagraph()
+			openList("ol")
+			out.WriteString("<li>" + inline(orderedPattern.ReplaceAllString(trimmed, "")) + "</li>\n")
+		default:
+			closeList()
+			paragraph = append(paragraph, inline(trimmed))
+		}
+	}
+	flushParagraph()
+	closeList()
+
+	return out.String()
+}
+
+// headingLevel is 1-3 for "# ", "## " and "### " lines and 0 for anything else,
+// so "#hashtag" stays text
+func headingLevel(line string) int {
+	level := len(line) - len(strings.TrimLeft(line, "#"))
+	if level == 0 || level > 3 || !strings.HasPrefix(line[level:], " ") {
+		return 0
+	}
+	return level
+}
+
+// inline escapes text and applies links and emphasis
+func inline(text string) string {
+	text = html.EscapeString(text)
+
+	var out strings.Builder
+	last := 0
+	for _, match := range linkPattern.FindAllStringSubmatchIndex(text, -1) {
+		label, href := text[match[2]:match[3]], html.UnescapeString(text[match[4]:match[5]])
+		if !strings.HasPrefix(href, "http://") && !strings.HasPrefix(href, "https://") && !strings.HasPrefix(href, "mailto:") {
+			continue
+		}
+		out.WriteString(emphasis(text[last:match[0]]))
+		out.WriteString(`<a href="` + html.EscapeString(href) + `">` + emphasis(label) + `</a>`)
+		last = match[1]
+	}
+	out.WriteString(emphasis(text[last:]))
+	return out.String()
+}
+
+func emphasis(text string) string {
+	text = boldPattern.ReplaceAllString(text, "<strong>$1</strong>")
+	return italicPattern.ReplaceAllString(text, "<em>$1$2</em>")
+}
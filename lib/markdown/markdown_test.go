@@ -0,0 +1,76 @@
+package markdown
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestToHTML(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{"paragraph", "Hej\nvärlden", "<p>Hej<br>\nvärlden</p>\n"},
+		{"paragraphs", "a\n\nb", "<p>a</p>\n<p>b</p>\n"},
+		{"heading", "## Nya verk", "<h2>Nya verk</h2>\n"},
+		{"hashtag", "#utställning", "<p>#utställning</p>\n"},
+		{"too deep heading", "#### x", "<p>#### x</p>\n"},
+		{"bullet list", "- a\n* b", "<ul>\n<li>a</li>\n<li>b</li>\n</ul>\n"},
+		{"numbered list", "1. a\n2. b", "<ol>\n<li>a</li>\n<li>b</li>\n</ol>\n"},
+		{"rule", "a\n---\nb", "<p>a</p>\n<hr>\n<p>b</p>\n"},
+		{"emphasis", "**fet** och *kursiv* och _kursiv_", "<p><strong>fet</strong> och <em>kursiv</em> och <em>kursiv</em></p>\n"},
+		{"link", "[Galleriet](https://example.com/gallery)", `<p><a href="https://example.com/gallery">Galleriet</a></p>` + "\n"},
+		{"mailto link", "[Mejla](mailto:emma@example.com)", `<p><a href="mailto:emma@example.com">Mejla</a></p>` + "\n"},
+		{"crlf", "a\r\nb", "<p>a<br>\nb</p>\n"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := ToHTML(test.in); got != test.want {
+				t.Errorf("ToHTML(%q) =\n%q\nwant\n%q", test.in, got, test.want)
+			}
+		})
+	}
+}
+
+func TestToHTMLEscapesHTML(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{"script", "<script>alert(1)</script>", "<p>&lt;script&gt;alert(1)&lt;/script&gt;</p>\n"},
+		{"tag in heading", "# <img src=x onerror=alert(1)>", "<h1>&lt;img src=x onerror=alert(1)&gt;</h1>\n"},
+		{"tag in list", "- <b>a</b>", "<ul>\n<li>&lt;b&gt;a&lt;/b&gt;</li>\n</ul>\n"},
+		{"entities", `Tom & "Jerry"`, "<p>Tom &amp; &#34;Jerry&#34;</p>\n"},
+		{"tag in link label", "[<b>x</b>](https://example.com)", `<p><a href="https://example.com">&lt;b&gt;x&lt;/b&gt;</a></p>` + "\n"},
+		{"quote in link", `[x](https://example.com/"onmouseover="alert(1))`, `<p><a href="https://example.com/&#34;onmouseover=&#34;alert(1">x</a>)</p>` + "\n"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := ToHTML(test.in); got != test.want {
+				t.Errorf("ToHTML(%q) =\n%q\nwant\n%q", test.in, got, test.want)
+			}
+		})
+	}
+}
+
+func TestToHTMLRejectsUnsafeLinks(t *testing.T) {
+	for _, in := range []string{
+		"[x](javascript:alert(1))",
+		"[x](JavaScript:alert(1))",
+		"[x](javascript&#58;alert(1))",
+		"[x](data:text/html;base64,PHNjcmlwdD4=)",
+		"[x](vbscript:msgbox)",
+		"[x](//evil.example.com)",
+		"[x](/relative)",
+	} {
+		got := ToHTML(in)
+		if strings.Contains(got, "<a") {
+			t.Errorf("ToHTML(%q) = %q made a link", in, got)
+		}
+		if strings.Contains(got, "<script") {
+			t.Errorf("ToHTML(%q) = %q has a script", in, got)
+		}
+	}
+}
@@ -0,0 +1,251 @@
+// Package pdf writes simple A4 documents with text, lines and JPEG images using
+// the standard Helvetica fonts, enough for packing slips and invoices.
+package pdf
+
+import (
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"image"
+	"image/color"
+	_ "image/jpeg"
+	"io"
+	"slices"
+	"strings"
+)
+
+// A4 page size in points
+const (
+	PageWidth  = 595.28
+	PageHeight = 841.89
+)
+
+type Document struct {
+	pages  []*Page
+	images []*Image
+}
+
+type Page struct {
+	content bytes.Buffer
+	images  []*Image
+}
+
+type Image struct {
+	data       []byte
+	width      int
+	height     int
+	colorSpace string
+	name       string
+}
+
+func New() *Document {
+	return &Document{}
+}
+
+func (d *Document) AddPage() *Page {
+	page := &Page{}
+	d.pages = append(d.pages, page)
+	return page
+}
+
+// AddJPEG registers a JPEG image that can then be drawn on any page
+func (d *Document) AddJPEG(data []byte) (*Image, error) {
+	config, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	if format != "jpeg" {
+		return nil, fmt.Errorf("pdf: expected jpeg, got %s", format)
+	}
+
+	colorSpace := "DeviceRGB"
+	switch config.ColorModel {
+	case color.GrayModel:
+		colorSpace = "DeviceGray"
+	case color.CMYKModel:
+		colorSpace = "DeviceCMYK"
+	}
+
+	img := &Image{
+		data:       data,
+		width:      config.Width,
+		height:     config.Height,
+		colorSpace: colorSpace,
+		name:       fmt.Sprintf("Im%d", len(d.images)+1),
+	}
+	d.images = append(d.images, img)
+	return img, nil
+}
+
+// Text draws s with its baseline at x, y measured from the top left corner
+func (p *Page) Text(x, y, size float64, bold bool, s string) {
+	font := "F1"
+	if bold {
+		font = "F2"
+	}
+	fmt.Fprintf(&p.content, "BT /%s %.2f Tf %.2f %.2f Td (%s) Tj ET\n", font, size, x, PageHeight-y, encodeText(s))
+}
+
+// TextRight draws s so that it ends at x
+func (p *Page) TextRight(x, y, size float64, bold bool, s string) {
+	p.Text(x-TextWidth(s, size), y, size, bold, s)
+}
+
+func (p *Page) Line(x1, y1, x2, y2, width float64) {
+	fmt.Fprintf(&p.content, "%.2f w %.2f %.2f m %.2f %.2f l S\n", width, x1, PageHeight-y1, x2, PageHeight-y2)
+}
+
+// Image draws img in the box with its top left corner at x, y
+func (p *Page) Image(img *Image, x, y, width, height float64) {
+	if !slices.Contains(p.images, img) {
+		p.images = append(p.images, img)
+	}
+	fmt.Fprintf(&p.content, "q %.2f 0 0 %.2f %.2f %.2f cm /%s Do Q\n", width, height, x, PageHeight-y-height, img.name)
+}
+
+// Size returns the pixel size of the image
+func (img *Image) Size() (int, int) {
+	return img.width, img.height
+}
+
+// helveticaWidths are the glyph widths of Helvetica for ASCII 32-126, in 1/1000 em
+var helveticaWidths = [...]int{
+	278, 278, 355, 556, 556, 889, 667, 191, 333, 333, 389, 584, 278, 333, 278, 278,
+	556, 556, 556, 556, 556, 556, 556, 556, 556, 556, 278, 278, 584, 584, 584, 556,
+	1015, 667, 667, 722, 722, 667, 611, 778, 722, 278, 500, 667, 556, 833, 722, 778,
+	667, 778, 722, 667, 611, 722, 667, 944, 667, 667, 611, 278, 278, 278, 469, 556,
+	333, 556, 556, 500, 556, 556, 278, 556, 556, 222, 222, 500, 222, 833, 556, 556,
+	556, 556, 333, 500, 278, 556, 500, 722, 500, 500, 500, 334, 260, 334, 584,
+}
+
+// TextWidth approximates the width of s in points when set in Helvetica
+func TextWidth(s string, size float64) float64 {
+	total := 0
+	for _, r := range s {
+		if r >= 32 && r <= 126 {
+			total += helveticaWidths[r-32]
+		} else {
+			total += 556
+		}
+	}
+	return float64(total) * size / 1000
+}
+
+// winAnsi maps the characters outside Latin-1 that WinAnsiEncoding supports
+var winAnsi = map[rune]byte{
+	'€': 0x80, '‚': 0x82, '„': 0x84, '…': 0x85, '‘': 0x91, '’': 0x92,
+	'“': 0x93, '”': 0x94, '•': 0x95, '–': 0x96, '—': 0x97, '™': 0x99,
+}
+
+func encodeText(s string) string {
+	var builder strings.Builder
+	for _, r := range s {
+		var b byte
+		switch {
+		case r == '(' || r == ')' || r == '\\':
+			builder.WriteByte('\\')
+			b = byte(r)
+		case r < 0x80 || (r >= 0xA0 && r <= 0xFF):
+			b = byte(r)
+		default:
+			var ok bool
+			if b, ok = winAnsi[r]; !ok {
+				b = '?'
+			}
+		}
+		if b < 0x20 || b >= 0x80 {
+			fmt.Fprintf(&builder, "\\%03o", b)
+		} else {
+			builder.WriteByte(b)
+		}
+	}
+	return builder.String()
+}
+
+// Write renders the document as PDF
+func (d *Document) Write(w io.Writer) error {
+	var out bytes.Buffer
+	var offsets []int
+
+	beginObject := func() int {
+		offsets = append(offsets, out.Len())
+		number := len(offsets)
+		fmt.Fprintf(&out, "%d 0 obj\n", number)
+		return number
+	}
+	endObject := func() {
+		out.WriteString("endobj\n")
+	}
+
+	out.WriteString("%PDF-1.4\n%\xe2\xe3\xcf\xd3\n")
+
+	// objects 1 and 2 are the catalog and page tree, 3 and 4 the fonts
+	pagesObject := 2
+	beginObject()
+	fmt.Fprintf(&out, "<< /Type /Catalog /Pages %d 0 R >>\n", pagesObject)
+	endObject()
+
+	firstPageObject := 5 + len(d.images)
+	beginObject()
+	out.WriteString("<< /Type /Pages /Kids [")
+	for i := range d.pages {
+		fmt.Fprintf(&out, "%d 0 R ", firstPageObject+i*2)
+	}
+	fmt.Fprintf(&out, "] /Count %d >>\n", len(d.pages))
+	endObject()
+
+	for _, font := range []string{"Helvetica", "Helvetica-Bold"} {
+		beginObject()
+		fmt.Fprintf(&out, "<< /Type /Font /Subtype /Type1 /BaseFont /%s /Encoding /WinAnsiEncoding >>\n", font)
+		endObject()
+	}
+
+	imageObjects := make(map[*Image]int, len(d.images))
+	for _, img := range d.images {
+		number := beginObject()
+		imageObjects[img] = number
+		fmt.Fprintf(&out, "<< /Type /XObject /Subtype /Image /Width %d /Height %d /ColorSpace /%s /BitsPerComponent 8 /Filter /DCTDecode /Length %d >>\nstream\n", img.width, img.height, img.colorSpace, len(img.data))
+		out.Write(img.data)
+		out.WriteString("\nendstream\n")
+		endObject()
+	}
+
+	for _, page := range d.pages {
+		pageObject := beginObject()
+		fmt.Fprintf(&out, "<< /Type /Page /Parent %d 0 R /MediaBox [0 0 %.2f %.2f] /Contents %d 0 R /Resources << /Font << /F1 3 0 R /F2 4 0 R >>", pagesObject, PageWidth, PageHeight, pageObject+1)
+		if len(page.images) > 0 {
+			out.WriteString(" /XObject <<")
+			for _, img := range page.images {
+				fmt.Fprintf(&out, " /%s %d 0 R", img.name, imageObjects[img])
+			}
+			out.WriteString(" >>")
+		}
+		out.WriteString(" >> >>\n")
+		endObject()
+
+		var compressed bytes.Buffer
+		zw := zlib.NewWriter(&compressed)
+		if _, err := zw.Write(page.content.Bytes()); err != nil {
+			return err
+		}
+		if err := zw.Close(); err != nil {
+			return err
+		}
+
+		beginObject()
+		fmt.Fprintf(&out, "<< /Length %d /Filter /FlateDecode >>\nstream\n", compressed.Len())
+		out.Write(compressed.Bytes())
+		out.WriteString("\nendstream\n")
+		endObject()
+	}
+
+	xrefOffset := out.Len()
+	fmt.Fprintf(&out, "xref\n0 %d\n0000000000 65535 f \n", len(offsets)+1)
+	for _, offset := range offsets {
+		fmt.Fprintf(&out, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(&out, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(offsets)+1, xrefOffset)
+
+	_, err := w.Write(out.Bytes())
+	return err
+}
@@ -0,0 +1,138 @@
+package pdf
+
+import (
+	"bytes"
+	"compress/zlib"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestEncodeText(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{"plain", "Faktura 12", "Faktura 12"},
+		{"parentheses", "Print (A4)", `Print \(A4\)`},
+		{"unbalanced parenthesis", "a) b", `a\) b`},
+		{"backslash", `C:\temp`, `C:\\temp`},
+		{"escaped parenthesis", `\)`, `\\\)`},
+		{"latin-1", "Åsa Öberg", `\305sa \326berg`},
+		{"win-ansi", "100 €", `100 \200`},
+		{"unsupported", "日本", "??"},
+		{"newline", "a\nb", `a\012b`},
+		{"carriage return", "a\rb", `a\015b`},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := encodeText(test.in); got != test.want {
+				t.Errorf("encodeText(%q) = %q, want %q", test.in, got, test.want)
+			}
+		})
+	}
+}
+
+// TestEncodeTextStaysInString checks that no input can end the string operand
+// early, every parenthesis and backslash in the output must be escaped
+func TestEncodeTextStaysInString(t *testing.T) {
+	for _, in := range []string{"((", "))", `\`, `\\)`, ") Tj ET BT (", "a\\\nb)"} {
+		out := encodeText(in)
+		for i := 0; i < len(out); i++ {
+			switch out[i] {
+			case '\\':
+				// skip the escaped byte, or the octal digits
+				if i+1 < len(out) && out[i+1] >= '0' && out[i+1] <= '7' {
+					i += 3
+				} else {
+					i++
+				}
+			case '(', ')':
+				t.Errorf("encodeText(%q) = %q has an unescaped %q at %d", in, out, out[i], i)
+			}
+		}
+	}
+}
+
+func TestTextWidth(t *testing.T) {
+	tests := []struct {
+		in   string
+		size float64
+		want float64
+	}{
+		{"", 10, 0},
+		{"i", 10, 2.22},
+		{"W", 1000, 944},
+		{"ö", 10, 5.56},
+	}
+	for _, test := range tests {
+		if got := TextWidth(test.in, test.size); got != test.want {
+			t.Errorf("TextWidth(%q, %v) = %v, want %v", test.in, test.size, got, test.want)
+		}
+	}
+}
+
+func TestWrite(t *testing.T) {
+	doc := New()
+	page := doc.AddPage()
+	page.Text(10, 20, 12, false, `Anna (gallery) \ Co`)
+	page.Text(10, 40, 12, true, "Total")
+
+	var out bytes.Buffer
+	if err := doc.Write(&out); err != nil {
+		t.Fatal(err)
+	}
+	data := out.String()
+
+	if !strings.HasPrefix(data, "%PDF-1.4\n") || !strings.HasSuffix(data, "%%EOF\n") {
+		t.Fatalf("not a PDF:\n%s", data)
+	}
+
+	content := pageContent(t, data)
+	if want := `(Anna \(gallery\) \\ Co) Tj`; !strings.Contains(content, want) {
+		t.Errorf("page content %q doesn't contain %q", content, want)
+	}
+	if want := "/F2 12.00 Tf"; !strings.Contains(content, want) {
+		t.Errorf("page content %q doesn't set the bold font", content)
+	}
+
+	// the xref table must point at the objects
+	startxref := regexp.MustCompile(`startxref\n(\d+)\n`).FindStringSubmatch(data)
+	if startxref == nil || !strings.HasPrefix(data[atoi(t, startxref[1]):], "xref\n") {
+		t.Errorf("startxref doesn't point at the xref table")
+	}
+	for _, offset := range regexp.MustCompile(`(\d{10}) 00000 n `).FindAllStringSubmatch(data, -1) {
+		if !regexp.MustCompile(`^\d+ 0 obj\n`).MatchString(data[atoi(t, offset[1]):]) {
+			t.Errorf("xref offset %s doesn't point at an object", offset[1])
+		}
+	}
+}
+
+func pageContent(t *testing.T, data string) string {
+	t.Helper()
+	match := regexp.MustCompile(`(?s)/Filter /FlateDecode >>\nstream\n(.*?)\nendstream`).FindStringSubmatch(data)
+	if match == nil {
+		t.Fatal("no page content stream")
+	}
+	reader, err := zlib.NewReader(strings.NewReader(match[1]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	content, err := io.ReadAll(reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(content)
+}
+
+func atoi(t *testing.T, s string) int {
+	t.Helper()
+	n, err := strconv.Atoi(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return n
+}
@@ -20,6 +20,7 @@ var routes = []partial.Route{
 	{Path: "/gallery", Name: "ref:gallery_title", InSidebar: true},
 	{Path: "/buyart", Name: "ref:buy_art_title", InSidebar: true},
 	{Path: "/prints", Name: "ref:prints_title", InSidebar: true},
+	{Path: "/commission", Name: "Beställ verk", InSidebar: true},
 	{Path: "/about", Name: "ref:about_me_title", InSidebar: true},
 }
 
@@ -28,6 +29,7 @@ func main() {
 	if err != nil {
 		log.Println("No .env file found, proceeding without it")
 	}
+	services.WarnIfSiteURLMissing()
 
 	// Initialize handlers with services
 	r := chi.NewRouter()
@@ -52,6 +54,13 @@ func main() {
 	h := handlers.NewHandler(db, routes, imageUploader, cartService)
 	registerMiddlewares(r)
 	registerRoutes(h, r, sessionStore)
+	h.ResumeNewsletters()
+	h.StartImageGC()
+	go func() {
+		// placeholders are quick to make, renditions can take minutes per image
+		h.CreateMissingPlaceholders()
+		h.CreateMissingRenditions()
+	}()
 
 	port := ":8080"
 	log.Printf("Server starting on %s\n", port)
@@ -69,9 +78,18 @@ func registerRoutes(h *handlers.Handler, r chi.Router, sessionStore *authmw.Sess
 	h.RegisterAPIRoutes(r)
 	h.RegisterArtPrintRoutes(r)
 	h.RegisterCartRoutes(r)
+	h.RegisterWaitlistRoutes(r)
 	h.RegisterOrderRoutes(r, sessionStore)
+	h.RegisterOrderDocumentRoutes(r, sessionStore)
+	h.RegisterInquiryRoutes(r, sessionStore)
+	h.RegisterCommissionRoutes(r, sessionStore)
 	h.RegisterAuthRoutes(r, sessionStore)
 	h.RegisterEditRoutes(r, sessionStore)
+	h.RegisterPrintVariantRoutes(r, sessionStore)
+	h.RegisterDiscountRoutes(r, sessionStore)
+	h.RegisterGiftCardRoutes(r, sessionStore)
+	h.RegisterNewsletterRoutes(r, sessionStore)
+	h.RegisterImageRoutes(r, sessionStore)
 }
 
 func registerMiddlewares(r chi.Router) {
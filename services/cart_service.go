@@ -7,10 +7,32 @@ import (
 	"net/http"
 )
 
+const (
+	CartItemTypePrint    = "print"
+	CartItemTypeGiftCard = "giftcard"
+	CartItemTypeOriginal = "original"
+
+	// CartItemTypeCommission is the deposit of an accepted commission, with the
+	// commission ID as PrintID. It is never in the cart, the order row is created
+	// when the quote is accepted.
+	CartItemTypeCommission = "commission"
+)
+
+// GiftCardAmounts are the gift card values that can be bought, in kr
+var GiftCardAmounts = []int{250, 500, 1000}
+
+// CartItem is one line in the cart cookie. For originals PrintID holds the art ID,
+// for gift cards it holds the amount in kr. VariantID is set for prints sold in variants.
 type CartItem struct {
-	PrintID  string `json:"print_id"`
-	Typ      string `json:"typ"`
-	Quantity int    `json:"quantity"`
+	PrintID   string `json:"print_id"`
+	VariantID string `json:"variant_id,omitempty"`
+	Typ       string `json:"typ"`
+	Quantity  int    `json:"quantity"`
+}
+
+// Is reports whether the item is the given product
+func (item CartItem) Is(printID, typ, variantID string) bool {
+	return item.PrintID == printID && item.Typ == typ && item.VariantID == variantID
 }
 
 type CartService struct {
@@ -59,3 +81,48 @@ func (c *CartService) SaveCart(w http.ResponseWriter, cart []CartItem) error {
 	http.SetCookie(w, cookie)
 	return nil
 }
+
+func getCookieValue(r *http.Request, name string) string {
+	cookie, err := r.Cookie(name)
+	if err != nil {
+		return ""
+	}
+	return cookie.Value
+}
+
+func saveCookieValue(w http.ResponseWriter, name string, value string) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     name,
+		Value:    value,
+		Path:     "/",
+		HttpOnly: true,
+	})
+}
+
+func (c *CartService) GetCountry(r *http.Request) string {
+	country := getCookieValue(r, "cart_country")
+	if country == "" {
+		return DefaultShippingCountry
+	}
+	return country
+}
+
+func (c *CartService) SaveCountry(w http.ResponseWriter, country string) {
+	saveCookieValue(w, "cart_country", country)
+}
+
+func (c *CartService) GetGiftCardCode(r *http.Request) string {
+	return getCookieValue(r, "cart_giftcard")
+}
+
+func (c *CartService) SaveGiftCardCode(w http.ResponseWriter, code string) {
+	saveCookieValue(w, "cart_giftcard", code)
+}
+
+func (c *CartService) GetDiscountCode(r *http.Request) string {
+	return getCookieValue(r, "cart_discount")
+}
+
+func (c *CartService) SaveDiscountCode(w http.ResponseWriter, code string) {
+	saveCookieValue(w, "cart_discount", code)
+}
@@ -0,0 +1,119 @@
+package services
+
+import (
+	"net/mail"
+	"regexp"
+	"strings"
+)
+
+// Checkout form fields, also used as keys for the per-field errors
+const (
+	CheckoutFieldName       = "name"
+	CheckoutFieldEmail      = "email"
+	CheckoutFieldAddress    = "address"
+	CheckoutFieldPostalCode = "postal_code"
+	CheckoutFieldCity       = "city"
+	CheckoutFieldPhone      = "phone"
+	CheckoutFieldCountry    = "country"
+
+	// CheckoutFieldCart holds problems with the cart itself rather than a form field
+	CheckoutFieldCart = "cart"
+)
+
+var CheckoutFields = []string{
+	CheckoutFieldName,
+	CheckoutFieldEmail,
+	CheckoutFieldAddress,
+	CheckoutFieldPostalCode,
+	CheckoutFieldCity,
+	CheckoutFieldPhone,
+	CheckoutFieldCountry,
+	CheckoutFieldCart,
+}
+
+// CheckoutForm is the buyer's contact and delivery details
+type CheckoutForm struct {
+	Name       string
+	Email      string
+	Address    string
+	PostalCode string
+	City       string
+	Country    string
+	Phone      string
+}
+
+// CheckoutErrors maps a checkout field to the message shown next to it
+type CheckoutErrors map[string]string
+
+var (
+	swedishPostalCode = regexp.MustCompile(`^\d{3} ?\d{2}$`)
+	phoneNumber       = regexp.MustCompile(`^\+?[0-9 ()-]{6,20}$`)
+)
+
+// Normalize trims the fields and formats Swedish postal codes as "123 45"
+func (form CheckoutForm) Normalize() CheckoutForm {
+	form.Name = strings.TrimSpace(form.Name)
+	form.Email = strings.TrimSpace(form.Email)
+	form.Address = strings.TrimSpace(form.Address)
+	form.PostalCode = strings.ToUpper(strings.TrimSpace(form.PostalCode))
+	form.City = strings.TrimSpace(form.City)
+	form.Phone = strings.TrimSpace(form.Phone)
+
+	if form.Country == "SE" && swedishPostalCode.MatchString(form.PostalCode) {
+		digits := strings.ReplaceAll(form.PostalCode, " ", "")
+		form.PostalCode = digits[:3] + " " + digits[3:]
+	}
+	return form
+}
+
+// ValidateCheckoutForm checks a normalized form. The postal address is only
+// required when something in the order has to be shipped.
+func ValidateCheckoutForm(form CheckoutForm, needsAddress bool) CheckoutErrors {
+	errors := CheckoutErrors{}
+
+	if form.Name == "" {
+		errors[CheckoutFieldName] = "Ange ditt namn"
+	}
+	if form.Email == "" {
+		errors[CheckoutFieldEmail] = "Ange din e-postadress"
+	} else if !IsValidEmail(form.Email) {
+		errors[CheckoutFieldEmail] = "Ange en giltig e-postadress"
+	}
+	if form.Phone != "" && !phoneNumber.MatchString(form.Phone) {
+		errors[CheckoutFieldPhone] = "Ange ett giltigt telefonnummer"
+	}
+	// the cart only offers the listed countries, anything else would get the
+	// rest of the world rate without anyone noticing
+	if !IsShippingCountry(form.Country) {
+		errors[CheckoutFieldCountry] = "Välj ett leveransland i listan"
+	}
+
+	if !needsAddress {
+		return errors
+	}
+
+	if form.Address == "" {
+		errors[CheckoutFieldAddress] = "Ange din gatuadress"
+	}
+	if form.City == "" {
+		errors[CheckoutFieldCity] = "Ange ort"
+	}
+	switch {
+	case form.PostalCode == "":
+		errors[CheckoutFieldPostalCode] = "Ange postnummer"
+	case form.Country == "SE" && !swedishPostalCode.MatchString(form.PostalCode):
+		errors[CheckoutFieldPostalCode] = "Postnumret ska ha fem siffror"
+	}
+
+	return errors
+}
+
+// IsValidEmail accepts a bare address like "name@example.com" with a dot in the domain
+func IsValidEmail(email string) bool {
+	address, err := mail.ParseAddress(email)
+	if err != nil || address.Name != "" || address.Address != email {
+		return false
+	}
+	domain := email[strings.LastIndex(email, "@")+1:]
+	return strings.Contains(domain, ".") && !strings.HasSuffix(domain, ".")
+}
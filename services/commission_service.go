@@ -0,0 +1,161 @@
+package services
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sebwib/emma-site-htmx/db"
+)
+
+// Commission form fields, also used as keys for the per-field errors
+const (
+	CommissionFieldName        = "name"
+	CommissionFieldEmail       = "email"
+	CommissionFieldSubject     = "subject"
+	CommissionFieldSize        = "size"
+	CommissionFieldBudget      = "budget"
+	CommissionFieldDeadline    = "deadline"
+	CommissionFieldDescription = "description"
+	CommissionFieldReferences  = "references"
+)
+
+const (
+	// CommissionMaxReferences is the number of reference images that can be uploaded
+	CommissionMaxReferences = 5
+
+	CommissionMaxDescriptionLength = 5000
+)
+
+// CommissionForm is what the requester fills in. Budget is kept as typed so the
+// form can be shown again with the same value.
+type CommissionForm struct {
+	Name        string
+	Email       string
+	Subject     string
+	Size        string
+	Budget      string
+	Deadline    string
+	Description string
+}
+
+// CommissionErrors maps a commission field to the message shown next to it
+type CommissionErrors map[string]string
+
+func (form CommissionForm) Normalize() CommissionForm {
+	form.Name = strings.TrimSpace(form.Name)
+	form.Email = strings.TrimSpace(form.Email)
+	form.Subject = strings.TrimSpace(form.Subject)
+	form.Size = strings.TrimSpace(form.Size)
+	form.Budget = strings.ReplaceAll(strings.TrimSpace(form.Budget), " ", "")
+	form.Deadline = strings.TrimSpace(form.Deadline)
+	form.Description = strings.TrimSpace(form.Description)
+	return form
+}
+
+// BudgetAmount is the budget in kr, 0 when none was given
+func (form CommissionForm) BudgetAmount() float64 {
+	budget, _ := strconv.ParseFloat(form.Budget, 64)
+	return budget
+}
+
+// ValidateCommissionForm checks a normalized form. Reference images are checked
+// when they are uploaded.
+func ValidateCommissionForm(form CommissionForm) CommissionErrors {
+	errors := CommissionErrors{}
+
+	if form.Name == "" {
+		errors[CommissionFieldName] = "Ange ditt namn"
+	}
+	if form.Email == "" {
+		errors[CommissionFieldEmail] = "Ange din e-postadress"
+	} else if !IsValidEmail(form.Email) {
+		errors[CommissionFieldEmail] = "Ange en giltig e-postadress"
+	}
+	if form.Subject == "" {
+		errors[CommissionFieldSubject] = "Beskriv kort vad du vill beställa"
+	}
+	if form.Budget != "" {
+		if budget, err := strconv.ParseFloat(form.Budget, 64); err != nil || budget < 0 {
+			errors[CommissionFieldBudget] = "Ange budgeten i kronor"
+		}
+	}
+	if form.Deadline != "" {
+		deadline, err := time.Parse(time.DateOnly, form.Deadline)
+		if err != nil {
+			errors[CommissionFieldDeadline] = "Ange ett giltigt datum"
+		} else if deadline.Before(time.Now().Truncate(24 * time.Hour)) {
+			errors[CommissionFieldDeadline] = "Datumet har redan passerat"
+		}
+	}
+	if len(form.Description) > CommissionMaxDescriptionLength {
+		errors[CommissionFieldDescription] = "Beskrivningen är för lång"
+	}
+
+	return errors
+}
+
+// CommissionStatusToString is the admin label of a status
+func CommissionStatusToString(status db.CommissionStatus) string {
+	switch status {
+	case db.CommissionStatusNew:
+		return "New"
+	case db.CommissionStatusQuoted:
+		return "Quoted"
+	case db.CommissionStatusAccepted:
+		return "Accepted"
+	case db.CommissionStatusInProgress:
+		return "In progress"
+	case db.CommissionStatusDelivered:
+		return "Delivered"
+	default:
+		return string(status)
+	}
+}
+
+// CommissionURL is the requester's private link to the commission and its quote
+func CommissionURL(commission db.Commission) string {
+	return SiteURL("/commission/" + commission.Token)
+}
+
+// SendCommissionRequest tells the artist about a new commission request
+func SendCommissionRequest(commission db.Commission) error {
+	subject := "New commission request: " + commission.Subject
+	body := "You have received a new commission request:\n\n"
+	body += "Name: " + commission.Name + "\n"
+	body += "Email: " + commission.Email + "\n"
+	body += "Subject: " + commission.Subject + "\n"
+	if commission.Size != "" {
+		body += "Size: " + commission.Size + "\n"
+	}
+	if commission.Budget > 0 {
+		body += fmt.Sprintf("Budget: %.0f kr\n", commission.Budget)
+	}
+	if commission.Deadline != "" {
+		body += "Deadline: " + commission.Deadline + "\n"
+	}
+	if commission.Description != "" {
+		body += "\n" + commission.Description + "\n"
+	}
+	body += fmt.Sprintf("\nReference images: %d\n", len(commission.References))
+	body += "Commissions: " + SiteURL("/edit/commissions") + "\n"
+
+	return sendEmail(subject, body)
+}
+
+// SendCommissionQuote sends the quote to the requester with the link to accept it
+func SendCommissionQuote(commission db.Commission) error {
+	subject := "Offert på ditt beställningsverk"
+	body := "Hej " + commission.Name + "!\n\n"
+	body += "Tack för din förfrågan om \"" + commission.Subject + "\". Här kommer min offert:\n\n"
+	body += fmt.Sprintf("Pris: %.0f kr\n", commission.QuoteAmount)
+	body += fmt.Sprintf("Handpenning: %.0f kr\n", commission.DepositAmount)
+	if commission.QuoteNote != "" {
+		body += "\n" + commission.QuoteNote + "\n"
+	}
+	body += "\nHandpenningen betalas när du accepterar offerten, resten när verket är klart.\n"
+	body += "Läs offerten och acceptera den här:\n" + CommissionURL(commission) + "\n"
+
+	return sendEmailTo(commission.Email, subject, body)
+}
@@ -0,0 +1,86 @@
+package services
+
+import (
+	"errors"
+	"math"
+	"slices"
+	"time"
+
+	"github.com/sebwib/emma-site-htmx/db"
+)
+
+var (
+	ErrDiscountInactive    = errors.New("discount code is not active")
+	ErrDiscountNotStarted  = errors.New("discount code is not valid yet")
+	ErrDiscountExpired     = errors.New("discount code has expired")
+	ErrDiscountUsedUp      = errors.New("discount code has been used up")
+	ErrDiscountNotEligible = errors.New("discount code does not apply to the cart")
+)
+
+// DiscountLine is one cart line as seen by the discount calculation
+type DiscountLine struct {
+	PrintID string
+	Total   float64
+}
+
+func ValidateDiscountCode(code *db.DiscountCode, now time.Time) error {
+	if !code.Active {
+		return ErrDiscountInactive
+	}
+	if code.ValidFrom != "" {
+		if validFrom, err := time.Parse(time.RFC3339, code.ValidFrom); err == nil && now.Before(validFrom) {
+			return ErrDiscountNotStarted
+		}
+	}
+	if code.ValidTo != "" {
+		if validTo, err := time.Parse(time.RFC3339, code.ValidTo); err == nil && now.After(validTo) {
+			return ErrDiscountExpired
+		}
+	}
+	if code.MaxUses > 0 && code.UsedCount >= code.MaxUses {
+		return ErrDiscountUsedUp
+	}
+	return nil
+}
+
+// DiscountAmount returns how much the code takes off the given lines, never more than they cost
+func DiscountAmount(code *db.DiscountCode, lines []DiscountLine) (float64, error) {
+	eligible := 0.0
+	for _, line := range lines {
+		if len(code.PrintIDs) > 0 && !slices.Contains(code.PrintIDs, line.PrintID) {
+			continue
+		}
+		eligible += line.Total
+	}
+
+	if eligible == 0 {
+		return 0, ErrDiscountNotEligible
+	}
+
+	var amount float64
+	switch code.Kind {
+	case db.DiscountKindPercent:
+		amount = math.Round(eligible * code.Amount / 100)
+	case db.DiscountKindFixed:
+		amount = code.Amount
+	}
+
+	return min(amount, eligible), nil
+}
+
+func DiscountErrorToString(err error) string {
+	switch {
+	case errors.Is(err, ErrDiscountInactive):
+		return "Rabattkoden är inte aktiv"
+	case errors.Is(err, ErrDiscountNotStarted):
+		return "Rabattkoden gäller inte ännu"
+	case errors.Is(err, ErrDiscountExpired):
+		return "Rabattkoden har gått ut"
+	case errors.Is(err, ErrDiscountUsedUp), errors.Is(err, db.ErrDiscountCodeExhausted):
+		return "Rabattkoden är förbrukad"
+	case errors.Is(err, ErrDiscountNotEligible):
+		return "Rabattkoden gäller inte för varorna i kundvagnen"
+	default:
+		return "Ogiltig rabattkod"
+	}
+}
@@ -1,42 +1,99 @@
 package services
 
 import (
+	"bytes"
 	"fmt"
+	"log"
 	"os"
+	"strings"
 
 	"github.com/sebwib/emma-site-htmx/db"
 	gomail "gopkg.in/mail.v2"
 )
 
-func sendEmail(subject string, body string) error {
-	googleAppPassword := os.Getenv("GOOGLE_APP_PASSWORD")
-	fromAddress := os.Getenv("EMAIL_SENDER_ADDRESS")
-	recipientAddress := os.Getenv("EMAIL_RECIPIENT_ADDRESS")
+// defaultSiteURL is used for links when SITE_BASE_URL isn't set, which is only right
+// when running the site locally
+const defaultSiteURL = "http://localhost:8080"
 
-	if fromAddress == "" || recipientAddress == "" || googleAppPassword == "" {
-		return fmt.Errorf("email configuration is missing")
+// SiteURL builds an absolute link to a page on the site, using SITE_BASE_URL
+func SiteURL(path string) string {
+	base := strings.TrimRight(os.Getenv("SITE_BASE_URL"), "/")
+	if base == "" {
+		base = defaultSiteURL
+	}
+	return base + path
+}
+
+// WarnIfSiteURLMissing logs a warning at startup when SITE_BASE_URL isn't set, as
+// the links in order, newsletter and waitlist emails would point at localhost
+func WarnIfSiteURLMissing() {
+	if strings.TrimSpace(os.Getenv("SITE_BASE_URL")) == "" {
+		log.Printf("SITE_BASE_URL is not set, links in emails point at %s", defaultSiteURL)
+	}
+}
+
+// OrderURL is the buyer's private link to their order
+func OrderURL(order db.Order) string {
+	return SiteURL("/order/" + order.AccessToken)
+}
+
+// OrderNumber is the short order reference shown to buyers
+func OrderNumber(order db.Order) string {
+	if len(order.OrderID) < 8 {
+		return strings.ToUpper(order.OrderID)
 	}
+	return strings.ToUpper(order.OrderID[:8])
+}
+
+func sendEmail(subject string, body string) error {
+	return sendEmailTo(os.Getenv("EMAIL_RECIPIENT_ADDRESS"), subject, body)
+}
+
+// EmailAttachment is a file sent along with an email
+type EmailAttachment struct {
+	Name string
+	Data []byte
+}
+
+func sendEmailTo(recipientAddress string, subject string, body string) error {
+	return sendEmailWithAttachments(recipientAddress, subject, body, nil)
+}
 
+func sendEmailWithAttachments(recipientAddress string, subject string, body string, attachments []EmailAttachment) error {
 	// Create a new message
 	message := gomail.NewMessage()
 
 	// Set email headers
-	message.SetHeader("From", fromAddress)
 	message.SetHeader("To", recipientAddress)
 	message.SetHeader("Subject", subject)
 	message.SetBody("text/plain", body)
 
+	for _, attachment := range attachments {
+		message.AttachReader(attachment.Name, bytes.NewReader(attachment.Data))
+	}
+
+	return sendMessage(message)
+}
+
+// sendMessage sends a message that has its recipient and content set, from the site's address
+func sendMessage(message *gomail.Message) error {
+	googleAppPassword := os.Getenv("GOOGLE_APP_PASSWORD")
+	fromAddress := os.Getenv("EMAIL_SENDER_ADDRESS")
+
+	if fromAddress == "" || len(message.GetHeader("To")) == 0 || message.GetHeader("To")[0] == "" || googleAppPassword == "" {
+		return fmt.Errorf("email configuration is missing")
+	}
+	message.SetHeader("From", fromAddress)
+
 	// Set up the SMTP dialer
 	dialer := gomail.NewDialer("smtp.gmail.com", 587, fromAddress, googleAppPassword)
 
 	// Send the email
 	if err := dialer.DialAndSend(message); err != nil {
-		fmt.Println("Error:", err)
-		panic(err)
-	} else {
-		fmt.Println("Email sent successfully!")
+		return fmt.Errorf("failed to send email: %w", err)
 	}
 
+	fmt.Println("Email sent successfully!")
 	return nil
 }
 
@@ -48,6 +105,142 @@ func SendOrder(buyerEmail string, order db.Order) error {
 	for _, item := range order.Rows {
 		body += fmt.Sprintf("- Print ID: %s, Type: %s, Quantity: %d, Price per unit: %.2f\n", item.Title, item.Typ, item.Quantity, item.Price)
 	}
+	if order.DiscountCode != "" {
+		body += fmt.Sprintf("\nDiscount code: %s, Discount: -%.2f", order.DiscountCode, order.DiscountAmount)
+	}
+	body += fmt.Sprintf("\nShipping to: %s, Cost: %.2f\n", ShippingCountryName(order.Country), order.ShippingCost)
+	for _, line := range order.AddressLines() {
+		body += "  " + line + "\n"
+	}
+	if order.Phone != "" {
+		body += "  Phone: " + order.Phone + "\n"
+	}
+	body += fmt.Sprintf("Total: %.2f\n", order.TotalPrice)
+	if order.GiftCardCode != "" {
+		body += fmt.Sprintf("Gift card: %s, Redeemed: %.2f, Amount due: %.2f\n", order.GiftCardCode, order.GiftCardAmount, order.AmountDue())
+	}
+	body += "\nBuyer's order page: " + OrderURL(order) + "\n"
 
 	return sendEmail(subject, body)
 }
+
+// SendOrderConfirmation tells the buyer the order was received and links to the order page
+func SendOrderConfirmation(order db.Order, paymentInstructions string) error {
+	subject := "Orderbekräftelse " + OrderNumber(order)
+	body := "Tack för din beställning!\n\n"
+	body += "Ordernummer: " + OrderNumber(order) + "\n\n"
+	for _, item := range order.Rows {
+		body += fmt.Sprintf("- %s, %d st à %.0f kr\n", item.Title, item.Quantity, item.Price)
+	}
+	if order.DiscountCode != "" {
+		body += fmt.Sprintf("Rabatt (%s): -%.0f kr\n", order.DiscountCode, order.DiscountAmount)
+	}
+	body += fmt.Sprintf("Frakt till %s: %.0f kr\n", ShippingCountryName(order.Country), order.ShippingCost)
+	body += fmt.Sprintf("Totalt: %.0f kr\n", order.TotalPrice)
+	if order.GiftCardCode != "" {
+		body += fmt.Sprintf("Presentkort (%s): -%.0f kr\n", order.GiftCardCode, order.GiftCardAmount)
+		body += fmt.Sprintf("Att betala: %.0f kr\n", order.AmountDue())
+	}
+	if paymentInstructions != "" {
+		body += "\n" + paymentInstructions + "\n"
+	}
+	body += "\nFölj din beställning här:\n" + OrderURL(order) + "\n"
+
+	return sendEmailTo(order.BuyerEmail, subject, body)
+}
+
+func SendGiftCard(email string, card db.GiftCard) error {
+	subject := "Ditt presentkort från Emma Jelk"
+	body := "Tack för ditt köp!\n\n"
+	body += fmt.Sprintf("Presentkortskod: %s\n", card.Code)
+	body += fmt.Sprintf("Värde: %.0f kr\n\n", card.InitialAmount)
+	body += "Ange koden i kundvagnen för att lösa in presentkortet. Det kan användas vid flera köp tills saldot är slut.\n"
+
+	return sendEmailTo(email, subject, body)
+}
+
+// SendOrderShipped tells the buyer the order is on its way, with tracking when available
+func SendOrderShipped(order db.Order) error {
+	subject := "Din beställning " + OrderNumber(order) + " har skickats"
+	body := "Hej!\n\nDin beställning " + OrderNumber(order) + " har skickats.\n\n"
+	for _, item := range order.Rows {
+		body += fmt.Sprintf("- %s, %d st\n", item.Title, item.Quantity)
+	}
+	if order.TrackingNumber != "" {
+		carrier := Carrier(order.Carrier)
+		body += fmt.Sprintf("\nFraktbolag: %s\nSpårningsnummer: %s\n", CarrierName(carrier), order.TrackingNumber)
+		if trackingURL := TrackingURL(carrier, order.TrackingNumber); trackingURL != "" {
+			body += "Spåra paketet: " + trackingURL + "\n"
+		}
+	}
+	if order.AccessToken != "" {
+		body += "\nDin ordersida: " + OrderURL(order) + "\n"
+	}
+
+	return sendEmailTo(order.BuyerEmail, subject, body)
+}
+
+// SendOrderCancelled tells the buyer the order was cancelled because it wasn't paid
+func SendOrderCancelled(order db.Order) error {
+	subject := "Din beställning " + OrderNumber(order) + " har avbrutits"
+	body := "Hej!\n\nDin beställning " + OrderNumber(order) + " har avbrutits eftersom den inte betalades.\n\n"
+	for _, item := range order.Rows {
+		body += fmt.Sprintf("- %s, %d st\n", item.Title, item.Quantity)
+	}
+	body += "\nHar du redan betalat, eller vill du fortfarande ha något av det? Svara på det här mejlet så hjälper vi dig.\n"
+
+	return sendEmailTo(order.BuyerEmail, subject, body)
+}
+
+// SendBackInStock tells someone on the waitlist that the print can be bought again
+func SendBackInStock(entry db.WaitlistEntry, printTitle string) error {
+	subject := printTitle + " finns i lager igen"
+	body := "Hej!\n\n"
+	body += fmt.Sprintf("%s som du bevakar finns i lager igen.\n\n", printTitle)
+	body += "Till printen: " + SiteURL("/prints") + "\n\n"
+	body += "Vill du inte längre få mejl om printen kan du avsluta bevakningen här:\n"
+	body += SiteURL("/waitlist/unsubscribe/"+entry.Token) + "\n"
+
+	return sendEmailTo(entry.Email, subject, body)
+}
+
+// SendInquiry forwards an inquiry to the artist. Replying to the email answers the buyer.
+func SendInquiry(inquiry db.Inquiry) error {
+	subject := "New inquiry from " + inquiry.Name
+	if inquiry.ArtTitle != "" {
+		subject += " about " + inquiry.ArtTitle
+	}
+	body := "You have received a new inquiry:\n\n"
+	body += "Name: " + inquiry.Name + "\n"
+	body += "Email: " + inquiry.Email + "\n"
+	if inquiry.ArtTitle != "" {
+		body += "Artwork: " + inquiry.ArtTitle + "\n"
+	}
+	body += "\n" + inquiry.Message + "\n\n"
+	body += "Inbox: " + SiteURL("/edit/inquiries") + "\n"
+
+	message := gomail.NewMessage()
+	message.SetHeader("To", os.Getenv("EMAIL_RECIPIENT_ADDRESS"))
+	message.SetHeader("Reply-To", inquiry.Email)
+	message.SetHeader("Subject", subject)
+	message.SetBody("text/plain", body)
+
+	return sendMessage(message)
+}
+
+// SendInvoice emails the invoice PDF to the buyer
+func SendInvoice(order db.Order, invoice []byte) error {
+	subject := fmt.Sprintf("Faktura %d från Emma Jelk", order.InvoiceNumber)
+	body := "Hej!\n\nHär kommer fakturan för din beställning " + OrderNumber(order) + ".\n"
+	if order.AccessToken != "" {
+		body += "\nDin ordersida: " + OrderURL(order) + "\n"
+	}
+
+	return sendEmailWithAttachments(order.BuyerEmail, subject, body, []EmailAttachment{
+		{Name: InvoiceFilename(order), Data: invoice},
+	})
+}
+
+func InvoiceFilename(order db.Order) string {
+	return fmt.Sprintf("faktura-%d.pdf", order.InvoiceNumber)
+}
@@ -0,0 +1,107 @@
+package services
+
+import (
+	"image"
+	"image/jpeg"
+	"io"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/gen2brain/avif"
+	"github.com/gen2brain/webp"
+)
+
+// ImageFormat is an output format for resized images
+type ImageFormat struct {
+	Name        string
+	Ext         string
+	ContentType string
+	// DefaultQuality is used unless IMAGE_QUALITY_<NAME> is set, e.g. IMAGE_QUALITY_WEBP=75
+	DefaultQuality int
+
+	encode func(w io.Writer, img image.Image, quality int) error
+}
+
+var (
+	FormatJPEG = ImageFormat{
+		Name:           "jpeg",
+		Ext:            ".jpg",
+		ContentType:    "image/jpeg",
+		DefaultQuality: 85,
+		encode: func(w io.Writer, img image.Image, quality int) error {
+			return jpeg.Encode(w, img, &jpeg.Options{Quality: quality})
+		},
+	}
+	FormatWebP = ImageFormat{
+		Name:           "webp",
+		Ext:            ".webp",
+		ContentType:    "image/webp",
+		DefaultQuality: 80,
+		encode: func(w io.Writer, img image.Image, quality int) error {
+			return webp.Encode(w, img, webp.Options{Quality: quality, Method: 4})
+		},
+	}
+	FormatAVIF = ImageFormat{
+		Name:           "avif",
+		Ext:            ".avif",
+		ContentType:    "image/avif",
+		DefaultQuality: 60,
+		encode: func(w io.Writer, img image.Image, quality int) error {
+			// the default speed takes minutes for a large image, 8 is a few seconds
+			return avif.Encode(w, img, avif.Options{Quality: quality, Speed: 8})
+		},
+	}
+)
+
+// imageFormats are the known formats, in the order browsers should prefer them
+var imageFormats = []ImageFormat{FormatAVIF, FormatWebP, FormatJPEG}
+
+// imageFormatsFromEnv reads IMAGE_RENDITION_FORMATS, a comma separated list like
+// "webp,jpeg". JPEG is always included as the fallback for older browsers.
+func imageFormatsFromEnv() []ImageFormat {
+	value := strings.TrimSpace(os.Getenv("IMAGE_RENDITION_FORMATS"))
+	if value == "" {
+		return imageFormats
+	}
+
+	wanted := map[string]bool{FormatJPEG.Name: true}
+	for _, part := range strings.Split(value, ",") {
+		wanted[strings.ToLower(strings.TrimSpace(part))] = true
+	}
+
+	var formats []ImageFormat
+	for _, format := range imageFormats {
+		if wanted[format.Name] {
+			formats = append(formats, format)
+		}
+	}
+	return formats
+}
+
+// imageQualitiesFromEnv reads IMAGE_QUALITY_JPEG, IMAGE_QUALITY_WEBP and IMAGE_QUALITY_AVIF
+func imageQualitiesFromEnv() map[string]int {
+	qualities := map[string]int{}
+	for _, format := range imageFormats {
+		qualities[format.Name] = format.DefaultQuality
+
+		name := "IMAGE_QUALITY_" + strings.ToUpper(format.Name)
+		value := os.Getenv(name)
+		if value == "" {
+			continue
+		}
+		quality, err := strconv.Atoi(value)
+		if err != nil || quality < 1 || quality > 100 {
+			log.Printf("Ignoring invalid %s %q", name, value)
+			continue
+		}
+		qualities[format.Name] = quality
+	}
+	return qualities
+}
+
+// encodeImage encodes img in the format at the configured quality
+func (u *ImageUploader) encodeImage(w io.Writer, img image.Image, format ImageFormat) error {
+	return format.encode(w, img, u.qualities[format.Name])
+}
@@ -0,0 +1,169 @@
+package services
+
+import (
+	"context"
+	"log"
+	"os"
+	"path"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/sebwib/emma-site-htmx/db"
+	"github.com/sebwib/emma-site-htmx/lib/blobstore"
+)
+
+// DefaultImageGCGrace is how old an unreferenced blob must be before it is deleted
+// unless IMAGE_GC_GRACE is set. Images are uploaded before the art they belong to
+// is saved, and an upload in a modal left open must survive until it is.
+const DefaultImageGCGrace = 7 * 24 * time.Hour
+
+var imageExtensions = []string{".jpg", ".jpeg", ".png", ".webp", ".avif", ".gif"}
+
+// siteImages are used by the page templates rather than the database, they share the
+// upload directory when images are stored locally
+var siteImages = []string{"emma_about.jpg", "pic_on_wall.jpg"}
+
+// StoredImage is a blob in the public store or among the private originals
+type StoredImage struct {
+	blobstore.Object
+	URL string
+
+	store blobstore.BlobStore
+}
+
+// ImageGCReport is the result of a garbage collection run
+type ImageGCReport struct {
+	DryRun bool
+	Grace  time.Duration
+	// Orphans are unreferenced blobs older than the grace period, deleted unless
+	// it was a dry run
+	Orphans []StoredImage
+	// Recent are unreferenced blobs still within the grace period
+	Recent     []StoredImage
+	Referenced int
+	// Deleted are the keys that were deleted
+	Deleted []string
+	// DeletedURLs are the URLs of the deleted blobs, for forgetting their renditions
+	DeletedURLs []string
+}
+
+// OrphanedSize is the total size of the orphans
+func (r ImageGCReport) OrphanedSize() int64 {
+	var size int64
+	for _, object := range r.Orphans {
+		size += object.Size
+	}
+	return size
+}
+
+// ImageGCGraceFromEnv reads IMAGE_GC_GRACE, a duration like "72h"
+func ImageGCGraceFromEnv() time.Duration {
+	value := os.Getenv("IMAGE_GC_GRACE")
+	if value == "" {
+		return DefaultImageGCGrace
+	}
+	grace, err := time.ParseDuration(value)
+	if err != nil || grace < 0 {
+		log.Printf("Ignoring invalid IMAGE_GC_GRACE %q", value)
+		return DefaultImageGCGrace
+	}
+	return grace
+}
+
+// CollectGarbage finds the images in the store that nothing refers to and, unless
+// dryRun is set, deletes those older than grace. Renditions and resized copies are
+// kept as long as their original is.
+func (u *ImageUploader) CollectGarbage(references db.ImageReferences, grace time.Duration, dryRun bool) (ImageGCReport, error) {
+	report := ImageGCReport{DryRun: dryRun, Grace: grace}
+
+	ctx := context.TODO()
+	stores := []blobstore.BlobStore{u.store}
+	if u.originals != u.store {
+		stores = append(stores, u.originals)
+	}
+	var images []StoredImage
+	for _, store := range stores {
+		objects, err := store.List(ctx, "")
+		if err != nil {
+			return report, err
+		}
+		for _, object := range objects {
+			images = append(images, StoredImage{Object: object, URL: store.URL(object.Key), store: store})
+		}
+	}
+
+	referenced := map[string]bool{}
+	for _, url := range references.URLs {
+		if key, ok := u.KeyForURL(url); ok {
+			referenced[key] = true
+		}
+	}
+
+	cutoff := time.Now().Add(-grace)
+	for _, image := range images {
+		if !isImageKey(image.Key) {
+			continue
+		}
+		if referenced[sourceKey(image.Key)] || slices.Contains(siteImages, image.Key) || mentionedInTexts(image.Key, references.Texts) {
+			report.Referenced++
+			continue
+		}
+		if image.ModTime.After(cutoff) {
+			report.Recent = append(report.Recent, image)
+			continue
+		}
+		report.Orphans = append(report.Orphans, image)
+	}
+	sort.Slice(report.Orphans, func(i, j int) bool { return report.Orphans[i].ModTime.Before(report.Orphans[j].ModTime) })
+
+	if dryRun {
+		return report, nil
+	}
+	for _, image := range report.Orphans {
+		if err := image.store.Delete(ctx, image.Key); err != nil {
+			return report, err
+		}
+		report.Deleted = append(report.Deleted, image.Key)
+		report.DeletedURLs = append(report.DeletedURLs, image.URL)
+	}
+	return report, nil
+}
+
+// sourceKey is the key of the original a resized copy was made from, renditions
+// and originals are their own sources
+func sourceKey(key string) string {
+	rest, ok := strings.CutPrefix(key, resizeCachePrefix)
+	if !ok {
+		return key
+	}
+	// "800/abc.jpg.webp" was made from "abc.jpg"
+	_, name, ok := strings.Cut(rest, "/")
+	if !ok {
+		return key
+	}
+	return strings.TrimSuffix(name, path.Ext(name))
+}
+
+func mentionedInTexts(key string, texts []string) bool {
+	for _, text := range texts {
+		if strings.Contains(text, key) {
+			return true
+		}
+	}
+	return false
+}
+
+func isImageKey(key string) bool {
+	if strings.HasPrefix(path.Base(key), ".") {
+		return false
+	}
+	ext := strings.ToLower(path.Ext(key))
+	for _, imageExt := range imageExtensions {
+		if ext == imageExt {
+			return true
+		}
+	}
+	return false
+}
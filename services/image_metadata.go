@@ -0,0 +1,77 @@
+package services
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/png"
+
+	"github.com/sebwib/emma-site-htmx/lib/imagemeta"
+)
+
+// originalQuality is used when an original has to be encoded again, high enough
+// that the stored original is as good as the upload
+const originalQuality = 95
+
+// decodeImage decodes the image the right way up
+func decodeImage(data []byte) (image.Image, error) {
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("decode error %w", err)
+	}
+	return imagemeta.Orient(img, imagemeta.Read(data).Orientation), nil
+}
+
+// normalizeImage turns a photo the right way up and strips its metadata except the
+// copyright, so the GPS position and camera details of the upload aren't published.
+// The extension changes when the image had to be encoded as another format.
+func normalizeImage(data []byte, ext string) ([]byte, string, error) {
+	meta := imagemeta.Read(data)
+
+	if meta.Orientation > 1 {
+		img, format, err := image.Decode(bytes.NewReader(data))
+		if err != nil {
+			return nil, "", fmt.Errorf("decode error %w", err)
+		}
+
+		data, ext, err = encodeOriginal(imagemeta.Orient(img, meta.Orientation), format, ext)
+		if err != nil {
+			return nil, "", err
+		}
+	}
+
+	stripped, err := imagemeta.Strip(data, meta.Copyright)
+	if errors.Is(err, imagemeta.ErrUnsupportedFormat) {
+		// encoding the image again is the only way to be rid of metadata we can't parse
+		img, format, err := image.Decode(bytes.NewReader(data))
+		if err != nil {
+			return nil, "", fmt.Errorf("decode error %w", err)
+		}
+		return encodeOriginal(img, format, ext)
+	}
+	if err != nil {
+		return nil, "", err
+	}
+	return stripped, ext, nil
+}
+
+// encodeOriginal encodes an image for storing as the original. PNGs stay lossless
+// and everything else becomes a JPEG.
+func encodeOriginal(img image.Image, format string, ext string) ([]byte, string, error) {
+	var out bytes.Buffer
+	if format == "png" {
+		if err := png.Encode(&out, img); err != nil {
+			return nil, "", err
+		}
+		return out.Bytes(), ext, nil
+	}
+
+	if err := FormatJPEG.encode(&out, img, originalQuality); err != nil {
+		return nil, "", err
+	}
+	if format != "jpeg" {
+		ext = FormatJPEG.Ext
+	}
+	return out.Bytes(), ext, nil
+}
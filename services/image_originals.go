@@ -0,0 +1,204 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+
+	"github.com/sebwib/emma-site-htmx/db"
+	"github.com/sebwib/emma-site-htmx/lib/blobstore"
+)
+
+// PublicOriginal is an original in the public store or, with S3, in the legacy
+// upload directory
+type PublicOriginal struct {
+	blobstore.Object
+	URL string
+	// References are the URLs the database refers to it by
+	References []string
+
+	store blobstore.BlobStore
+}
+
+// PublicOriginalsReport is what is left of moving the originals uploaded before they
+// were kept private. Moving is done by an admin in two steps: CopyOriginalsToPrivate
+// copies them and points the database at the copies, DeletePublicCopies deletes the
+// public copies nothing refers to any more.
+type PublicOriginalsReport struct {
+	// Private is false when the originals have no store of their own
+	Private bool
+	// Public are the originals the database still refers to publicly
+	Public []PublicOriginal
+	// Copied are public copies of originals in the private store that nothing in the
+	// database refers to any more
+	Copied []PublicOriginal
+	// Linked are copied originals the texts link to, their public copy is kept
+	Linked []PublicOriginal
+	// Missing are the URLs of originals found in neither store
+	Missing []string
+	// Moved and Deleted are what the last step did
+	Moved   int
+	Deleted int
+}
+
+// FindPublicOriginals looks for the originals that are still public. originalURLs are
+// the full size images of the database, only those are originals. Site images and
+// thumbnails are never among them.
+func (u *ImageUploader) FindPublicOriginals(originalURLs []string, references db.ImageReferences) (PublicOriginalsReport, error) {
+	report := PublicOriginalsReport{Private: u.originals != u.store}
+	if !report.Private {
+		return report, nil
+	}
+
+	ctx := context.TODO()
+	private, err := u.originals.List(ctx, "")
+	if err != nil {
+		return report, err
+	}
+	inPrivate := map[string]bool{}
+	for _, object := range private {
+		inPrivate[object.Key] = true
+	}
+
+	// the public blobs by key, a blob in the bucket hides one with the same key in
+	// the legacy directory
+	public := map[string]PublicOriginal{}
+	for _, store := range u.publicStores() {
+		objects, err := store.List(ctx, "")
+		if err != nil {
+			return report, err
+		}
+		for _, object := range objects {
+			if _, ok := public[object.Key]; !ok && isOriginalKey(object.Key) && isImageKey(object.Key) {
+				public[object.Key] = PublicOriginal{Object: object, URL: store.URL(object.Key), store: store}
+			}
+		}
+	}
+
+	// the URLs the database refers to each public blob by
+	referenced := map[string][]string{}
+	for _, url := range references.URLs {
+		if key, ok := u.locatePublic(url); ok {
+			referenced[key] = append(referenced[key], url)
+		}
+	}
+
+	originals := map[string]bool{}
+	for _, url := range originalURLs {
+		key, ok := u.locatePublic(url)
+		if !ok || originals[key] {
+			continue
+		}
+		originals[key] = true
+		original, ok := public[key]
+		if !ok {
+			report.Missing = append(report.Missing, url)
+			continue
+		}
+		original.References = referenced[key]
+		report.Public = append(report.Public, original)
+	}
+
+	for key, original := range public {
+		if !inPrivate[key] || len(referenced[key]) > 0 {
+			continue
+		}
+		if mentionedInTexts(key, references.Texts) {
+			report.Linked = append(report.Linked, original)
+		} else {
+			report.Copied = append(report.Copied, original)
+		}
+	}
+
+	for _, list := range [][]PublicOriginal{report.Public, report.Copied, report.Linked} {
+		sort.Slice(list, func(i, j int) bool { return list[i].Key < list[j].Key })
+	}
+	sort.Strings(report.Missing)
+	return report, nil
+}
+
+// CopyOriginalsToPrivate copies the originals to the private store and reads each
+// copy back before calling rewrite with the URLs that referred to the original and
+// its new URL. The public copies are kept, DeletePublicCopies deletes them. It
+// returns how many were copied.
+func (u *ImageUploader) CopyOriginalsToPrivate(originals []PublicOriginal, rewrite func(from []string, to string) error) (int, error) {
+	ctx := context.TODO()
+	copied := 0
+	for _, original := range originals {
+		data, err := original.store.Get(ctx, original.Key)
+		if err != nil {
+			return copied, err
+		}
+		if err := u.originals.Put(ctx, original.Key, data, http.DetectContentType(data)); err != nil {
+			return copied, err
+		}
+		if err := u.verifyPrivateCopy(original.Key, data); err != nil {
+			return copied, err
+		}
+		if err := rewrite(original.References, u.originals.URL(original.Key)); err != nil {
+			return copied, err
+		}
+		copied++
+	}
+	return copied, nil
+}
+
+// DeletePublicCopies deletes the public copies of originals that are in the private
+// store, a copy is only deleted when the private one has the same content. Pass it
+// the Copied of a report made after the database was rewritten. It returns how many
+// were deleted.
+func (u *ImageUploader) DeletePublicCopies(copies []PublicOriginal) (int, error) {
+	ctx := context.TODO()
+	deleted := 0
+	for _, public := range copies {
+		data, err := public.store.Get(ctx, public.Key)
+		if err != nil {
+			return deleted, err
+		}
+		if err := u.verifyPrivateCopy(public.Key, data); err != nil {
+			return deleted, err
+		}
+		if err := public.store.Delete(ctx, public.Key); err != nil {
+			return deleted, err
+		}
+		deleted++
+	}
+	return deleted, nil
+}
+
+// verifyPrivateCopy checks that the private store has data under key
+func (u *ImageUploader) verifyPrivateCopy(key string, data []byte) error {
+	stored, err := u.originals.Get(context.TODO(), key)
+	if err != nil {
+		return fmt.Errorf("reading the private copy of %s: %w", key, err)
+	}
+	if !bytes.Equal(stored, data) {
+		return fmt.Errorf("the private copy of %s differs from the public one", key)
+	}
+	return nil
+}
+
+// publicStores are the stores originals were kept in before they were private
+func (u *ImageUploader) publicStores() []blobstore.BlobStore {
+	if u.legacy != nil {
+		return []blobstore.BlobStore{u.store, u.legacy}
+	}
+	return []blobstore.BlobStore{u.store}
+}
+
+// locatePublic returns the key of an image URL in the public store or the legacy
+// upload directory
+func (u *ImageUploader) locatePublic(url string) (string, bool) {
+	if u.legacy != nil {
+		if key, ok := blobstore.KeyForURL(u.legacy, url); ok {
+			return key, true
+		}
+	}
+	store, key, ok := u.locate(url)
+	if !ok || store == u.originals {
+		return "", false
+	}
+	return key, true
+}
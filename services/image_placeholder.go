@@ -0,0 +1,112 @@
+package services
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"image"
+	"regexp"
+	"strings"
+
+	"github.com/nfnt/resize"
+)
+
+const (
+	// placeholderWidth is the width of the LQIP, enough to hint at the composition
+	// while staying well under a kilobyte
+	placeholderWidth   = 16
+	placeholderQuality = 50
+
+	lqipPrefix = "data:image/jpeg;base64,"
+)
+
+var hexColorRegex = regexp.MustCompile(`^#[0-9a-f]{6}$`)
+
+// ImagePlaceholder is what is shown while an image loads
+type ImagePlaceholder struct {
+	// LQIP is a tiny blurry JPEG as a data URL
+	LQIP          string
+	DominantColor string
+	// Width and Height are the image's size in pixels, for reserving its space
+	Width  int
+	Height int
+}
+
+// CreatePlaceholder makes the LQIP and finds the dominant colour of an image
+func CreatePlaceholder(data []byte) (ImagePlaceholder, error) {
+	img, err := decodeImage(data)
+	if err != nil {
+		return ImagePlaceholder{}, err
+	}
+	bounds := img.Bounds()
+
+	tiny := resize.Resize(placeholderWidth, 0, img, resize.Bilinear)
+	var out bytes.Buffer
+	if err := FormatJPEG.encode(&out, tiny, placeholderQuality); err != nil {
+		return ImagePlaceholder{}, err
+	}
+
+	return ImagePlaceholder{
+		LQIP:          lqipPrefix + base64.StdEncoding.EncodeToString(out.Bytes()),
+		DominantColor: dominantColor(resize.Resize(64, 0, img, resize.Bilinear)),
+		Width:         bounds.Dx(),
+		Height:        bounds.Dy(),
+	}, nil
+}
+
+// dominantColor is the average of the most common group of similar colours. An
+// average of the whole image turns most paintings brown.
+func dominantColor(img image.Image) string {
+	type bucket struct {
+		count   int
+		r, g, b int
+	}
+	buckets := map[int]*bucket{}
+	var best *bucket
+
+	bounds := img.Bounds()
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			r, g, b, _ := img.At(x, y).RGBA()
+			r, g, b = r>>8, g>>8, b>>8
+			// 4 bits per channel groups colours that look alike
+			key := int(r>>4)<<8 | int(g>>4)<<4 | int(b>>4)
+
+			current, ok := buckets[key]
+			if !ok {
+				current = &bucket{}
+				buckets[key] = current
+			}
+			current.count++
+			current.r += int(r)
+			current.g += int(g)
+			current.b += int(b)
+			if best == nil || current.count > best.count {
+				best = current
+			}
+		}
+	}
+	if best == nil {
+		return ""
+	}
+
+	return fmt.Sprintf("#%02x%02x%02x", best.r/best.count, best.g/best.count, best.b/best.count)
+}
+
+// ValidPlaceholder tells if a placeholder from a form is one made by CreatePlaceholder,
+// the values end up in style attributes
+func ValidPlaceholder(placeholder ImagePlaceholder) bool {
+	if placeholder.LQIP != "" {
+		encoded, ok := strings.CutPrefix(placeholder.LQIP, lqipPrefix)
+		if !ok {
+			return false
+		}
+		if _, err := base64.StdEncoding.DecodeString(encoded); err != nil {
+			return false
+		}
+	}
+	if placeholder.DominantColor != "" && !hexColorRegex.MatchString(placeholder.DominantColor) {
+		return false
+	}
+	return placeholder.Width >= 0 && placeholder.Height >= 0
+}
@@ -0,0 +1,141 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/nfnt/resize"
+	"github.com/sebwib/emma-site-htmx/db"
+)
+
+// DefaultRenditionWidths are the widths images are resized to for srcset when
+// IMAGE_RENDITION_WIDTHS isn't set
+var DefaultRenditionWidths = []int{400, 800, 1600, 2400}
+
+// renditionWidthsFromEnv reads IMAGE_RENDITION_WIDTHS, a comma separated list like "400,800,1600"
+func renditionWidthsFromEnv() []int {
+	value := strings.TrimSpace(os.Getenv("IMAGE_RENDITION_WIDTHS"))
+	if value == "" {
+		return DefaultRenditionWidths
+	}
+
+	var widths []int
+	for _, part := range strings.Split(value, ",") {
+		width, err := strconv.Atoi(strings.TrimSpace(part))
+		if err != nil || width <= 0 {
+			log.Printf("Ignoring invalid image rendition width %q", part)
+			continue
+		}
+		widths = append(widths, width)
+	}
+	if len(widths) == 0 {
+		return DefaultRenditionWidths
+	}
+	sort.Ints(widths)
+	return widths
+}
+
+// RenditionWidths are the widths renditions are made in, smallest first
+func (u *ImageUploader) RenditionWidths() []int {
+	return u.renditionWidths
+}
+
+// renditionKeyPrefix is where the renditions of an image are stored, e.g.
+// "renditions/abc-123/" for "abc-123.png"
+func (u *ImageUploader) renditionKeyPrefix(imageURL string) string {
+	key, ok := u.KeyForURL(imageURL)
+	if !ok {
+		// images from outside the store get a folder of their own
+		key = uuid.NewString()
+	}
+	return "renditions/" + strings.TrimSuffix(key, path.Ext(key)) + "/"
+}
+
+// CreateRenditions resizes the image to the configured widths and stores each size
+// in every configured format. Widths larger than the image are skipped, an image is
+// never scaled up. An image narrower than the smallest width gets one rendition at
+// its own width instead.
+func (u *ImageUploader) CreateRenditions(imageURL string, data []byte) ([]db.ImageRendition, error) {
+	original, err := decodeImage(data)
+	if err != nil {
+		return nil, err
+	}
+	bounds := original.Bounds()
+
+	widths := u.renditionWidths
+	if len(widths) > 0 && bounds.Dx() < widths[0] {
+		// it still gets the other formats, and NeedsRenditions is satisfied so it
+		// isn't read again on every start
+		widths = []int{bounds.Dx()}
+	}
+
+	ctx := context.TODO()
+	prefix := u.renditionKeyPrefix(imageURL)
+	var renditions []db.ImageRendition
+	for _, width := range widths {
+		if width > bounds.Dx() {
+			break
+		}
+
+		resized, err := u.watermarkResized(resize.Resize(uint(width), 0, original, resize.Lanczos3), width)
+		if err != nil {
+			return nil, fmt.Errorf("failed to watermark: %w", err)
+		}
+		for _, format := range u.formats {
+			var out bytes.Buffer
+			if err := u.encodeImage(&out, resized, format); err != nil {
+				return nil, fmt.Errorf("failed to encode %s: %w", format.Name, err)
+			}
+
+			key := prefix + u.sizeName(width) + format.Ext
+			if err := u.store.Put(ctx, key, out.Bytes(), format.ContentType); err != nil {
+				return nil, err
+			}
+			renditions = append(renditions, db.ImageRendition{
+				ImageURL: imageURL,
+				Width:    width,
+				Height:   resized.Bounds().Dy(),
+				Format:   format.Name,
+				URL:      u.store.URL(key),
+				Size:     int64(out.Len()),
+			})
+		}
+	}
+
+	return renditions, nil
+}
+
+// NeedsRenditions tells if an image with these renditions is missing any of the
+// configured widths or formats, or has old watermarks. Widths above the widest
+// rendition are assumed to have been skipped because the image is smaller.
+func (u *ImageUploader) NeedsRenditions(renditions []db.ImageRendition) bool {
+	if len(renditions) == 0 {
+		return true
+	}
+
+	have := map[string]bool{}
+	widest := 0
+	for _, rendition := range renditions {
+		have[path.Base(rendition.URL)] = true
+		widest = max(widest, rendition.Width)
+	}
+	for _, width := range u.renditionWidths {
+		if width > widest {
+			break
+		}
+		for _, format := range u.formats {
+			if !have[u.sizeName(width)+format.Ext] {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,150 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/nfnt/resize"
+	"github.com/sebwib/emma-site-htmx/lib/blobstore"
+)
+
+// resizeCachePrefix is where resized images are kept in the store
+const resizeCachePrefix = "cache/img/"
+
+// legacyUploadDir holds the images the site was first published with, which are
+// referenced by bare file names and were never put in a bucket
+const legacyUploadDir = "./static/upload"
+
+var (
+	ErrImageNotFound   = errors.New("image not found")
+	ErrWidthNotAllowed = errors.New("image width not allowed")
+)
+
+// ResizedImage is an image resized by ResizeImage
+type ResizedImage struct {
+	Data        []byte
+	ContentType string
+	// ETag is a strong ETag of the data, quoted
+	ETag string
+}
+
+// resizeLocks makes concurrent requests for the same size wait for one resize
+var resizeLocks sync.Map
+
+// ImageFormatByName returns the format with the name, e.g. "webp"
+func ImageFormatByName(name string) (ImageFormat, bool) {
+	for _, format := range imageFormats {
+		if format.Name == name {
+			return format, true
+		}
+	}
+	return ImageFormat{}, false
+}
+
+// AllowedResizeWidth tells if images can be resized to the width. The widths are
+// the thumbnail and rendition widths, so the cache can't be filled with every size
+// there is.
+func (u *ImageUploader) AllowedResizeWidth(width int) bool {
+	return width == ThumbWidth || slices.Contains(u.renditionWidths, width)
+}
+
+// ResizeImage returns the uploaded image with the key resized to the width, from the
+// cache when it has been resized before. Images narrower than the width keep their
+// size.
+func (u *ImageUploader) ResizeImage(key string, width int, format ImageFormat) (ResizedImage, error) {
+	if !u.AllowedResizeWidth(width) {
+		return ResizedImage{}, ErrWidthNotAllowed
+	}
+	// only originals are resized, not renditions or earlier results
+	if !isOriginalKey(key) {
+		return ResizedImage{}, ErrImageNotFound
+	}
+
+	// the source's extension stays in the name, a.jpg and a.png are different images
+	cacheKey := resizeCachePrefix + u.sizeName(width) + "/" + key + format.Ext
+	lock, _ := resizeLocks.LoadOrStore(cacheKey, &sync.Mutex{})
+	lock.(*sync.Mutex).Lock()
+	defer lock.(*sync.Mutex).Unlock()
+
+	ctx := context.TODO()
+	data, err := u.store.Get(ctx, cacheKey)
+	if err != nil && !errors.Is(err, blobstore.ErrNotFound) {
+		return ResizedImage{}, err
+	}
+
+	if data == nil {
+		source, err := u.readOriginal(key)
+		if err != nil {
+			return ResizedImage{}, err
+		}
+		img, err := decodeImage(source)
+		if err != nil {
+			return ResizedImage{}, err
+		}
+		if img.Bounds().Dx() > width {
+			img = resize.Resize(uint(width), 0, img, resize.Lanczos3)
+		}
+		if img, err = u.watermarkResized(img, width); err != nil {
+			return ResizedImage{}, err
+		}
+
+		var out bytes.Buffer
+		if err := u.encodeImage(&out, img, format); err != nil {
+			return ResizedImage{}, err
+		}
+		data = out.Bytes()
+		if err := u.store.Put(ctx, cacheKey, data, format.ContentType); err != nil {
+			return ResizedImage{}, err
+		}
+	}
+
+	sum := sha256.Sum256(data)
+	return ResizedImage{
+		Data:        data,
+		ContentType: format.ContentType,
+		ETag:        `"` + hex.EncodeToString(sum[:16]) + `"`,
+	}, nil
+}
+
+// ReadOriginal reads the original with the key, for admins to download
+func (u *ImageUploader) ReadOriginal(key string) ([]byte, error) {
+	if !isOriginalKey(key) {
+		return nil, ErrImageNotFound
+	}
+	return u.readOriginal(key)
+}
+
+// readOriginal reads an original from the private or the public store, or from the
+// legacy upload directory for the bare file names of the first artworks
+func (u *ImageUploader) readOriginal(key string) ([]byte, error) {
+	ctx := context.TODO()
+	data, err := u.originals.Get(ctx, key)
+	if !errors.Is(err, blobstore.ErrNotFound) {
+		return data, err
+	}
+	if u.originals != u.store {
+		data, err = u.store.Get(ctx, key)
+		if !errors.Is(err, blobstore.ErrNotFound) {
+			return data, err
+		}
+	}
+
+	data, err = os.ReadFile(filepath.Join(legacyUploadDir, key))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrImageNotFound
+	}
+	return data, err
+}
+
+// isOriginalKey tells if the key can be an original, they are all at the top level
+func isOriginalKey(key string) bool {
+	return key != "" && !strings.Contains(key, "/") && key != "." && key != ".."
+}
@@ -3,84 +3,186 @@ package services
 import (
 	"bytes"
 	"context"
+	"errors"
 	"fmt"
-	"image"
-	"image/jpeg"
 	_ "image/png"
 	"io"
 	"log"
 	"mime/multipart"
+	"net/http"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"time"
 
-	"github.com/aws/aws-sdk-go-v2/aws"
-	"github.com/aws/aws-sdk-go-v2/config"
-	"github.com/aws/aws-sdk-go-v2/credentials"
-	"github.com/aws/aws-sdk-go-v2/service/s3"
 	"github.com/google/uuid"
 	"github.com/nfnt/resize"
+	"github.com/sebwib/emma-site-htmx/db"
+	"github.com/sebwib/emma-site-htmx/lib/blobstore"
 )
 
+// ThumbWidth is the width of the thumbnails made on upload
+const ThumbWidth = 800
+
+// OriginalsURL is where admins download the full size originals, which are kept
+// out of the public store
+const OriginalsURL = "/edit/originals"
+
 type ImageUploader struct {
-	s3Client   *s3.Client
-	bucketName string
-	useS3      bool
-	localPath  string
+	store blobstore.BlobStore
+	// originals keeps the uploaded images as they were, only renditions and
+	// thumbnails are public. It is the public store when no private one is set up.
+	originals blobstore.BlobStore
+	// legacy is the upload directory of the first artworks when it isn't the
+	// public store, nil when it is
+	legacy blobstore.BlobStore
+
+	// legacyBaseURLs are other addresses images have been stored with, like the
+	// bucket's S3 address from before a CDN was put in front of it
+	legacyBaseURLs []string
+
+	// renditionWidths are the widths images are resized to for srcset
+	renditionWidths []int
+	// formats are the formats renditions are stored in, JPEG being the fallback
+	formats []ImageFormat
+	// qualities are the encoding qualities by format name
+	qualities map[string]int
+	// watermark is drawn on large renditions, nil when there is none
+	watermark *Watermark
+	// limits are what uploads are checked against
+	limits UploadLimits
 }
 
+// NewImageUploader stores images in the S3 bucket configured in the environment, or
+// in ./static/upload when no bucket is configured. S3_ENDPOINT, S3_USE_PATH_STYLE and
+// S3_PUBLIC_BASE_URL are used for S3 compatible services like MinIO and for CDNs.
+// Originals go in S3_PRIVATE_BUCKET_NAME, which is required with S3, or in
+// ./private/originals without S3. The originals uploaded before they were kept
+// private stay where they are until an admin moves them on /edit/images/originals.
 func NewImageUploader() (*ImageUploader, error) {
 	bucketName := os.Getenv("S3_BUCKET_NAME")
 	awsRegion := os.Getenv("AWS_REGION")
 	awsAccessKey := os.Getenv("AWS_ACCESS_KEY_ID")
 	awsSecretKey := os.Getenv("AWS_SECRET_ACCESS_KEY")
-
-	uploader := &ImageUploader{
-		bucketName: bucketName,
-		localPath:  "./static/upload",
-	}
+	endpoint := os.Getenv("S3_ENDPOINT")
 
 	// If S3 credentials are provided, use S3, otherwise use local storage
-	if bucketName != "" && awsRegion != "" && awsAccessKey != "" && awsSecretKey != "" {
-		cfg, err := config.LoadDefaultConfig(context.TODO(),
-			config.WithRegion(awsRegion),
-			config.WithCredentialsProvider(credentials.NewStaticCredentialsProvider(
-				awsAccessKey,
-				awsSecretKey,
-				"",
-			)),
-		)
+	if bucketName != "" && (awsRegion != "" || endpoint != "") && awsAccessKey != "" && awsSecretKey != "" {
+		usePathStyle, _ := strconv.ParseBool(os.Getenv("S3_USE_PATH_STYLE"))
+		store, err := blobstore.NewS3Store(blobstore.S3Config{
+			Bucket:        bucketName,
+			Region:        awsRegion,
+			AccessKey:     awsAccessKey,
+			SecretKey:     awsSecretKey,
+			Endpoint:      endpoint,
+			UsePathStyle:  usePathStyle,
+			PublicBaseURL: os.Getenv("S3_PUBLIC_BASE_URL"),
+		})
 		if err != nil {
-			return nil, fmt.Errorf("failed to load AWS config: %w", err)
+			return nil, fmt.Errorf("failed to set up S3 storage: %w", err)
 		}
 
-		uploader.s3Client = s3.NewFromConfig(cfg)
-		uploader.useS3 = true
+		// originals must never end up in the public bucket
+		privateBucket := os.Getenv("S3_PRIVATE_BUCKET_NAME")
+		if privateBucket == "" {
+			return nil, errors.New("S3_PRIVATE_BUCKET_NAME is not set, originals are no longer uploaded to the public bucket. " +
+				"Create a private bucket, set S3_PRIVATE_BUCKET_NAME to it and move the existing originals on /edit/images/originals, see the README")
+		}
+		originals, err := blobstore.NewS3Store(blobstore.S3Config{
+			Bucket:        privateBucket,
+			Region:        awsRegion,
+			AccessKey:     awsAccessKey,
+			SecretKey:     awsSecretKey,
+			Endpoint:      endpoint,
+			UsePathStyle:  usePathStyle,
+			PublicBaseURL: OriginalsURL,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to set up private S3 storage: %w", err)
+		}
+		// the first artworks are still on disk, where /static serves them
+		legacy, err := blobstore.NewFSStore(legacyUploadDir, "/static/upload")
+		if err != nil {
+			return nil, fmt.Errorf("failed to open the legacy upload directory: %w", err)
+		}
+
+		uploader := NewImageUploaderWithStores(store, originals)
+		uploader.legacyBaseURLs = []string{fmt.Sprintf("https://%s.s3.amazonaws.com/", bucketName)}
+		uploader.legacy = legacy
+		return uploader, nil
 	}
 
-	// Ensure local directory exists
-	if err := os.MkdirAll(uploader.localPath, 0755); err != nil {
+	store, err := blobstore.NewFSStore("./static/upload", "/static/upload")
+	if err != nil {
 		return nil, fmt.Errorf("failed to create upload directory: %w", err)
 	}
+	originals, err := blobstore.NewFSStore("./private/originals", OriginalsURL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create originals directory: %w", err)
+	}
+	return NewImageUploaderWithStores(store, originals), nil
+}
+
+// NewImageUploaderWithStore stores images in the given store, e.g. a blobstore.MemoryStore
+func NewImageUploaderWithStore(store blobstore.BlobStore) *ImageUploader {
+	return NewImageUploaderWithStores(store, store)
+}
 
-	return uploader, nil
+// NewImageUploaderWithStores keeps the originals in a store of their own
+func NewImageUploaderWithStores(store blobstore.BlobStore, originals blobstore.BlobStore) *ImageUploader {
+	return &ImageUploader{
+		store:           store,
+		originals:       originals,
+		renditionWidths: renditionWidthsFromEnv(),
+		formats:         imageFormatsFromEnv(),
+		qualities:       imageQualitiesFromEnv(),
+		watermark:       watermarkFromEnv(),
+		limits:          uploadLimitsFromEnv(),
+	}
 }
 
-func resizeImage(data []byte, size uint) ([]byte, error) {
-	originalImage, _, err := image.Decode(bytes.NewReader(data))
+// Store is where the uploaded images are kept
+func (u *ImageUploader) Store() blobstore.BlobStore {
+	return u.store
+}
+
+// KeyForURL returns the blob key of an image URL stored in the database. Bare file
+// names are keys in the store too.
+func (u *ImageUploader) KeyForURL(url string) (string, bool) {
+	_, key, ok := u.locate(url)
+	return key, ok
+}
+
+// locate finds the store an image URL is in and its key there
+func (u *ImageUploader) locate(url string) (blobstore.BlobStore, string, bool) {
+	if key, ok := blobstore.KeyForURL(u.originals, url); ok {
+		return u.originals, key, true
+	}
+	if key, ok := blobstore.KeyForURL(u.store, url); ok {
+		return u.store, key, true
+	}
+	for _, base := range u.legacyBaseURLs {
+		if key, ok := strings.CutPrefix(url, base); ok && key != "" {
+			return u.store, key, true
+		}
+	}
+	if url != "" && !strings.Contains(url, "/") {
+		return u.store, url, true
+	}
+	return nil, "", false
+}
+
+func resizeImage(data []byte, size uint, quality int) ([]byte, error) {
+	originalImage, err := decodeImage(data)
 	if err != nil {
-		return nil, fmt.Errorf("decode error %w", err)
+		return nil, err
 	}
 
 	newImage := resize.Resize(size, 0, originalImage, resize.Lanczos3)
 
 	var outData bytes.Buffer
-	err = jpeg.Encode(&outData, newImage, &jpeg.Options{
-		Quality: 85,
-	})
-
-	if err != nil {
+	if err := FormatJPEG.encode(&outData, newImage, quality); err != nil {
 		return nil, err
 	}
 
@@ -88,117 +190,116 @@ func resizeImage(data []byte, size uint) ([]byte, error) {
 }
 
 func (u *ImageUploader) UploadImage(file multipart.File, header *multipart.FileHeader) (string, string, error) {
-	// Generate unique filename
-	ext := filepath.Ext(header.Filename)
-	filename := fmt.Sprintf("%s-%d%s", uuid.New().String(), time.Now().Unix(), ext)
+	url, thumbURL, _, err := u.uploadImage(file, header)
+	return url, thumbURL, err
+}
 
-	log.Println("read bytes")
-	fileBytes, err := io.ReadAll(file)
+// UploadedImage is an uploaded gallery image with what is derived from it
+type UploadedImage struct {
+	URL         string
+	ThumbURL    string
+	Renditions  []db.ImageRendition
+	Placeholder ImagePlaceholder
+}
+
+// UploadGalleryImage uploads the image like UploadImage and makes the renditions and
+// the placeholder the gallery shows. The renditions are returned for the caller to save.
+func (u *ImageUploader) UploadGalleryImage(file multipart.File, header *multipart.FileHeader) (UploadedImage, error) {
+	url, thumbURL, fileBytes, err := u.uploadImage(file, header)
 	if err != nil {
-		return "", "", err
+		return UploadedImage{}, err
 	}
 
-	log.Println("resizing")
-	thumbFileBytes, err := resizeImage(fileBytes, 800)
+	renditions, err := u.CreateRenditions(url, fileBytes)
 	if err != nil {
-		return "", "", err
+		return UploadedImage{}, err
 	}
 
-	thumbFileName := fmt.Sprintf("thumb-%s", filename)
-	// replace thumb file extension with .jpg
-	thumbFileName = strings.TrimSuffix(thumbFileName, filepath.Ext(thumbFileName)) + ".jpg"
+	placeholder, err := CreatePlaceholder(fileBytes)
+	if err != nil {
+		return UploadedImage{}, err
+	}
 
-	if u.useS3 {
-		thumbUploadedFileName, err := u.uploadToS3(thumbFileBytes, thumbFileName, header)
-		if err != nil {
-			return "", "", err
-		}
+	return UploadedImage{URL: url, ThumbURL: thumbURL, Renditions: renditions, Placeholder: placeholder}, nil
+}
 
-		uploadedFileName, err := u.uploadToS3(fileBytes, filename, header)
-		if err != nil {
-			return "", "", err
-		}
-		return uploadedFileName, thumbUploadedFileName, nil
+func (u *ImageUploader) uploadImage(file multipart.File, header *multipart.FileHeader) (string, string, []byte, error) {
+	if header.Size > u.limits.MaxBytes {
+		return "", "", nil, u.limits.TooLargeError()
 	}
 
-	thumbUploadedFileName, err := u.uploadToLocal(thumbFileBytes, thumbFileName)
+	log.Println("read bytes")
+	// one byte more than allowed is enough to tell the upload is too large
+	fileBytes, err := io.ReadAll(io.LimitReader(file, u.limits.MaxBytes+1))
 	if err != nil {
-		return "", "", err
+		return "", "", nil, err
 	}
-	uploadedFileName, err := u.uploadToLocal(fileBytes, filename)
+
+	// the file name and content type come from the browser, the bytes decide
+	ext, err := u.validateUpload(fileBytes)
 	if err != nil {
-		return "", "", err
+		return "", "", nil, err
 	}
 
-	return uploadedFileName, thumbUploadedFileName, nil
-}
-
-func (u *ImageUploader) uploadToS3(fileBytes []byte, filename string, header *multipart.FileHeader) (string, error) {
-	// Determine content type
-	contentType := header.Header.Get("Content-Type")
-	if contentType == "" {
-		contentType = "application/octet-stream"
+	fileBytes, ext, err = normalizeImage(fileBytes, ext)
+	if err != nil {
+		return "", "", nil, err
 	}
 
-	log.Println("uploading: ", filename)
+	// Generate unique filename
+	filename := fmt.Sprintf("%s-%d%s", uuid.New().String(), time.Now().Unix(), ext)
 
-	_, err := u.s3Client.PutObject(context.TODO(), &s3.PutObjectInput{
-		Bucket:      aws.String(u.bucketName),
-		Key:         aws.String(filename),
-		Body:        bytes.NewReader(fileBytes),
-		ContentType: aws.String(contentType),
-		//ACL:         "public-read",
-	})
+	log.Println("resizing")
+	thumbFileBytes, err := resizeImage(fileBytes, ThumbWidth, u.qualities[FormatJPEG.Name])
 	if err != nil {
-		return "", fmt.Errorf("failed to upload to S3: %w", err)
+		return "", "", nil, err
 	}
 
-	// Return the S3 URL
-	return fmt.Sprintf("https://%s.s3.amazonaws.com/%s", u.bucketName, filename), nil
-}
-
-func (u *ImageUploader) uploadToLocal(fileBytes []byte, filename string) (string, error) {
-	log.Println("uploadToLocal: ", filename)
+	thumbFileName := fmt.Sprintf("thumb-%s", filename)
+	// replace thumb file extension with .jpg
+	thumbFileName = strings.TrimSuffix(thumbFileName, filepath.Ext(thumbFileName)) + ".jpg"
 
-	// Create destination file
-	dstPath := filepath.Join(u.localPath, filename)
-	dst, err := os.Create(dstPath)
-	if err != nil {
-		return "", fmt.Errorf("failed to create local file: %w", err)
+	ctx := context.TODO()
+	log.Println("uploading: ", thumbFileName)
+	if err := u.store.Put(ctx, thumbFileName, thumbFileBytes, "image/jpeg"); err != nil {
+		return "", "", nil, err
 	}
-	defer dst.Close()
-
-	// Copy file contents
-	if _, err := dst.Write(fileBytes); err != nil {
-		return "", fmt.Errorf("failed to write file: %w", err)
+	log.Println("uploading: ", filename)
+	if err := u.originals.Put(ctx, filename, fileBytes, http.DetectContentType(fileBytes)); err != nil {
+		return "", "", nil, err
 	}
 
-	// Return relative URL
-	return "/static/upload/" + filename, nil
+	return u.originals.URL(filename), u.store.URL(thumbFileName), fileBytes, nil
 }
 
+// DeleteImage removes an uploaded image. URLs that aren't in the store are left alone.
 func (u *ImageUploader) DeleteImage(url string) error {
-	if u.useS3 && strings.Contains(url, "s3.amazonaws.com") {
-		// Extract key from S3 URL
-		parts := strings.Split(url, "/")
-		if len(parts) == 0 {
-			return fmt.Errorf("invalid S3 URL")
-		}
-		key := parts[len(parts)-1]
+	store, key, ok := u.locate(url)
+	if !ok {
+		return nil
+	}
+	return store.Delete(context.TODO(), key)
+}
 
-		_, err := u.s3Client.DeleteObject(context.TODO(), &s3.DeleteObjectInput{
-			Bucket: aws.String(u.bucketName),
-			Key:    aws.String(key),
-		})
-		return err
+// ReadImage loads an uploaded image from the store. Images outside it, like the
+// site's own static files or images on other hosts, are read from disk or over HTTP.
+func (u *ImageUploader) ReadImage(url string) ([]byte, error) {
+	if store, key, ok := u.locate(url); ok {
+		return store.Get(context.TODO(), key)
 	}
 
-	// Delete from local storage
-	if strings.HasPrefix(url, "/static/upload/") {
-		filename := strings.TrimPrefix(url, "/static/upload/")
-		path := filepath.Join(u.localPath, filename)
-		return os.Remove(path)
+	if strings.HasPrefix(url, "http://") || strings.HasPrefix(url, "https://") {
+		client := http.Client{Timeout: 10 * time.Second}
+		resp, err := client.Get(url)
+		if err != nil {
+			return nil, err
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("failed to fetch image: %s", resp.Status)
+		}
+		return io.ReadAll(resp.Body)
 	}
 
-	return nil
+	return os.ReadFile(filepath.Join(".", filepath.FromSlash(strings.TrimPrefix(url, "/"))))
 }
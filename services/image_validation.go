@@ -0,0 +1,135 @@
+package services
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/sebwib/emma-site-htmx/lib/imagemeta"
+)
+
+// The upload limits unless they are set in the environment
+const (
+	DefaultUploadMaxBytes  = 20 << 20
+	DefaultUploadMinSide   = 200
+	DefaultUploadMaxSide   = 12000
+	DefaultUploadMaxPixels = 50_000_000
+)
+
+// UploadErrorCode tells the upload forms what was wrong with an image
+type UploadErrorCode string
+
+const (
+	UploadTooLarge           UploadErrorCode = "too_large"
+	UploadUnsupportedType    UploadErrorCode = "unsupported_type"
+	UploadUnreadable         UploadErrorCode = "unreadable"
+	UploadDimensionsTooSmall UploadErrorCode = "dimensions_too_small"
+	UploadDimensionsTooLarge UploadErrorCode = "dimensions_too_large"
+)
+
+// UploadError is an upload that was refused, the message can be shown to the admin
+type UploadError struct {
+	Code    UploadErrorCode
+	Message string
+}
+
+func (e *UploadError) Error() string {
+	return e.Message
+}
+
+// UploadLimits are what an uploaded image must fit within
+type UploadLimits struct {
+	MaxBytes  int64
+	MinWidth  int
+	MinHeight int
+	MaxWidth  int
+	MaxHeight int
+	// MaxPixels stops decompression bombs, small files that decode to huge images
+	MaxPixels int
+}
+
+// uploadLimitsFromEnv reads IMAGE_UPLOAD_MAX_BYTES, IMAGE_UPLOAD_MIN_WIDTH,
+// IMAGE_UPLOAD_MIN_HEIGHT, IMAGE_UPLOAD_MAX_WIDTH, IMAGE_UPLOAD_MAX_HEIGHT and
+// IMAGE_UPLOAD_MAX_PIXELS
+func uploadLimitsFromEnv() UploadLimits {
+	return UploadLimits{
+		MaxBytes:  int64(uploadLimitFromEnv("IMAGE_UPLOAD_MAX_BYTES", DefaultUploadMaxBytes)),
+		MinWidth:  uploadLimitFromEnv("IMAGE_UPLOAD_MIN_WIDTH", DefaultUploadMinSide),
+		MinHeight: uploadLimitFromEnv("IMAGE_UPLOAD_MIN_HEIGHT", DefaultUploadMinSide),
+		MaxWidth:  uploadLimitFromEnv("IMAGE_UPLOAD_MAX_WIDTH", DefaultUploadMaxSide),
+		MaxHeight: uploadLimitFromEnv("IMAGE_UPLOAD_MAX_HEIGHT", DefaultUploadMaxSide),
+		MaxPixels: uploadLimitFromEnv("IMAGE_UPLOAD_MAX_PIXELS", DefaultUploadMaxPixels),
+	}
+}
+
+func uploadLimitFromEnv(name string, fallback int) int {
+	value := os.Getenv(name)
+	if value == "" {
+		return fallback
+	}
+	limit, err := strconv.Atoi(value)
+	if err != nil || limit < 0 {
+		log.Printf("Ignoring invalid %s %q", name, value)
+		return fallback
+	}
+	return limit
+}
+
+// UploadLimits are the limits uploads are checked against
+func (u *ImageUploader) UploadLimits() UploadLimits {
+	return u.limits
+}
+
+// uploadExtensions are the file extensions of the formats that can be uploaded
+var uploadExtensions = map[string]string{
+	"jpeg": ".jpg",
+	"png":  ".png",
+	"webp": ".webp",
+}
+
+// validateUpload checks an upload by its content rather than its name, and reads
+// only the image header for the dimensions so an oversized image is refused before
+// it is decoded. It returns the extension the image should be stored with.
+func (u *ImageUploader) validateUpload(data []byte) (string, error) {
+	if int64(len(data)) > u.limits.MaxBytes {
+		return "", u.limits.TooLargeError()
+	}
+
+	format := imagemeta.Format(data)
+	ext, ok := uploadExtensions[format]
+	if !ok {
+		return "", &UploadError{UploadUnsupportedType, "Only JPEG, PNG and WebP images can be uploaded"}
+	}
+
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return "", &UploadError{UploadUnreadable, fmt.Sprintf("The image could not be read, the %s file may be damaged", format)}
+	}
+	width, height := config.Width, config.Height
+	// orientations 5 to 8 are turned a quarter, the image ends up the other way
+	if imagemeta.Read(data).Orientation >= 5 {
+		width, height = height, width
+	}
+
+	if width*height > u.limits.MaxPixels || width > u.limits.MaxWidth || height > u.limits.MaxHeight {
+		return "", &UploadError{UploadDimensionsTooLarge, fmt.Sprintf("The image is %d×%d pixels, the largest allowed is %d×%d and %d megapixels", width, height, u.limits.MaxWidth, u.limits.MaxHeight, u.limits.MaxPixels/1_000_000)}
+	}
+	if width < u.limits.MinWidth || height < u.limits.MinHeight {
+		return "", &UploadError{UploadDimensionsTooSmall, fmt.Sprintf("The image is %d×%d pixels, it must be at least %d×%d", width, height, u.limits.MinWidth, u.limits.MinHeight)}
+	}
+
+	return ext, nil
+}
+
+// TooLargeError is the error for an upload over MaxBytes
+func (l UploadLimits) TooLargeError() *UploadError {
+	return &UploadError{UploadTooLarge, fmt.Sprintf("The image is larger than %s", formatMegabytes(l.MaxBytes))}
+}
+
+func formatMegabytes(size int64) string {
+	return strings.TrimSuffix(fmt.Sprintf("%.1f", float64(size)/(1<<20)), ".0") + " MB"
+}
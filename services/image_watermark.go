@@ -0,0 +1,243 @@
+package services
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/nfnt/resize"
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/gofont/goregular"
+	"golang.org/x/image/font/opentype"
+	"golang.org/x/image/math/fixed"
+)
+
+// WatermarkPosition is the corner, or the centre, the watermark is drawn in
+type WatermarkPosition string
+
+const (
+	WatermarkTopLeft     WatermarkPosition = "top-left"
+	WatermarkTopRight    WatermarkPosition = "top-right"
+	WatermarkBottomLeft  WatermarkPosition = "bottom-left"
+	WatermarkBottomRight WatermarkPosition = "bottom-right"
+	WatermarkCenter      WatermarkPosition = "center"
+)
+
+const (
+	// DefaultWatermarkMinWidth is the narrowest image that is watermarked unless
+	// WATERMARK_MIN_WIDTH is set. Thumbnails are left clean, they are too small to be
+	// worth reposting.
+	DefaultWatermarkMinWidth = 1200
+	DefaultWatermarkOpacity  = 0.5
+)
+
+// Watermark is drawn on the large public renditions so reposted images keep their credit
+type Watermark struct {
+	Text string
+	// Logo is drawn above the text, scaled to a fifth of the image's width
+	Logo     image.Image
+	Position WatermarkPosition
+	// Opacity is between 0 and 1
+	Opacity  float64
+	MinWidth int
+
+	// signature changes with the settings, it is put in the names of watermarked
+	// images so changing the watermark makes new ones
+	signature string
+}
+
+var watermarkFont = sync.OnceValues(func() (*opentype.Font, error) {
+	return opentype.Parse(goregular.TTF)
+})
+
+// watermarkFromEnv reads WATERMARK_TEXT and WATERMARK_LOGO, the path of an image,
+// with WATERMARK_POSITION, WATERMARK_OPACITY and WATERMARK_MIN_WIDTH. It returns nil
+// when neither text nor logo is set.
+func watermarkFromEnv() *Watermark {
+	text := strings.TrimSpace(os.Getenv("WATERMARK_TEXT"))
+	logoPath := strings.TrimSpace(os.Getenv("WATERMARK_LOGO"))
+	if text == "" && logoPath == "" {
+		return nil
+	}
+
+	watermark := &Watermark{
+		Text:     text,
+		Position: WatermarkBottomRight,
+		Opacity:  DefaultWatermarkOpacity,
+		MinWidth: DefaultWatermarkMinWidth,
+	}
+	hash := sha256.New()
+	fmt.Fprintf(hash, "%s\x00", text)
+
+	if logoPath != "" {
+		data, err := os.ReadFile(logoPath)
+		if err != nil {
+			log.Printf("Ignoring watermark logo: %v", err)
+		} else if logo, _, err := image.Decode(bytes.NewReader(data)); err != nil {
+			log.Printf("Ignoring watermark logo %s: %v", logoPath, err)
+		} else {
+			watermark.Logo = logo
+			hash.Write(data)
+		}
+	}
+	if watermark.Text == "" && watermark.Logo == nil {
+		return nil
+	}
+
+	if value := os.Getenv("WATERMARK_POSITION"); value != "" {
+		switch position := WatermarkPosition(strings.ToLower(strings.TrimSpace(value))); position {
+		case WatermarkTopLeft, WatermarkTopRight, WatermarkBottomLeft, WatermarkBottomRight, WatermarkCenter:
+			watermark.Position = position
+		default:
+			log.Printf("Ignoring invalid WATERMARK_POSITION %q", value)
+		}
+	}
+	if value := os.Getenv("WATERMARK_OPACITY"); value != "" {
+		opacity, err := strconv.ParseFloat(value, 64)
+		if err != nil || opacity <= 0 || opacity > 1 {
+			log.Printf("Ignoring invalid WATERMARK_OPACITY %q", value)
+		} else {
+			watermark.Opacity = opacity
+		}
+	}
+	if value := os.Getenv("WATERMARK_MIN_WIDTH"); value != "" {
+		width, err := strconv.Atoi(value)
+		if err != nil || width < 0 {
+			log.Printf("Ignoring invalid WATERMARK_MIN_WIDTH %q", value)
+		} else {
+			watermark.MinWidth = width
+		}
+	}
+
+	fmt.Fprintf(hash, "%s\x00%g", watermark.Position, watermark.Opacity)
+	watermark.signature = hex.EncodeToString(hash.Sum(nil))[:8]
+	return watermark
+}
+
+// appliesTo tells if an image resized to the width gets the watermark
+func (w *Watermark) appliesTo(width int) bool {
+	return w != nil && width >= w.MinWidth
+}
+
+// apply returns a copy of the image with the watermark drawn on it
+func (w *Watermark) apply(img image.Image) (image.Image, error) {
+	bounds := img.Bounds()
+	out := image.NewRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	draw.Draw(out, out.Bounds(), img, bounds.Min, draw.Src)
+
+	mark, err := w.render(bounds.Dx())
+	if err != nil {
+		return nil, err
+	}
+
+	size := mark.Bounds().Size()
+	margin := bounds.Dx() / 40
+	var at image.Point
+	switch w.Position {
+	case WatermarkTopLeft:
+		at = image.Pt(margin, margin)
+	case WatermarkTopRight:
+		at = image.Pt(bounds.Dx()-size.X-margin, margin)
+	case WatermarkBottomLeft:
+		at = image.Pt(margin, bounds.Dy()-size.Y-margin)
+	case WatermarkCenter:
+		at = image.Pt((bounds.Dx()-size.X)/2, (bounds.Dy()-size.Y)/2)
+	default:
+		at = image.Pt(bounds.Dx()-size.X-margin, bounds.Dy()-size.Y-margin)
+	}
+
+	opacity := image.NewUniform(color.Alpha{A: uint8(w.Opacity * 255)})
+	draw.DrawMask(out, image.Rectangle{Min: at, Max: at.Add(size)}, mark, mark.Bounds().Min, opacity, image.Point{}, draw.Over)
+	return out, nil
+}
+
+// render draws the logo and the text for an image of the width, on a transparent
+// background
+func (w *Watermark) render(width int) (*image.RGBA, error) {
+	var logo image.Image
+	if w.Logo != nil {
+		logo = resize.Resize(uint(max(width/5, 1)), 0, w.Logo, resize.Bilinear)
+	}
+
+	var face font.Face
+	var textWidth, textHeight, ascent int
+	if w.Text != "" {
+		parsed, err := watermarkFont()
+		if err != nil {
+			return nil, err
+		}
+		face, err = opentype.NewFace(parsed, &opentype.FaceOptions{
+			Size:    float64(max(width/40, 12)),
+			DPI:     72,
+			Hinting: font.HintingFull,
+		})
+		if err != nil {
+			return nil, err
+		}
+		defer face.Close()
+
+		metrics := face.Metrics()
+		ascent = metrics.Ascent.Ceil()
+		textWidth = font.MeasureString(face, w.Text).Ceil()
+		textHeight = ascent + metrics.Descent.Ceil()
+	}
+
+	// the shadow keeps white text readable on light paintings
+	shadow := max(textHeight/16, 1)
+	canvasWidth, canvasHeight := textWidth+shadow, 0
+	if textHeight > 0 {
+		canvasHeight = textHeight + shadow
+	}
+	logoHeight := 0
+	if logo != nil {
+		logoHeight = logo.Bounds().Dy()
+		canvasWidth = max(canvasWidth, logo.Bounds().Dx())
+		canvasHeight += logoHeight
+	}
+
+	canvas := image.NewRGBA(image.Rect(0, 0, canvasWidth, canvasHeight))
+	if logo != nil {
+		x := (canvasWidth - logo.Bounds().Dx()) / 2
+		draw.Draw(canvas, image.Rect(x, 0, x+logo.Bounds().Dx(), logoHeight), logo, logo.Bounds().Min, draw.Over)
+	}
+	if face != nil {
+		x := (canvasWidth - textWidth - shadow) / 2
+		baseline := logoHeight + ascent
+		drawer := font.Drawer{Dst: canvas, Face: face}
+
+		drawer.Src = image.NewUniform(color.RGBA{A: 160})
+		drawer.Dot = fixed.P(x+shadow, baseline+shadow)
+		drawer.DrawString(w.Text)
+
+		drawer.Src = image.White
+		drawer.Dot = fixed.P(x, baseline)
+		drawer.DrawString(w.Text)
+	}
+	return canvas, nil
+}
+
+// sizeName names an image resized to the width, with the watermark's signature when
+// it is watermarked
+func (u *ImageUploader) sizeName(width int) string {
+	if u.watermark.appliesTo(width) {
+		return strconv.Itoa(width) + "-" + u.watermark.signature
+	}
+	return strconv.Itoa(width)
+}
+
+// watermarkResized watermarks an image resized to the width when it should be
+func (u *ImageUploader) watermarkResized(img image.Image, width int) (image.Image, error) {
+	if !u.watermark.appliesTo(width) {
+		return img, nil
+	}
+	return u.watermark.apply(img)
+}
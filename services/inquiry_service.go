@@ -0,0 +1,52 @@
+package services
+
+import "strings"
+
+// Inquiry form fields, also used as keys for the per-field errors
+const (
+	InquiryFieldName    = "name"
+	InquiryFieldEmail   = "email"
+	InquiryFieldMessage = "message"
+)
+
+// InquiryMaxMessageLength keeps a single inquiry to a reasonable email
+const InquiryMaxMessageLength = 5000
+
+// InquiryForm is what the visitor fills in on an artwork
+type InquiryForm struct {
+	Name    string
+	Email   string
+	Message string
+}
+
+// InquiryErrors maps an inquiry field to the message shown next to it
+type InquiryErrors map[string]string
+
+func (form InquiryForm) Normalize() InquiryForm {
+	form.Name = strings.TrimSpace(form.Name)
+	form.Email = strings.TrimSpace(form.Email)
+	form.Message = strings.TrimSpace(form.Message)
+	return form
+}
+
+// ValidateInquiryForm checks a normalized form
+func ValidateInquiryForm(form InquiryForm) InquiryErrors {
+	errors := InquiryErrors{}
+
+	if form.Name == "" {
+		errors[InquiryFieldName] = "Ange ditt namn"
+	}
+	if form.Email == "" {
+		errors[InquiryFieldEmail] = "Ange din e-postadress"
+	} else if !IsValidEmail(form.Email) {
+		errors[InquiryFieldEmail] = "Ange en giltig e-postadress"
+	}
+	switch {
+	case form.Message == "":
+		errors[InquiryFieldMessage] = "Skriv ett meddelande"
+	case len(form.Message) > InquiryMaxMessageLength:
+		errors[InquiryFieldMessage] = "Meddelandet är för långt"
+	}
+
+	return errors
+}
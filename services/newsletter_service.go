@@ -0,0 +1,52 @@
+package services
+
+import (
+	"html"
+	"time"
+
+	"github.com/sebwib/emma-site-htmx/db"
+	"github.com/sebwib/emma-site-htmx/lib/markdown"
+	gomail "gopkg.in/mail.v2"
+)
+
+// NewsletterSendInterval is the pause between newsletter emails. Gmail accounts may
+// only send a few hundred emails a day and throttle bursts.
+const NewsletterSendInterval = 2 * time.Second
+
+func NewsletterUnsubscribeURL(token string) string {
+	return SiteURL("/newsletter/unsubscribe/" + token)
+}
+
+// SendNewsletterConfirmation asks a new subscriber to confirm the signup
+func SendNewsletterConfirmation(subscriber db.Subscriber) error {
+	subject := "Bekräfta din prenumeration på Emma Jelks nyhetsbrev"
+	body := "Hej!\n\n"
+	body += "Tack för att du vill få nyhetsbrevet. Klicka på länken för att bekräfta din e-postadress:\n"
+	body += SiteURL("/newsletter/confirm/"+subscriber.Token) + "\n\n"
+	body += "Har du inte anmält dig kan du bortse från det här mejlet.\n"
+
+	return sendEmailTo(subscriber.Email, subject, body)
+}
+
+// NewsletterHTML renders the newsletter body with the unsubscribe footer
+func NewsletterHTML(newsletter db.Newsletter, unsubscribeURL string) string {
+	return `<!DOCTYPE html><html><body style="font-family: Helvetica, Arial, sans-serif; max-width: 600px; margin: 0 auto; color: #222;">` +
+		markdown.ToHTML(newsletter.Body) +
+		`<hr><p style="font-size: 12px; color: #777;">Du får det här mejlet för att du prenumererar på Emma Jelks nyhetsbrev. ` +
+		`<a href="` + html.EscapeString(unsubscribeURL) + `">Avsluta prenumerationen</a></p>` +
+		`</body></html>`
+}
+
+// SendNewsletter sends one newsletter email, with the markdown source as the plain text version
+func SendNewsletter(newsletter db.Newsletter, delivery db.NewsletterDelivery) error {
+	unsubscribeURL := NewsletterUnsubscribeURL(delivery.SubscriberToken)
+
+	message := gomail.NewMessage()
+	message.SetHeader("To", delivery.Email)
+	message.SetHeader("Subject", newsletter.Subject)
+	message.SetHeader("List-Unsubscribe", "<"+unsubscribeURL+">")
+	message.SetBody("text/plain", newsletter.Body+"\n\n--\nAvsluta prenumerationen: "+unsubscribeURL+"\n")
+	message.AddAlternative("text/html", NewsletterHTML(newsletter, unsubscribeURL))
+
+	return sendMessage(message)
+}
@@ -0,0 +1,287 @@
+package services
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sebwib/emma-site-htmx/db"
+	"github.com/sebwib/emma-site-htmx/lib/pdf"
+)
+
+// VAT rates included in the prices. Originals and commissions sold by the artist have the
+// reduced art rate, gift cards are vouchers and carry no VAT until they are used.
+const (
+	VATRatePrint    = 0.25
+	VATRateOriginal = 0.12
+	VATRateShipping = 0.25
+)
+
+func VATRateForType(typ string) float64 {
+	switch typ {
+	case CartItemTypeOriginal, CartItemTypeCommission:
+		return VATRateOriginal
+	case CartItemTypeGiftCard:
+		return 0
+	default:
+		return VATRatePrint
+	}
+}
+
+// SellerDetails are the lines printed as the sender on packing slips and invoices
+type SellerDetails struct {
+	Lines []string
+	Terms string
+}
+
+func NewSellerDetails(details string, terms string) SellerDetails {
+	var lines []string
+	for _, line := range strings.Split(details, "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return SellerDetails{Lines: lines, Terms: strings.TrimSpace(terms)}
+}
+
+const (
+	documentMargin = 50.0
+	documentRight  = pdf.PageWidth - documentMargin
+	documentBottom = pdf.PageHeight - 70.0
+)
+
+func formatAmount(amount float64) string {
+	return strconv.FormatFloat(math.Round(amount*100)/100, 'f', 2, 64)
+}
+
+func formatDocumentDate(value string) string {
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return value
+	}
+	return t.Local().Format("2006-01-02")
+}
+
+// writeDocumentHeader draws the title, the seller and the reference lines and
+// returns where the content should start
+func writeDocumentHeader(page *pdf.Page, title string, seller SellerDetails, references [][2]string) float64 {
+	page.Text(documentMargin, 80, 22, true, title)
+
+	y := 60.0
+	for _, line := range seller.Lines {
+		page.TextRight(documentRight, y, 9, false, line)
+		y += 12
+	}
+
+	y = max(y, 110) + 10
+	for _, reference := range references {
+		page.Text(documentMargin, y, 10, true, reference[0])
+		page.Text(documentMargin+110, y, 10, false, reference[1])
+		y += 14
+	}
+	return y + 10
+}
+
+// writeDeliveryAddress draws the buyer's name and address under a heading
+func writeDeliveryAddress(page *pdf.Page, y float64, heading string, order db.Order) float64 {
+	page.Text(documentMargin, y, 10, true, heading)
+	y += 14
+	lines := append(order.AddressLines(), ShippingCountryName(order.Country))
+	if order.Phone != "" {
+		lines = append(lines, "Tel. "+order.Phone)
+	}
+	for _, line := range lines {
+		page.Text(documentMargin, y, 10, false, line)
+		y += 13
+	}
+	return y + 14
+}
+
+// PackingSlipPDF lists what goes in the package. thumbnails holds JPEG data keyed by order row UUID.
+func PackingSlipPDF(order db.Order, seller SellerDetails, thumbnails map[string][]byte) ([]byte, error) {
+	document := pdf.New()
+	page := document.AddPage()
+
+	y := writeDocumentHeader(page, "Följesedel", seller, [][2]string{
+		{"Ordernummer", OrderNumber(order)},
+		{"Orderdatum", formatDocumentDate(order.CreatedAt)},
+		{"Kund", order.BuyerEmail},
+	})
+	y = writeDeliveryAddress(page, y, "Leveransadress", order)
+
+	page.Text(documentMargin+70, y, 10, true, "Artikel")
+	page.TextRight(documentRight, y, 10, true, "Antal")
+	page.Line(documentMargin, y+6, documentRight, y+6, 0.5)
+	y += 14
+
+	const thumbSize = 56.0
+	for _, row := range order.Rows {
+		if y+thumbSize > documentBottom {
+			page = document.AddPage()
+			y = 60
+		}
+
+		if data, ok := thumbnails[row.UUID]; ok {
+			if img, err := document.AddJPEG(data); err == nil {
+				width, height := img.Size()
+				scale := thumbSize / float64(max(width, height))
+				page.Image(img, documentMargin, y, float64(width)*scale, float64(height)*scale)
+			}
+		}
+
+		title := row.Title
+		if row.Typ == CartItemTypeGiftCard {
+			title += " (skickas via e-post)"
+		}
+		page.Text(documentMargin+70, y+20, 11, false, title)
+		page.TextRight(documentRight, y+20, 11, true, strconv.Itoa(row.Quantity))
+		y += thumbSize + 10
+		page.Line(documentMargin, y-5, documentRight, y-5, 0.25)
+	}
+
+	var out bytes.Buffer
+	if err := document.Write(&out); err != nil {
+		return nil, err
+	}
+	return out.Bytes(), nil
+}
+
+type invoiceLine struct {
+	Description string
+	Quantity    int
+	UnitPrice   float64
+	VATRate     float64
+}
+
+func (line invoiceLine) Total() float64 {
+	return float64(line.Quantity) * line.UnitPrice
+}
+
+func invoiceLines(order db.Order) []invoiceLine {
+	lines := make([]invoiceLine, 0, len(order.Rows)+2)
+	for _, row := range order.Rows {
+		lines = append(lines, invoiceLine{
+			Description: row.Title,
+			Quantity:    row.Quantity,
+			UnitPrice:   row.Price,
+			VATRate:     VATRateForType(row.Typ),
+		})
+	}
+	if order.DiscountAmount > 0 {
+		// discount codes only apply to prints
+		lines = append(lines, invoiceLine{
+			Description: "Rabatt " + order.DiscountCode,
+			Quantity:    1,
+			UnitPrice:   -order.DiscountAmount,
+			VATRate:     VATRatePrint,
+		})
+	}
+	if order.ShippingCost > 0 {
+		lines = append(lines, invoiceLine{
+			Description: "Frakt och paketering",
+			Quantity:    1,
+			UnitPrice:   order.ShippingCost,
+			VATRate:     VATRateShipping,
+		})
+	}
+	return lines
+}
+
+// InvoicePDF renders the invoice for an order that has been given an invoice number
+func InvoicePDF(order db.Order, seller SellerDetails) ([]byte, error) {
+	if order.InvoiceNumber == 0 {
+		return nil, fmt.Errorf("order %s has no invoice number", order.OrderID)
+	}
+
+	document := pdf.New()
+	page := document.AddPage()
+
+	y := writeDocumentHeader(page, "Faktura", seller, [][2]string{
+		{"Fakturanummer", strconv.Itoa(order.InvoiceNumber)},
+		{"Fakturadatum", formatDocumentDate(order.InvoiceDate)},
+		{"Ordernummer", OrderNumber(order)},
+		{"Kund", order.BuyerEmail},
+	})
+	y = writeDeliveryAddress(page, y, "Kund", order)
+
+	columns := []float64{documentRight - 210, documentRight - 140, documentRight - 70, documentRight}
+	page.Text(documentMargin, y, 10, true, "Beskrivning")
+	page.TextRight(columns[0], y, 10, true, "Antal")
+	page.TextRight(columns[1], y, 10, true, "À-pris")
+	page.TextRight(columns[2], y, 10, true, "Moms")
+	page.TextRight(columns[3], y, 10, true, "Belopp")
+	page.Line(documentMargin, y+6, documentRight, y+6, 0.5)
+	y += 20
+
+	total := 0.0
+	vatByRate := map[float64]float64{}
+	for _, line := range invoiceLines(order) {
+		if y > documentBottom {
+			page = document.AddPage()
+			y = 60
+		}
+		page.Text(documentMargin, y, 10, false, line.Description)
+		page.TextRight(columns[0], y, 10, false, strconv.Itoa(line.Quantity))
+		page.TextRight(columns[1], y, 10, false, formatAmount(line.UnitPrice))
+		page.TextRight(columns[2], y, 10, false, fmt.Sprintf("%.0f %%", line.VATRate*100))
+		page.TextRight(columns[3], y, 10, false, formatAmount(line.Total()))
+		y += 16
+
+		total += line.Total()
+		vatByRate[line.VATRate] += line.Total() - line.Total()/(1+line.VATRate)
+	}
+
+	if y+120 > documentBottom {
+		page = document.AddPage()
+		y = 60
+	}
+
+	page.Line(documentMargin, y-6, documentRight, y-6, 0.5)
+	y += 10
+
+	rates := make([]float64, 0, len(vatByRate))
+	totalVAT := 0.0
+	for rate, vat := range vatByRate {
+		if rate > 0 {
+			rates = append(rates, rate)
+			totalVAT += vat
+		}
+	}
+	sort.Sort(sort.Reverse(sort.Float64Slice(rates)))
+
+	summary := func(label string, amount float64, bold bool) {
+		page.TextRight(columns[2], y, 10, bold, label)
+		page.TextRight(columns[3], y, 10, bold, formatAmount(amount)+" kr")
+		y += 16
+	}
+
+	summary("Summa exkl. moms", total-totalVAT, false)
+	for _, rate := range rates {
+		summary(fmt.Sprintf("Moms %.0f %%", rate*100), vatByRate[rate], false)
+	}
+	summary("Totalt inkl. moms", total, true)
+	if order.GiftCardAmount > 0 {
+		summary("Betalt med presentkort", -order.GiftCardAmount, false)
+		summary("Att betala", order.AmountDue(), true)
+	}
+
+	termLines := strings.Split(seller.Terms, "\n")
+	for i, line := range termLines {
+		page.Text(documentMargin, pdf.PageHeight-50-float64(len(termLines)-1-i)*12, 9, false, strings.TrimSpace(line))
+	}
+
+	var out bytes.Buffer
+	if err := document.Write(&out); err != nil {
+		return nil, err
+	}
+	return out.Bytes(), nil
+}
+
+// ThumbnailJPEG scales an uploaded image down for use in generated documents
+func ThumbnailJPEG(data []byte) ([]byte, error) {
+	return resizeImage(data, 160, FormatJPEG.DefaultQuality)
+}
@@ -0,0 +1,254 @@
+package services
+
+import (
+	"net/url"
+	"strings"
+)
+
+type ShippingZone string
+
+const (
+	ShippingZoneSweden ShippingZone = "SE"
+	ShippingZoneEU     ShippingZone = "EU"
+	ShippingZoneWorld  ShippingZone = "WORLD"
+)
+
+type ShippingClass string
+
+const (
+	ShippingClassSmall  ShippingClass = "SMALL"
+	ShippingClassMedium ShippingClass = "MEDIUM"
+	ShippingClassLarge  ShippingClass = "LARGE"
+)
+
+const DefaultShippingCountry = "SE"
+
+type ShippingCountry struct {
+	Code string
+	Name string
+}
+
+// ShippingCountries lists the destinations selectable in the cart
+var ShippingCountries = []ShippingCountry{
+	{Code: "SE", Name: "Sverige"},
+	{Code: "NO", Name: "Norge"},
+	{Code: "DK", Name: "Danmark"},
+	{Code: "FI", Name: "Finland"},
+	{Code: "DE", Name: "Tyskland"},
+	{Code: "NL", Name: "Nederländerna"},
+	{Code: "BE", Name: "Belgien"},
+	{Code: "FR", Name: "Frankrike"},
+	{Code: "ES", Name: "Spanien"},
+	{Code: "IT", Name: "Italien"},
+	{Code: "AT", Name: "Österrike"},
+	{Code: "PL", Name: "Polen"},
+	{Code: "IE", Name: "Irland"},
+	{Code: "GB", Name: "Storbritannien"},
+	{Code: "US", Name: "USA"},
+	{Code: "OTHER", Name: "Övriga världen"},
+}
+
+var euCountries = map[string]bool{
+	"AT": true, "BE": true, "BG": true, "HR": true, "CY": true, "CZ": true, "DK": true,
+	"EE": true, "FI": true, "FR": true, "DE": true, "GR": true, "HU": true, "IE": true,
+	"IT": true, "LV": true, "LT": true, "LU": true, "MT": true, "NL": true, "PL": true,
+	"PT": true, "RO": true, "SK": true, "SI": true, "ES": true,
+}
+
+// shippingRates is the cost of sending one package of a given class to a zone
+var shippingRates = map[ShippingZone]map[ShippingClass]float64{
+	ShippingZoneSweden: {
+		ShippingClassSmall:  59,
+		ShippingClassMedium: 89,
+		ShippingClassLarge:  149,
+	},
+	ShippingZoneEU: {
+		ShippingClassSmall:  119,
+		ShippingClassMedium: 179,
+		ShippingClassLarge:  299,
+	},
+	ShippingZoneWorld: {
+		ShippingClassSmall:  179,
+		ShippingClassMedium: 259,
+		ShippingClassLarge:  449,
+	},
+}
+
+// extraItemRates is added for every item beyond the first in the same package
+var extraItemRates = map[ShippingZone]float64{
+	ShippingZoneSweden: 15,
+	ShippingZoneEU:     30,
+	ShippingZoneWorld:  50,
+}
+
+// freeShippingThresholds is the subtotal at which shipping becomes free, 0 means never
+var freeShippingThresholds = map[ShippingZone]float64{
+	ShippingZoneSweden: 1500,
+	ShippingZoneEU:     2500,
+	ShippingZoneWorld:  0,
+}
+
+type ShippingItem struct {
+	Width    int
+	Height   int
+	Quantity int
+}
+
+type ShippingQuote struct {
+	Country       string
+	Zone          ShippingZone
+	Class         ShippingClass
+	Cost          float64
+	FreeShipping  bool
+	FreeThreshold float64
+}
+
+func ShippingCountryName(code string) string {
+	for _, country := range ShippingCountries {
+		if country.Code == code {
+			return country.Name
+		}
+	}
+	return code
+}
+
+// IsShippingCountry tells if the code is one of ShippingCountries
+func IsShippingCountry(code string) bool {
+	for _, country := range ShippingCountries {
+		if country.Code == code {
+			return true
+		}
+	}
+	return false
+}
+
+func ShippingZoneForCountry(code string) ShippingZone {
+	code = strings.ToUpper(strings.TrimSpace(code))
+	if code == "" || code == "SE" {
+		return ShippingZoneSweden
+	}
+	if euCountries[code] {
+		return ShippingZoneEU
+	}
+	return ShippingZoneWorld
+}
+
+// ShippingClassForSize derives the package class from the print size in cm
+func ShippingClassForSize(width, height int) ShippingClass {
+	longest := max(width, height)
+	switch {
+	case longest <= 0:
+		// unknown size, assume a regular tube
+		return ShippingClassMedium
+	case longest <= 30:
+		return ShippingClassSmall
+	case longest <= 50:
+		return ShippingClassMedium
+	default:
+		return ShippingClassLarge
+	}
+}
+
+func ShippingClassToString(class ShippingClass) string {
+	switch class {
+	case ShippingClassSmall:
+		return "Liten"
+	case ShippingClassMedium:
+		return "Mellan"
+	case ShippingClassLarge:
+		return "Stor"
+	default:
+		return string(class)
+	}
+}
+
+func shippingClassRank(class ShippingClass) int {
+	switch class {
+	case ShippingClassSmall:
+		return 1
+	case ShippingClassMedium:
+		return 2
+	case ShippingClassLarge:
+		return 3
+	default:
+		return 0
+	}
+}
+
+// QuoteShipping prices one package for all items, sized after the largest item
+func QuoteShipping(country string, items []ShippingItem, subtotal float64) ShippingQuote {
+	if country == "" {
+		country = DefaultShippingCountry
+	}
+
+	zone := ShippingZoneForCountry(country)
+	quote := ShippingQuote{
+		Country:       country,
+		Zone:          zone,
+		FreeThreshold: freeShippingThresholds[zone],
+	}
+
+	itemCount := 0
+	for _, item := range items {
+		class := ShippingClassForSize(item.Width, item.Height)
+		if shippingClassRank(class) > shippingClassRank(quote.Class) {
+			quote.Class = class
+		}
+		itemCount += item.Quantity
+	}
+
+	if itemCount == 0 {
+		return quote
+	}
+
+	if quote.FreeThreshold > 0 && subtotal >= quote.FreeThreshold {
+		quote.FreeShipping = true
+		return quote
+	}
+
+	quote.Cost = shippingRates[zone][quote.Class] + float64(itemCount-1)*extraItemRates[zone]
+	return quote
+}
+
+type Carrier string
+
+const (
+	CarrierPostNord Carrier = "POSTNORD"
+	CarrierDHL      Carrier = "DHL"
+	CarrierBring    Carrier = "BRING"
+)
+
+// Carriers lists the carriers selectable when shipping an order
+var Carriers = []Carrier{CarrierPostNord, CarrierDHL, CarrierBring}
+
+func CarrierName(carrier Carrier) string {
+	switch carrier {
+	case CarrierPostNord:
+		return "PostNord"
+	case CarrierDHL:
+		return "DHL"
+	case CarrierBring:
+		return "Bring"
+	default:
+		return string(carrier)
+	}
+}
+
+// TrackingURL links to the carrier's tracking page for a shipment, empty if unknown
+func TrackingURL(carrier Carrier, trackingNumber string) string {
+	trackingNumber = strings.TrimSpace(trackingNumber)
+	if trackingNumber == "" {
+		return ""
+	}
+
+	switch carrier {
+	case CarrierPostNord:
+		return "https://tracking.postnord.com/se/?id=" + url.QueryEscape(trackingNumber)
+	case CarrierDHL:
+		return "https://www.dhl.com/se-sv/home/tracking.html?tracking-id=" + url.QueryEscape(trackingNumber)
+	case CarrierBring:
+		return "https://tracking.bring.se/tracking/" + url.PathEscape(trackingNumber)
+	default:
+		return ""
+	}
+}